@@ -7,47 +7,34 @@ import (
 	"net/http"
 	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/cassaram/bfc/backend/config"
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/neuronview"
 	"github.com/cassaram/bfc/backend/router"
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
 	log "github.com/sirupsen/logrus"
 )
 
-type APIV1Router struct {
-	ID          int    `json:"id"`
-	DisplayName string `json:"display_name"`
-	ShortName   string `json:"short_name"`
+type apiWebsocketClient struct {
+	conn    *websocket.Conn
+	events  bool
+	nameSet string
+	queue   chan any
+	closed  chan bool
 }
 
-type APIV1RouterTableCrosspoint struct {
-	DestinationLevelID int  `json:"destination_level_id"`
-	SourceID           int  `json:"source_id"`
-	SourceLevelID      int  `json:"source_level_id"`
-	Locked             bool `json:"locked"`
-}
-
-type APIV1RouterTableLine struct {
-	ID                  int                          `json:"id"`
-	Name                string                       `json:"name"`
-	Crosspoints         []APIV1RouterTableCrosspoint `json:"crosspoints"`
-	CrosspointsAsString []string                     `json:"crosspoints_as_string"`
-}
-
-type APIV1RouterTableValidSource struct {
-	SourceID      int `json:"source_id"`
-	SourceLevelID int `json:"source_level_id"`
-}
-
-type APIV1RouterTableValidSources struct {
-	Sources         [][]APIV1RouterTableValidSource `json:"sources"`
-	SourcesAsString [][]string                      `json:"sources_as_string"`
-}
+// Messages queued per websocket client before it is considered too slow and disconnected
+const websocketQueueSize = 1024
 
 type APIHandler struct {
-	websocketClients []*websocket.Conn
+	websocketClients      []*apiWebsocketClient
+	websocketClientsMutex sync.Mutex
+	// Patterns registered on the v1 mux, for the OpenAPI document
+	patterns []string
 }
 
 func NewAPIHandler() *APIHandler {
@@ -55,19 +42,76 @@ func NewAPIHandler() *APIHandler {
 	return &api
 }
 
+// handleFunc registers a handler, instrumented under its full pattern including the /api/v1 prefix
+func (a *APIHandler) handleFunc(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	fullPattern := "/api/v1" + pattern
+	if method, path, found := strings.Cut(pattern, " "); found {
+		fullPattern = method + " /api/v1" + path
+	}
+	mux.HandleFunc(pattern, instrumentHandler(fullPattern, handler))
+	a.patterns = append(a.patterns, pattern)
+}
+
 func (a *APIHandler) GetServeMux() *http.ServeMux {
 	// API V1
 	muxV1 := http.NewServeMux()
-	muxV1.HandleFunc("/ws", a.APIV1HandleWS)
-	muxV1.HandleFunc("GET /routers", a.APIV1HandleRouters)
-	muxV1.HandleFunc("GET /routers/{router_id}/table", a.APIV1HandleRouterTable)
-	muxV1.HandleFunc("GET /routers/{router_id}/validsources", a.APIV1HandleRouterTableValidSources)
-	muxV1.HandleFunc("GET /routers/{router_id}/crosspoints", a.APIV1HandleCrosspoints)
-	muxV1.HandleFunc("PUT /routers/{router_id}/crosspoints", a.APIV1HandleCrosspointsPut)
-	muxV1.HandleFunc("PUT /routers/{router_id}/crosspoints/lock", a.APIV1HandleCrosspointsLockPut)
-	muxV1.HandleFunc("GET /routers/{router_id}/destinations", a.APIV1HandleDestinations)
-	muxV1.HandleFunc("GET /routers/{router_id}/levels", a.APIV1HandleLevels)
-	muxV1.HandleFunc("GET /routers/{router_id}/sources", a.APIV1HandleSources)
+	a.patterns = nil
+	a.handleFunc(muxV1, "/ws", a.APIV1HandleWS)
+	a.handleFunc(muxV1, "GET /drivers", a.APIV1HandleDrivers)
+	a.handleFunc(muxV1, "GET /routers", a.APIV1HandleRouters)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/capabilities", a.APIV1HandleCapabilities)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/status", a.APIV1HandleStatus)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/table", a.APIV1HandleRouterTable)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/validsources", a.APIV1HandleRouterTableValidSources)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/crosspoints", a.APIV1HandleCrosspoints)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/history", a.APIV1HandleHistory)
+	a.handleFunc(muxV1, "PUT /routers/{router_id}/crosspoints", a.APIV1HandleCrosspointsPut)
+	a.handleFunc(muxV1, "PUT /routers/{router_id}/crosspoints/lock", a.APIV1HandleCrosspointsLockPut)
+	a.handleFunc(muxV1, "PUT /routers/{router_id}/crosspoints/mapped", a.APIV1HandleMappedCrosspointsPut)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/level_mappings", a.APIV1HandleLevelMappings)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/destinations", a.APIV1HandleDestinations)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/levels", a.APIV1HandleLevels)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/sources", a.APIV1HandleSources)
+	a.handleFunc(muxV1, "POST /routers/{router_id}/multiviewer/layout", a.APIV1HandleMultiviewerLayoutPost)
+	a.handleFunc(muxV1, "POST /multiviewer/streams/sdp", a.APIV1HandleMultiviewerStreamsSDPPost)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/tags", a.APIV1HandleTags)
+	a.handleFunc(muxV1, "PUT /routers/{router_id}/sources/{source}/tags", a.APIV1HandleSourceTagsPut)
+	a.handleFunc(muxV1, "PUT /routers/{router_id}/destinations/{destination}/tags", a.APIV1HandleDestinationTagsPut)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/namesets", a.APIV1HandleNameSets)
+	a.handleFunc(muxV1, "GET /routers/{router_id}/namesets/{name}", a.APIV1HandleNameSet)
+	a.handleFunc(muxV1, "PUT /routers/{router_id}/namesets/{name}", a.APIV1HandleNameSetPut)
+	a.handleFunc(muxV1, "DELETE /routers/{router_id}/namesets/{name}", a.APIV1HandleNameSetDelete)
+	a.handleFunc(muxV1, "GET /user", a.APIV1HandleUser)
+	a.handleFunc(muxV1, "PUT /user/preferences", a.APIV1HandleUserPreferencesPut)
+	a.handleFunc(muxV1, "GET /user/panels", a.APIV1HandlePanels)
+	a.handleFunc(muxV1, "GET /user/panels/{name}", a.APIV1HandlePanel)
+	a.handleFunc(muxV1, "PUT /user/panels/{name}", a.APIV1HandlePanelPut)
+	a.handleFunc(muxV1, "DELETE /user/panels/{name}", a.APIV1HandlePanelDelete)
+	a.handleFunc(muxV1, "GET /undo", a.APIV1HandleUndo)
+	a.handleFunc(muxV1, "POST /undo", a.APIV1HandleUndoPost)
+	a.handleFunc(muxV1, "GET /salvos", a.APIV1HandleSalvos)
+	a.handleFunc(muxV1, "GET /salvos/{name}", a.APIV1HandleSalvo)
+	a.handleFunc(muxV1, "PUT /salvos/{name}", a.APIV1HandleSalvoPut)
+	a.handleFunc(muxV1, "DELETE /salvos/{name}", a.APIV1HandleSalvoDelete)
+	a.handleFunc(muxV1, "POST /salvos/{name}/fire", a.APIV1HandleSalvoFirePost)
+	a.handleFunc(muxV1, "GET /snapshots", a.APIV1HandleSnapshots)
+	a.handleFunc(muxV1, "GET /snapshots/{name}", a.APIV1HandleSnapshot)
+	a.handleFunc(muxV1, "PUT /snapshots/{name}", a.APIV1HandleSnapshotPut)
+	a.handleFunc(muxV1, "DELETE /snapshots/{name}", a.APIV1HandleSnapshotDelete)
+	a.handleFunc(muxV1, "POST /snapshots/{name}/restore", a.APIV1HandleSnapshotRestorePost)
+	a.handleFunc(muxV1, "GET /audit", a.APIV1HandleAudit)
+	a.handleFunc(muxV1, "GET /schedule/jobs", a.APIV1HandleJobs)
+	a.handleFunc(muxV1, "GET /schedule/jobs/{name}", a.APIV1HandleJob)
+	a.handleFunc(muxV1, "PUT /schedule/jobs/{name}", a.APIV1HandleJobPut)
+	a.handleFunc(muxV1, "DELETE /schedule/jobs/{name}", a.APIV1HandleJobDelete)
+	a.handleFunc(muxV1, "GET /schedule/jobs/{name}/results", a.APIV1HandleJobResults)
+	a.handleFunc(muxV1, "GET /schedule/upcoming", a.APIV1HandleScheduleUpcoming)
+	a.handleFunc(muxV1, "GET /bookings", a.APIV1HandleBookings)
+	a.handleFunc(muxV1, "GET /bookings/{name}", a.APIV1HandleBooking)
+	a.handleFunc(muxV1, "PUT /bookings/{name}", a.APIV1HandleBookingPut)
+	a.handleFunc(muxV1, "DELETE /bookings/{name}", a.APIV1HandleBookingDelete)
+	a.handleFunc(muxV1, "POST /admin/reload", a.APIV1HandleAdminReloadPost)
+	a.handleFunc(muxV1, "GET /openapi.json", a.APIV1HandleOpenAPI)
 
 	// Full API handler
 	muxAPI := http.NewServeMux()
@@ -76,6 +120,8 @@ func (a *APIHandler) GetServeMux() *http.ServeMux {
 	return muxAPI
 }
 
+// APIV1HandleWS streams changes to the client.
+// By default only crosspoints are sent. With ?format=events every message is an apiv1.Event.
 func (a *APIHandler) APIV1HandleWS(w http.ResponseWriter, r *http.Request) {
 	options := websocket.AcceptOptions{
 		InsecureSkipVerify: true,
@@ -85,33 +131,148 @@ func (a *APIHandler) APIV1HandleWS(w http.ResponseWriter, r *http.Request) {
 		log.Error("API V1 Websocket Handler: ", err.Error())
 		return
 	}
-	a.websocketClients = append(a.websocketClients, wsConn)
+	client := &apiWebsocketClient{
+		conn:   wsConn,
+		events: r.URL.Query().Get("format") == "events",
+		// Applied on the routers which have a name set of this name
+		nameSet: r.URL.Query().Get("nameset"),
+		queue:   make(chan any, websocketQueueSize),
+		closed:  make(chan bool),
+	}
+	// Handle control frames and notice when the client goes away
+	if client.nameSet == "" {
+		client.nameSet = getUserPreferences(requestUser(r)).NameSet
+	}
+	ctx := wsConn.CloseRead(context.Background())
+	a.websocketClientsMutex.Lock()
+	a.websocketClients = append(a.websocketClients, client)
+	a.websocketClientsMutex.Unlock()
+	go a.websocketWriter(ctx, client)
 }
 
-func (a *APIHandler) APIV1SendCrosspoint(crosspoint router.Crosspoint) {
-	go func(crosspoint router.Crosspoint) {
-		for i, c := range a.websocketClients {
-			ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-			err := wsjson.Write(ctx, c, crosspoint)
+// websocketWriter sends queued messages to a client until it disconnects
+func (a *APIHandler) websocketWriter(ctx context.Context, client *apiWebsocketClient) {
+	defer a.removeWebsocketClient(client)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-client.closed:
+			return
+		case msg := <-client.queue:
+			writeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err := wsjson.Write(writeCtx, client.conn, msg)
+			cancel()
 			if err != nil {
 				// Websocket connection probably closed
 				// Close in case its not already. We can ignore the error since if the other side closed it it doesn't matter
-				c.Close(websocket.StatusProtocolError, err.Error())
-				a.websocketClients = slices.Delete(a.websocketClients, i, i)
+				client.conn.Close(websocket.StatusProtocolError, err.Error())
+				return
 			}
 		}
-	}(crosspoint)
+	}
+}
+
+func (a *APIHandler) removeWebsocketClient(client *apiWebsocketClient) {
+	a.websocketClientsMutex.Lock()
+	a.websocketClients = slices.DeleteFunc(a.websocketClients, func(c *apiWebsocketClient) bool {
+		return c == client
+	})
+	a.websocketClientsMutex.Unlock()
+}
+
+// sendWebsocket queues a message for every client. legacy is sent to clients not using the events format, if not nil.
+func (a *APIHandler) sendWebsocket(event apiv1.Event, legacy any) {
+	a.websocketClientsMutex.Lock()
+	defer a.websocketClientsMutex.Unlock()
+	named := make(map[string]apiv1.Event)
+	for _, c := range a.websocketClients {
+		msg := any(event)
+		if !c.events {
+			if legacy == nil {
+				continue
+			}
+			msg = legacy
+		} else if event.Crosspoint != nil {
+			namedEvent, ok := named[c.nameSet]
+			if !ok {
+				namedEvent = nameCrosspointEvent(event, c.nameSet)
+				named[c.nameSet] = namedEvent
+			}
+			msg = namedEvent
+		}
+		select {
+		case c.queue <- msg:
+		default:
+			// Client can't keep up, drop it rather than block everyone else
+			select {
+			case <-c.closed:
+			default:
+				log.Warn("API V1 Websocket Handler: Client queue full, disconnecting")
+				close(c.closed)
+				go c.conn.Close(websocket.StatusPolicyViolation, "client too slow")
+			}
+		}
+	}
+}
+
+// CloseWebsockets closes every websocket connection with the given status
+func (a *APIHandler) CloseWebsockets(code websocket.StatusCode, reason string) {
+	a.websocketClientsMutex.Lock()
+	clients := slices.Clone(a.websocketClients)
+	a.websocketClientsMutex.Unlock()
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.conn.Close(code, reason)
+		}()
+	}
+	wg.Wait()
+}
+
+// WebsocketStats returns the number of connected websocket clients and the total messages queued for them
+func (a *APIHandler) WebsocketStats() (int, int) {
+	a.websocketClientsMutex.Lock()
+	defer a.websocketClientsMutex.Unlock()
+	queued := 0
+	for _, c := range a.websocketClients {
+		queued += len(c.queue)
+	}
+	return len(a.websocketClients), queued
+}
+
+func (a *APIHandler) APIV1SendCrosspoint(routerID int, crosspoint router.Crosspoint) {
+	a.sendWebsocket(apiv1.Event{
+		Type:       apiv1.EventCrosspoint,
+		RouterID:   routerID,
+		Crosspoint: &crosspoint,
+	}, crosspoint)
+}
+
+func (a *APIHandler) APIV1SendRouterStatus(routerID int, status router.Status) {
+	a.sendWebsocket(apiv1.Event{
+		Type:     apiv1.EventRouterStatus,
+		RouterID: routerID,
+		Status:   &status,
+	}, nil)
 }
 
 func (a *APIHandler) APIV1HandleRouters(w http.ResponseWriter, r *http.Request) {
-	rtrs := make([]APIV1Router, 0)
-	for _, rtrCfg := range ConfigFile.Routers {
-		//rtr := Routers[rtrCfg.ID]
-		rtrs = append(rtrs, APIV1Router{
+	rtrs := make([]apiv1.Router, 0)
+	for _, rtrCfg := range getConfig().Routers {
+		apiRtr := apiv1.Router{
 			ID:          rtrCfg.ID,
 			DisplayName: rtrCfg.DisplayName,
 			ShortName:   rtrCfg.ShortName,
-		})
+		}
+		rtr, rtr_ok := getRouter(rtrCfg.ID)
+		if rtr_ok {
+			apiRtr.Capabilities = rtr.GetCapabilities()
+			apiRtr.Status = rtr.GetStatus()
+		}
+		rtrs = append(rtrs, apiRtr)
 	}
 	rtrsBody, err := json.Marshal(rtrs)
 	if err != nil {
@@ -122,19 +283,87 @@ func (a *APIHandler) APIV1HandleRouters(w http.ResponseWriter, r *http.Request)
 	w.Write(rtrsBody)
 }
 
+func (a *APIHandler) APIV1HandleDrivers(w http.ResponseWriter, r *http.Request) {
+	driversBody, err := json.Marshal(router.Drivers())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(driversBody)
+}
+
+func (a *APIHandler) APIV1HandleCapabilities(w http.ResponseWriter, r *http.Request) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	router, router_ok := getRouter(routerID)
+	if !router_ok {
+		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
+		return
+	}
+	capsBody, err := json.Marshal(router.GetCapabilities())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(capsBody)
+}
+
+func (a *APIHandler) APIV1HandleStatus(w http.ResponseWriter, r *http.Request) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	router, router_ok := getRouter(routerID)
+	if !router_ok {
+		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
+		return
+	}
+	statusBody, err := json.Marshal(router.GetStatus())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(statusBody)
+}
+
 func (a *APIHandler) APIV1HandleDestinations(w http.ResponseWriter, r *http.Request) {
-	routerIDStr := r.PathValue("router_id")
-	routerID, err := strconv.Atoi(routerIDStr)
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	router, router_ok := Routers[routerID]
+	router, router_ok := getRouter(routerID)
 	if !router_ok {
 		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
 		return
 	}
-	dests := router.GetDestinations()
+	router, stale := withLastKnownState(routerID, router)
+	if stale {
+		w.Header().Set("X-BFC-Stale", "true")
+	}
+	router, err = withNameSet(routerID, withTags(routerID, router), r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	search, err := parseSearchQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dests, total, err := searchDestinations(router, search)
+	if err != nil {
+		http.Error(w, err.Error(), resolveStatus(err))
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	destsBody, err := json.Marshal(dests)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -145,39 +374,60 @@ func (a *APIHandler) APIV1HandleDestinations(w http.ResponseWriter, r *http.Requ
 }
 
 func (a *APIHandler) APIV1HandleSources(w http.ResponseWriter, r *http.Request) {
-	routerIDStr := r.PathValue("router_id")
-	routerID, err := strconv.Atoi(routerIDStr)
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	router, router_ok := Routers[routerID]
+	router, router_ok := getRouter(routerID)
 	if !router_ok {
 		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
 		return
 	}
-	dests := router.GetSources()
-	destsBody, err := json.Marshal(dests)
+	router, stale := withLastKnownState(routerID, router)
+	if stale {
+		w.Header().Set("X-BFC-Stale", "true")
+	}
+	router, err = withNameSet(routerID, withTags(routerID, router), r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	search, err := parseSearchQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srcs, total, err := searchSources(router, search)
+	if err != nil {
+		http.Error(w, err.Error(), resolveStatus(err))
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	srcsBody, err := json.Marshal(srcs)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(destsBody)
+	w.Write(srcsBody)
 }
 
 func (a *APIHandler) APIV1HandleLevels(w http.ResponseWriter, r *http.Request) {
-	routerIDStr := r.PathValue("router_id")
-	routerID, err := strconv.Atoi(routerIDStr)
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	router, router_ok := Routers[routerID]
+	router, router_ok := getRouter(routerID)
 	if !router_ok {
 		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
 		return
 	}
+	router, stale := withLastKnownState(routerID, router)
+	if stale {
+		w.Header().Set("X-BFC-Stale", "true")
+	}
 	dests := router.GetLevels()
 	destsBody, err := json.Marshal(dests)
 	if err != nil {
@@ -189,17 +439,35 @@ func (a *APIHandler) APIV1HandleLevels(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *APIHandler) APIV1HandleCrosspoints(w http.ResponseWriter, r *http.Request) {
-	routerIDStr := r.PathValue("router_id")
-	routerID, err := strconv.Atoi(routerIDStr)
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	router, router_ok := Routers[routerID]
+	router, router_ok := getRouter(routerID)
 	if !router_ok {
 		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
 		return
 	}
+	if atStr := r.URL.Query().Get("at"); atStr != "" {
+		at, err := time.Parse(time.RFC3339, atStr)
+		if err != nil {
+			http.Error(w, "Invalid at, expected an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		destsBody, err := json.Marshal(History.At(routerID, at))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(destsBody)
+		return
+	}
+	router, stale := withLastKnownState(routerID, router)
+	if stale {
+		w.Header().Set("X-BFC-Stale", "true")
+	}
 	dests := router.GetCrosspoints()
 	destsBody, err := json.Marshal(dests)
 	if err != nil {
@@ -210,33 +478,102 @@ func (a *APIHandler) APIV1HandleCrosspoints(w http.ResponseWriter, r *http.Reque
 	w.Write(destsBody)
 }
 
+func (a *APIHandler) APIV1HandleHistory(w http.ResponseWriter, r *http.Request) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	router, router_ok := getRouter(routerID)
+	if !router_ok {
+		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
+		return
+	}
+	router, _ = withLastKnownState(routerID, router)
+	named, err := withNameSet(routerID, router, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	to := time.Now()
+	if query.Get("to") != "" {
+		to, err = time.Parse(time.RFC3339, query.Get("to"))
+		if err != nil {
+			http.Error(w, "Invalid to, expected an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.Add(-24 * time.Hour)
+	if query.Get("from") != "" {
+		from, err = time.Parse(time.RFC3339, query.Get("from"))
+		if err != nil {
+			http.Error(w, "Invalid from, expected an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	destID := 0
+	if query.Get("destination") != "" {
+		destID, err = resolveDestinationID(apiv1.Ref(query.Get("destination")), named, router)
+		if err != nil {
+			http.Error(w, err.Error(), resolveStatus(err))
+			return
+		}
+	}
+	changes := History.Changes(routerID, destID, from, to)
+	response := make([]apiv1.HistoryEntry, 0, len(changes))
+	for _, change := range changes {
+		response = append(response, apiv1.HistoryEntry{
+			Time:            change.Time,
+			Crosspoint:      change.Crosspoint,
+			DestinationName: named.GetDestination(change.Crosspoint.Destination).Name,
+			SourceName:      named.GetSource(change.Crosspoint.Source).Name,
+		})
+	}
+	respBody, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(respBody)
+}
+
 func (a *APIHandler) APIV1HandleRouterTable(w http.ResponseWriter, r *http.Request) {
-	routerIDStr := r.PathValue("router_id")
-	routerID, err := strconv.Atoi(routerIDStr)
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	router, router_ok := Routers[routerID]
+	router, router_ok := getRouter(routerID)
 	if !router_ok {
 		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
 		return
 	}
+	router, stale := withLastKnownState(routerID, router)
+	if stale {
+		w.Header().Set("X-BFC-Stale", "true")
+	}
+	router, err = withNameSet(routerID, router, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	dests := router.GetDestinations()
 	crosspoints := router.GetCrosspoints()
-	response := make([]APIV1RouterTableLine, len(dests))
+	response := make([]apiv1.RouterTableLine, len(dests))
 	respDestMap := make(map[int]int)
 	for i, dest := range dests {
 		respDestMap[dest.ID] = i
-		response[i] = APIV1RouterTableLine{
+		response[i] = apiv1.RouterTableLine{
 			ID:                  dest.ID,
 			Name:                dest.Name,
-			Crosspoints:         make([]APIV1RouterTableCrosspoint, len(router.GetLevels())),
+			Crosspoints:         make([]apiv1.RouterTableCrosspoint, len(router.GetLevels())),
 			CrosspointsAsString: make([]string, len(router.GetLevels())),
 		}
 	}
 	for _, xpt := range crosspoints {
-		response[respDestMap[xpt.Destination]].Crosspoints[xpt.DestinationLevel-1] = APIV1RouterTableCrosspoint{
+		response[respDestMap[xpt.Destination]].Crosspoints[xpt.DestinationLevel-1] = apiv1.RouterTableCrosspoint{
 			DestinationLevelID: xpt.DestinationLevel,
 			SourceID:           xpt.Source,
 			SourceLevelID:      xpt.SourceLevel,
@@ -256,31 +593,39 @@ func (a *APIHandler) APIV1HandleRouterTable(w http.ResponseWriter, r *http.Reque
 }
 
 func (a *APIHandler) APIV1HandleRouterTableValidSources(w http.ResponseWriter, r *http.Request) {
-	routerIDStr := r.PathValue("router_id")
-	routerID, err := strconv.Atoi(routerIDStr)
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	router, router_ok := Routers[routerID]
+	router, router_ok := getRouter(routerID)
 	if !router_ok {
 		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
 		return
 	}
+	router, stale := withLastKnownState(routerID, router)
+	if stale {
+		w.Header().Set("X-BFC-Stale", "true")
+	}
+	router, err = withNameSet(routerID, router, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	sources := router.GetSources()
 	levels := router.GetLevels()
 	levelStrings := make([][]string, len(levels))
-	levelSources := make([][]APIV1RouterTableValidSource, len(levels))
+	levelSources := make([][]apiv1.RouterTableValidSource, len(levels))
 	for i := 0; i < len(levels); i++ {
 		levelStrings[i] = make([]string, 0)
-		levelSources[i] = make([]APIV1RouterTableValidSource, 0)
+		levelSources[i] = make([]apiv1.RouterTableValidSource, 0)
 	}
 
 	for _, src := range sources {
 		for _, lvl := range src.Levels {
 			srcNameStr := src.Name + "." + router.GetLevel(lvl).Name
 			levelStrings[lvl-1] = append(levelStrings[lvl-1], srcNameStr)
-			srcAPI := APIV1RouterTableValidSource{
+			srcAPI := apiv1.RouterTableValidSource{
 				SourceID:      src.ID,
 				SourceLevelID: lvl,
 			}
@@ -288,16 +633,10 @@ func (a *APIHandler) APIV1HandleRouterTableValidSources(w http.ResponseWriter, r
 		}
 	}
 
-	var routerConfig config.RouterConfig
-	for _, rtrCfg := range ConfigFile.Routers {
-		if rtrCfg.ID == routerID {
-			routerConfig = rtrCfg
-			break
-		}
-	}
+	routerConfig, _ := getRouterConfig(routerID)
 
-	response := APIV1RouterTableValidSources{
-		Sources:         make([][]APIV1RouterTableValidSource, len(levels)),
+	response := apiv1.RouterTableValidSources{
+		Sources:         make([][]apiv1.RouterTableValidSource, len(levels)),
 		SourcesAsString: make([][]string, len(levels)),
 	}
 
@@ -306,7 +645,7 @@ func (a *APIHandler) APIV1HandleRouterTableValidSources(w http.ResponseWriter, r
 		response.Sources[i] = levelSources[i]
 		altLevels := routerConfig.AlternateLevels[strconv.Itoa(i+1)]
 		for _, lvl := range altLevels {
-			if lvl-1 == i {
+			if lvl-1 == i || lvl < 1 || lvl > len(levels) {
 				continue
 			}
 			response.SourcesAsString[i] = append(response.SourcesAsString[i], levelStrings[lvl-1]...)
@@ -324,68 +663,217 @@ func (a *APIHandler) APIV1HandleRouterTableValidSources(w http.ResponseWriter, r
 }
 
 func (a *APIHandler) APIV1HandleCrosspointsPut(w http.ResponseWriter, r *http.Request) {
-	routerIDStr := r.PathValue("router_id")
-	routerID, err := strconv.Atoi(routerIDStr)
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	router, router_ok := Routers[routerID]
+	router, router_ok := getRouter(routerID)
 	if !router_ok {
 		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
 		return
 	}
-	body := make(map[string]int)
+	body := apiv1.CrosspointRequest{}
 	err = json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
 		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	destID, destID_ok := body["destination_id"]
-	destLevelID, destLevelID_ok := body["destination_level_id"]
-	srcID, srcID_ok := body["source_id"]
-	srcLevelID, srcLevelID_ok := body["source_level_id"]
-	if !destID_ok || !destLevelID_ok || !srcID_ok || !srcLevelID_ok {
-		http.Error(w, "Error parsing body ", http.StatusBadRequest)
+	// Names in the request's name set take priority over the router's own names
+	named, err := withNameSet(routerID, router, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	err = router.SetCrosspoint(destID, destLevelID, srcID, srcLevelID)
+	body, err = resolveCrosspointRequest(body, named, router)
+	if err != nil {
+		http.Error(w, err.Error(), resolveStatus(err))
+		return
+	}
+	if !router.GetCapabilities().Breakaway && (body.DestinationLevelID != -1 || body.SourceLevelID != -1) {
+		http.Error(w, "Router is follow only, use -1 for destination_level_id and source_level_id", http.StatusBadRequest)
+		return
+	}
+	err = checkBooking(routerID, body.DestinationID, requestUser(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	previous := capturePrevious(routerID, router, body.DestinationID, body.DestinationLevelID, body.SourceID, body.SourceLevelID)
+	err = setCrosspoint(routerID, router, body.DestinationID, body.DestinationLevelID, body.SourceID, body.SourceLevelID)
+	description := fmt.Sprintf("Route %s to %s", named.GetSource(body.SourceID).Name, named.GetDestination(body.DestinationID).Name)
+	recordAudit(requestUser(r), apiv1.AuditRoute, description, errorStrings(err))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	recordUndo(requestUser(r), description, previous)
 }
 
 func (a *APIHandler) APIV1HandleCrosspointsLockPut(w http.ResponseWriter, r *http.Request) {
-	routerIDStr := r.PathValue("router_id")
-	routerID, err := strconv.Atoi(routerIDStr)
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	router, router_ok := Routers[routerID]
+	router, router_ok := getRouter(routerID)
 	if !router_ok {
 		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
 		return
 	}
-	body := struct {
-		DestID    int  `json:"destination_id"`
-		DestLvlID int  `json:"destination_level_id"`
-		Locked    bool `json:"locked"`
-	}{}
+	body := apiv1.CrosspointLockRequest{}
 	err = json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
 		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !router.GetCapabilities().Lock {
+		http.Error(w, "Router does not support locks", http.StatusNotImplemented)
+		return
+	}
+	named, err := withNameSet(routerID, router, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	body, err = resolveLockRequest(body, named, router)
+	if err != nil {
+		http.Error(w, err.Error(), resolveStatus(err))
+		return
+	}
+	err = checkBooking(routerID, body.DestinationID, requestUser(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if body.Locked {
-		err = router.LockDestination(body.DestID, body.DestLvlID)
+		err = router.LockDestination(body.DestinationID, body.DestinationLevelID)
+		recordAudit(requestUser(r), apiv1.AuditLock, "Lock "+named.GetDestination(body.DestinationID).Name, errorStrings(err))
 	} else if !body.Locked {
-		err = router.UnlockDestination(body.DestID, body.DestLvlID)
+		err = router.UnlockDestination(body.DestinationID, body.DestinationLevelID)
+		recordAudit(requestUser(r), apiv1.AuditUnlock, "Unlock "+named.GetDestination(body.DestinationID).Name, errorStrings(err))
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *APIHandler) APIV1HandleMultiviewerLayoutPost(w http.ResponseWriter, r *http.Request) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	router, router_ok := getRouter(routerID)
+	if !router_ok {
+		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
+		return
+	}
+	router, stale := withLastKnownState(routerID, router)
+	if stale {
+		w.Header().Set("X-BFC-Stale", "true")
+	}
+	router, err = withNameSet(routerID, router, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	// Fields left out of the template keep their defaults
+	template := neuronview.DefaultLayoutTemplate()
+	body := apiv1.MultiviewerLayoutRequest{Template: &template}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
+		return
 	}
 
+	// Use every destination on the router unless a subset was requested
+	dests := router.GetDestinations()
+	if body.DestinationIDs != nil {
+		dests = nil
+		for _, destID := range body.DestinationIDs {
+			dest := router.GetDestination(destID)
+			if dest.ID != destID {
+				http.Error(w, fmt.Sprintf("Destination ID (%d) not found", destID), http.StatusNotFound)
+				return
+			}
+			dests = append(dests, dest)
+		}
+	}
+
+	layout, err := neuronview.GenerateLayout(template, dests, body.Streams)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	respBody, err := json.Marshal(layout)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(respBody)
+}
+
+func (a *APIHandler) APIV1HandleMultiviewerStreamsSDPPost(w http.ResponseWriter, r *http.Request) {
+	body := apiv1.MultiviewerStreamsSDPRequest{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var registry *neuronview.NMOSRegistry
+	if registryURL := getConfig().NMOSRegistryURL; registryURL != "" {
+		registry = neuronview.NewNMOSRegistry(registryURL)
+	}
+
+	// Explicit SDPs take priority, then SDPs already on the stream, then the NMOS registry
+	card := neuronview.Card{Streams: body.Streams}
+	response := apiv1.MultiviewerStreamsSDPResponse{
+		Errors: make(map[string]string),
+	}
+	for _, stream := range body.Streams {
+		sdp, sdp_ok := body.SDPs[stream.UUID]
+		if !sdp_ok {
+			sdp = stream.SDP
+		}
+		switch {
+		case sdp != "":
+			err = card.AssignSDP(stream.UUID, sdp)
+		case stream.NMOSLabel != "" && registry != nil:
+			err = card.AssignSDPFromNMOS(r.Context(), registry, stream.UUID)
+		default:
+			err = nil
+		}
+		if err != nil {
+			response.Errors[stream.UUID] = err.Error()
+		}
+	}
+	response.Streams = card.Streams
+
+	respBody, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(respBody)
+}
+
+func (a *APIHandler) APIV1HandleAdminReloadPost(w http.ResponseWriter, r *http.Request) {
+	result, err := reloadConfig()
+	recordAudit(requestUser(r), apiv1.AuditReload, "Reload config", errorStrings(err))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	respBody, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(respBody)
 }
@@ -0,0 +1,350 @@
+// Package apiv1 holds the request and response types of the /api/v1 HTTP API,
+// shared by the server and the client package.
+package apiv1
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cassaram/bfc/backend/config"
+	"github.com/cassaram/bfc/backend/neuronview"
+	"github.com/cassaram/bfc/backend/router"
+)
+
+type Router struct {
+	ID           int                 `json:"id"`
+	DisplayName  string              `json:"display_name"`
+	ShortName    string              `json:"short_name"`
+	Capabilities router.Capabilities `json:"capabilities"`
+	Status       router.Status       `json:"status"`
+}
+
+type RouterTableCrosspoint struct {
+	DestinationLevelID int  `json:"destination_level_id"`
+	SourceID           int  `json:"source_id"`
+	SourceLevelID      int  `json:"source_level_id"`
+	Locked             bool `json:"locked"`
+}
+
+type RouterTableLine struct {
+	ID                  int                     `json:"id"`
+	Name                string                  `json:"name"`
+	Crosspoints         []RouterTableCrosspoint `json:"crosspoints"`
+	CrosspointsAsString []string                `json:"crosspoints_as_string"`
+}
+
+type RouterTableValidSource struct {
+	SourceID      int `json:"source_id"`
+	SourceLevelID int `json:"source_level_id"`
+}
+
+type RouterTableValidSources struct {
+	Sources         [][]RouterTableValidSource `json:"sources"`
+	SourcesAsString [][]string                 `json:"sources_as_string"`
+}
+
+// CrosspointRequest routes a source to a destination. Use -1 for both levels to route all levels.
+// Destination, Source and the level refs take a name or ID and are used instead of the IDs when set.
+// Level routes the same level on both sides, as does a level given for only one side.
+// Without any level all levels are routed.
+type CrosspointRequest struct {
+	DestinationID      int `json:"destination_id,omitempty"`
+	DestinationLevelID int `json:"destination_level_id"`
+	SourceID           int `json:"source_id,omitempty"`
+	SourceLevelID      int `json:"source_level_id"`
+	Destination        Ref `json:"destination,omitempty"`
+	Source             Ref `json:"source,omitempty"`
+	Level              Ref `json:"level,omitempty"`
+	DestinationLevel   Ref `json:"destination_level,omitempty"`
+	SourceLevel        Ref `json:"source_level,omitempty"`
+}
+
+// CrosspointLockRequest locks a destination. Use -1 or omit the level to lock all levels.
+type CrosspointLockRequest struct {
+	DestinationID      int  `json:"destination_id,omitempty"`
+	DestinationLevelID int  `json:"destination_level_id,omitempty"`
+	Destination        Ref  `json:"destination,omitempty"`
+	Level              Ref  `json:"level,omitempty"`
+	Locked             bool `json:"locked"`
+}
+
+// MappedCrosspointRequest routes a source to a destination with one of the router's level mapping presets.
+// Destination and Source take a name or ID and are used instead of the IDs when set.
+type MappedCrosspointRequest struct {
+	DestinationID int    `json:"destination_id,omitempty"`
+	SourceID      int    `json:"source_id,omitempty"`
+	Destination   Ref    `json:"destination,omitempty"`
+	Source        Ref    `json:"source,omitempty"`
+	Mapping       string `json:"mapping"`
+}
+
+// LevelMapping is a level mapping preset from the router's config
+type LevelMapping struct {
+	Name   string            `json:"name"`
+	Levels []config.LevelMap `json:"levels"`
+}
+
+type MultiviewerLayoutRequest struct {
+	Template       *neuronview.LayoutTemplate `json:"template"` // Fields left out keep their default values
+	DestinationIDs []int                      `json:"destination_ids"`
+	Streams        []neuronview.InputStream   `json:"streams"`
+}
+
+type MultiviewerStreamsSDPRequest struct {
+	Streams []neuronview.InputStream `json:"streams"`
+	SDPs    map[string]string        `json:"sdps"` // Stream UUID -> SDP
+}
+
+type MultiviewerStreamsSDPResponse struct {
+	Streams []neuronview.InputStream `json:"streams"`
+	Errors  map[string]string        `json:"errors"` // Stream UUID -> Error
+}
+
+type ReloadResult struct {
+	Added     []int `json:"added"`
+	Removed   []int `json:"removed"`
+	Restarted []int `json:"restarted"`
+	// Changed settings which keep their running values until BFC is restarted
+	RestartRequired []string `json:"restart_required"`
+}
+
+// Websocket event types
+const (
+	EventCrosspoint   = "crosspoint"
+	EventRouterStatus = "router_status"
+)
+
+// Event is a websocket message when connected with ?format=events
+type Event struct {
+	Type       string             `json:"type"`
+	RouterID   int                `json:"router_id"`
+	Crosspoint *router.Crosspoint `json:"crosspoint,omitempty"`
+	// Names of the crosspoint's destination and source in the client's name set
+	DestinationName string         `json:"destination_name,omitempty"`
+	SourceName      string         `json:"source_name,omitempty"`
+	Status          *router.Status `json:"status,omitempty"`
+}
+
+type SalvoCrosspoint struct {
+	RouterID int `json:"router_id"`
+	CrosspointRequest
+}
+
+// Salvo is a named set of crosspoints, possibly on several routers, routed together
+type Salvo struct {
+	Name        string            `json:"name"`
+	Crosspoints []SalvoCrosspoint `json:"crosspoints"`
+}
+
+type SalvoFireResult struct {
+	Routed int      `json:"routed"`
+	Errors []string `json:"errors"`
+}
+
+// Ref is a name or a numeric ID, given as a JSON string or number
+type Ref string
+
+func (r *Ref) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var str string
+		err := json.Unmarshal(data, &str)
+		*r = Ref(str)
+		return err
+	}
+	var num json.Number
+	err := json.Unmarshal(data, &num)
+	if err != nil {
+		return err
+	}
+	_, err = num.Int64()
+	if err != nil {
+		return fmt.Errorf("ID must be an integer, got %s", num)
+	}
+	*r = Ref(num.String())
+	return nil
+}
+
+// NameSet gives a router's sources and destinations alternative display names.
+// IDs not in the set keep the router's name.
+type NameSet struct {
+	Name         string         `json:"name"`
+	Sources      map[int]string `json:"sources"`
+	Destinations map[int]string `json:"destinations"`
+}
+
+type UserPreferences struct {
+	NameSet string `json:"nameset"` // Name set used when a request doesn't ask for one
+}
+
+type User struct {
+	Name        string          `json:"name"` // Empty if the request didn't identify a user
+	Preferences UserPreferences `json:"preferences"`
+}
+
+// RouterTags are the tags added to a router's sources and destinations through the API,
+// on top of the tags from the config's tag rules
+type RouterTags struct {
+	Sources      map[int][]string `json:"sources"`
+	Destinations map[int][]string `json:"destinations"`
+}
+
+// PanelDestination is one row of a panel. Destination and Sources take names or IDs
+// and are saved as DestinationID and SourceIDs.
+type PanelDestination struct {
+	RouterID      int   `json:"router_id"`
+	DestinationID int   `json:"destination_id,omitempty"`
+	SourceIDs     []int `json:"source_ids,omitempty"` // Preferred sources, empty for all sources
+	Destination   Ref   `json:"destination,omitempty"`
+	Sources       []Ref `json:"sources,omitempty"`
+}
+
+// Panel is a user's ordered list of destinations, across routers
+type Panel struct {
+	Name         string             `json:"name"`
+	Destinations []PanelDestination `json:"destinations"`
+}
+
+type PanelSource struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// PanelRow is a panel destination with its current crosspoints
+type PanelRow struct {
+	RouterID            int                     `json:"router_id"`
+	DestinationID       int                     `json:"destination_id"`
+	Name                string                  `json:"name"`
+	Crosspoints         []RouterTableCrosspoint `json:"crosspoints"`
+	CrosspointsAsString []string                `json:"crosspoints_as_string"`
+	Sources             []PanelSource           `json:"sources"` // Preferred sources, empty for all sources
+	Stale               bool                    `json:"stale"`
+	Error               string                  `json:"error,omitempty"` // Set if the router is gone
+}
+
+// PanelState is a panel with the current state of its destinations
+type PanelState struct {
+	Name string     `json:"name"`
+	Rows []PanelRow `json:"rows"`
+}
+
+// Missed run policies, for runs due while BFC wasn't running
+const (
+	MissedRunSkip    = "skip"     // Record the missed runs without routing
+	MissedRunRunOnce = "run_once" // Run once when BFC starts, however many runs were missed
+)
+
+// Job routes a salvo or crosspoints once At, or repeatedly following Cron
+type Job struct {
+	Name        string            `json:"name"`
+	At          *time.Time        `json:"at,omitempty"`
+	Cron        string            `json:"cron,omitempty"`     // 5 fields, or 6 with seconds first
+	Timezone    string            `json:"timezone,omitempty"` // IANA name the cron expression is read in, defaults to the server's
+	MissedRuns  string            `json:"missed_runs,omitempty"`
+	Disabled    bool              `json:"disabled"`
+	Salvo       string            `json:"salvo,omitempty"`
+	Crosspoints []SalvoCrosspoint `json:"crosspoints,omitempty"`
+	Created     time.Time         `json:"created"`              // Set by the server
+	CreatedBy   string            `json:"created_by,omitempty"` // Set by the server, the job routes as this user
+	LastRun     *time.Time        `json:"last_run,omitempty"`   // Scheduled time of the last run, set by the server
+	NextRun     *time.Time        `json:"next_run,omitempty"`   // Set by the server
+}
+
+// JobResult records one scheduled run of a job
+type JobResult struct {
+	Job       string    `json:"job"`
+	Scheduled time.Time `json:"scheduled"`
+	Ran       time.Time `json:"ran"`
+	Missed    bool      `json:"missed"`  // BFC wasn't running at the scheduled time
+	Skipped   bool      `json:"skipped"` // Not run because of the missed run policy
+	Routed    int       `json:"routed"`
+	Errors    []string  `json:"errors"`
+}
+
+// ScheduledRun is an upcoming run of a job
+type ScheduledRun struct {
+	Job string    `json:"job"`
+	At  time.Time `json:"at"`
+}
+
+// BookingDestination is a destination reserved by a booking. Destination, Source and
+// ReleaseSource take names or IDs and are saved as IDs.
+type BookingDestination struct {
+	RouterID        int `json:"router_id"`
+	DestinationID   int `json:"destination_id,omitempty"`
+	SourceID        int `json:"source_id,omitempty"`         // Routed when the booking starts, optional
+	ReleaseSourceID int `json:"release_source_id,omitempty"` // Routed when the booking ends, optional
+	Destination     Ref `json:"destination,omitempty"`
+	Source          Ref `json:"source,omitempty"`
+	ReleaseSource   Ref `json:"release_source,omitempty"`
+}
+
+// Booking reserves destinations for an owner between Start and End.
+// While a booking is active only its owner can route or lock its destinations.
+type Booking struct {
+	Name         string               `json:"name"`
+	Owner        string               `json:"owner"` // Set by the server to the requesting user
+	Start        time.Time            `json:"start"`
+	End          time.Time            `json:"end"`
+	Priority     int                  `json:"priority"` // Displaces conflicting bookings of lower priority which haven't started
+	Destinations []BookingDestination `json:"destinations"`
+	Started      bool                 `json:"started"`                // Set by the server once the start sources are routed
+	Ended        bool                 `json:"ended"`                  // Set by the server once the release sources are routed, or when displaced
+	DisplacedBy  string               `json:"displaced_by,omitempty"` // Set by the server to the booking which displaced this one
+	Errors       []string             `json:"errors"`                 // Routing errors at the start and end, set by the server
+}
+
+// HistoryEntry is a crosspoint change, with the names the destination and source have now
+type HistoryEntry struct {
+	Time time.Time `json:"time"`
+	router.Crosspoint
+	DestinationName string `json:"destination_name"`
+	SourceName      string `json:"source_name"`
+}
+
+// UndoCrosspoint is a crosspoint level changed by an operation
+type UndoCrosspoint struct {
+	RouterID int               `json:"router_id"`
+	Previous router.Crosspoint `json:"previous"`
+	Routed   router.Crosspoint `json:"routed"`
+}
+
+// UndoOperation is a route or salvo which can be undone by routing the previous crosspoints again
+type UndoOperation struct {
+	Description string           `json:"description"`
+	Time        time.Time        `json:"time"`
+	Crosspoints []UndoCrosspoint `json:"crosspoints"`
+}
+
+// Snapshot is the crosspoints of one or more routers saved at a point in time. It is restored like a salvo.
+type Snapshot struct {
+	Name        string            `json:"name"`
+	Created     time.Time         `json:"created"`
+	CreatedBy   string            `json:"created_by,omitempty"`
+	Crosspoints []SalvoCrosspoint `json:"crosspoints"`
+}
+
+// SnapshotRequest picks the routers to save. Every router is saved if none are given.
+type SnapshotRequest struct {
+	RouterIDs []int `json:"router_ids"`
+}
+
+// Audit record actions
+const (
+	AuditRoute    = "route"
+	AuditLock     = "lock"
+	AuditUnlock   = "unlock"
+	AuditSalvo    = "salvo"
+	AuditSnapshot = "snapshot"
+	AuditUndo     = "undo"
+	AuditReload   = "reload"
+)
+
+// AuditRecord is a change made through BFC
+type AuditRecord struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"` // Empty for anonymous requests
+	Action      string    `json:"action"`
+	Description string    `json:"description"`
+	Errors      []string  `json:"errors,omitempty"`
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/store"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	auditLimit      = 10000 // Older records are deleted
+	auditPruneEvery = 100   // Records written between prunes
+)
+
+var auditMutex sync.Mutex
+var auditSeq uint64
+
+// recordAudit stores a change made by a user. Errors are the parts of the change which failed.
+func recordAudit(user string, action string, description string, errs []string) {
+	record := apiv1.AuditRecord{
+		Time:        time.Now(),
+		User:        user,
+		Action:      action,
+		Description: description,
+		Errors:      errs,
+	}
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	auditSeq++
+	err := Store.Put(store.BucketAudit, store.AuditKey(record.Time, auditSeq), record)
+	if err != nil {
+		log.Error("Audit: ", err.Error())
+		return
+	}
+	if auditSeq%auditPruneEvery == 0 {
+		pruneAudit()
+	}
+}
+
+// pruneAudit deletes the oldest records beyond auditLimit. Callers hold auditMutex.
+func pruneAudit() {
+	keys, err := Store.Keys(store.BucketAudit)
+	if err != nil {
+		log.Error("Audit: ", err.Error())
+		return
+	}
+	for len(keys) > auditLimit {
+		err = Store.Delete(store.BucketAudit, keys[0])
+		if err != nil {
+			log.Error("Audit: ", err.Error())
+			return
+		}
+		keys = keys[1:]
+	}
+}
+
+// errorStrings returns the messages of errors, nil if there are none
+func errorStrings(err error) []string {
+	if err == nil {
+		return nil
+	}
+	return []string{err.Error()}
+}
+
+func (a *APIHandler) APIV1HandleAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var err error
+	to := time.Now()
+	if query.Get("to") != "" {
+		to, err = time.Parse(time.RFC3339, query.Get("to"))
+		if err != nil {
+			http.Error(w, "Invalid to, expected an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.Add(-24 * time.Hour)
+	if query.Get("from") != "" {
+		from, err = time.Parse(time.RFC3339, query.Get("from"))
+		if err != nil {
+			http.Error(w, "Invalid from, expected an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 0
+	if query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	user := query.Get("user")
+	action := query.Get("action")
+
+	keys, err := Store.Keys(store.BucketAudit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Keys sort in time order, so only the range between from and to is read
+	fromKey := store.AuditKey(from, 0)
+	toKey := store.AuditKey(to.Add(time.Nanosecond), 0)
+	records := make([]apiv1.AuditRecord, 0)
+	for _, key := range keys {
+		if key < fromKey || key >= toKey {
+			continue
+		}
+		record := apiv1.AuditRecord{}
+		err = Store.Get(store.BucketAudit, key, &record)
+		if err != nil {
+			continue
+		}
+		if (user != "" && record.User != user) || (action != "" && record.Action != action) {
+			continue
+		}
+		records = append(records, record)
+	}
+	// The limit keeps the newest records
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	recordsBody, err := json.Marshal(records)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(recordsBody)
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/router"
+	"github.com/cassaram/bfc/backend/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// bookingsMutex guards reading and writing bookings
+var bookingsMutex sync.Mutex
+
+// Ended bookings are deleted after this long
+const bookingsKeptFor = 30 * 24 * time.Hour
+
+func getBooking(name string) (apiv1.Booking, error) {
+	booking := apiv1.Booking{}
+	err := Store.Get(store.BucketBookings, name, &booking)
+	return booking, err
+}
+
+func getBookings() ([]apiv1.Booking, error) {
+	names, err := Store.Keys(store.BucketBookings)
+	if err != nil {
+		return nil, err
+	}
+	bookings := make([]apiv1.Booking, 0, len(names))
+	for _, name := range names {
+		booking, err := getBooking(name)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, booking)
+	}
+	return bookings, nil
+}
+
+func bookingActive(booking apiv1.Booking, now time.Time) bool {
+	return !now.Before(booking.Start) && now.Before(booking.End)
+}
+
+func bookingHasDestination(booking apiv1.Booking, routerID int, destID int) bool {
+	for _, bd := range booking.Destinations {
+		if bd.RouterID == routerID && bd.DestinationID == destID {
+			return true
+		}
+	}
+	return false
+}
+
+// bookingsConflict reports whether two bookings overlap in time and share a destination
+func bookingsConflict(a apiv1.Booking, b apiv1.Booking) bool {
+	if !a.Start.Before(b.End) || !b.Start.Before(a.End) {
+		return false
+	}
+	for _, bd := range a.Destinations {
+		if bookingHasDestination(b, bd.RouterID, bd.DestinationID) {
+			return true
+		}
+	}
+	return false
+}
+
+// bookedError is returned when a destination is booked by another user
+type bookedError struct {
+	booking       apiv1.Booking
+	destinationID int
+}
+
+func (e *bookedError) Error() string {
+	return fmt.Sprintf("Destination %d is booked by %s until %s (%s)", e.destinationID, e.booking.Owner, e.booking.End.Format(time.RFC3339), e.booking.Name)
+}
+
+// checkBooking returns a *bookedError if a destination is in an active booking the user doesn't own
+func checkBooking(routerID int, destID int, user string) error {
+	bookings, err := getBookings()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, booking := range bookings {
+		if !booking.Ended && bookingActive(booking, now) && bookingHasDestination(booking, routerID, destID) && booking.Owner != user {
+			return &bookedError{booking: booking, destinationID: destID}
+		}
+	}
+	return nil
+}
+
+// resolveBookingDestination fills in the IDs of a booked destination from its names or IDs
+func resolveBookingDestination(bd apiv1.BookingDestination, r *http.Request) (apiv1.BookingDestination, error) {
+	rtrs, err := resolveViews(bd.RouterID, r)
+	if err != nil {
+		return bd, err
+	}
+	if bd.Destination != "" {
+		dest, err := resolveIn(rtrs, bd.Destination, router.ResolveDestination)
+		if err != nil {
+			return bd, err
+		}
+		bd.DestinationID = dest.ID
+	}
+	if bd.DestinationID == 0 {
+		return bd, errors.New("destination is required")
+	}
+	if bd.Source != "" {
+		src, err := resolveIn(rtrs, bd.Source, router.ResolveSource)
+		if err != nil {
+			return bd, err
+		}
+		bd.SourceID = src.ID
+	}
+	if bd.ReleaseSource != "" {
+		src, err := resolveIn(rtrs, bd.ReleaseSource, router.ResolveSource)
+		if err != nil {
+			return bd, err
+		}
+		bd.ReleaseSourceID = src.ID
+	}
+	bd.Destination = ""
+	bd.Source = ""
+	bd.ReleaseSource = ""
+	return bd, nil
+}
+
+// routeBooking routes the start or release sources of a booking on all levels, audited as its owner
+func routeBooking(booking apiv1.Booking, release bool) []string {
+	description := "Start booking " + booking.Name
+	if release {
+		description = "Release booking " + booking.Name
+	}
+	errs := make([]string, 0)
+	routed := false
+	for _, bd := range booking.Destinations {
+		srcID := bd.SourceID
+		if release {
+			srcID = bd.ReleaseSourceID
+		}
+		if srcID == 0 {
+			continue
+		}
+		rtr, rtr_ok := getRouter(bd.RouterID)
+		if !rtr_ok {
+			errs = append(errs, fmt.Sprintf("Router ID (%d) not found", bd.RouterID))
+			continue
+		}
+		routed = true
+		err := setCrosspoint(bd.RouterID, rtr, bd.DestinationID, -1, srcID, -1)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Router %d: destination %d: %s", bd.RouterID, bd.DestinationID, err.Error()))
+		}
+	}
+	if routed || len(errs) > 0 {
+		recordAudit(booking.Owner, apiv1.AuditRoute, description, errs)
+	}
+	return errs
+}
+
+// runDueBookings routes bookings which started or ended, and deletes old bookings
+func runDueBookings(now time.Time) {
+	bookingsMutex.Lock()
+	bookings, err := getBookings()
+	if err != nil {
+		bookingsMutex.Unlock()
+		log.Error("Bookings: ", err.Error())
+		return
+	}
+	starting := make([]apiv1.Booking, 0)
+	ending := make([]apiv1.Booking, 0)
+	for _, booking := range bookings {
+		switch {
+		case booking.Ended && now.Sub(booking.End) > bookingsKeptFor:
+			Store.Delete(store.BucketBookings, booking.Name)
+			continue
+		case !booking.Ended && !now.Before(booking.End):
+			// A booking which ended while BFC wasn't running is only released
+			booking.Started = true
+			booking.Ended = true
+			ending = append(ending, booking)
+		case !booking.Started && bookingActive(booking, now):
+			booking.Started = true
+			starting = append(starting, booking)
+		default:
+			continue
+		}
+		err = Store.Put(store.BucketBookings, booking.Name, booking)
+		if err != nil {
+			log.Errorf("Booking %s: %s", booking.Name, err.Error())
+		}
+	}
+	bookingsMutex.Unlock()
+
+	for _, booking := range starting {
+		log.Infof("Booking %s: Starting for %s", booking.Name, booking.Owner)
+		recordBookingErrors(booking.Name, routeBooking(booking, false))
+	}
+	for _, booking := range ending {
+		log.Infof("Booking %s: Ended", booking.Name)
+		recordBookingErrors(booking.Name, routeBooking(booking, true))
+	}
+}
+
+func recordBookingErrors(name string, errs []string) {
+	if len(errs) == 0 {
+		return
+	}
+	for _, msg := range errs {
+		log.Warnf("Booking %s: %s", name, msg)
+	}
+	bookingsMutex.Lock()
+	defer bookingsMutex.Unlock()
+	booking, err := getBooking(name)
+	if err != nil {
+		return
+	}
+	booking.Errors = append(booking.Errors, errs...)
+	Store.Put(store.BucketBookings, name, booking)
+}
+
+// runBookings starts and ends bookings every interval until ctx is done
+func runBookings(ctx context.Context, interval time.Duration) {
+	for {
+		runDueBookings(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (a *APIHandler) APIV1HandleBookings(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from := time.Now()
+	to := from.Add(7 * 24 * time.Hour)
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if query.Get(name) == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, query.Get(name))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s, expected an RFC 3339 time", name), http.StatusBadRequest)
+			return
+		}
+		*dst = t
+	}
+	routerID := 0
+	destID := 0
+	if query.Get("router") != "" {
+		var err error
+		routerID, err = resolveRouterID(query.Get("router"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if query.Get("destination") != "" {
+			rtrs, err := resolveViews(routerID, r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			destID, err = resolveDestinationID(apiv1.Ref(query.Get("destination")), rtrs...)
+			if err != nil {
+				http.Error(w, err.Error(), resolveStatus(err))
+				return
+			}
+		}
+	}
+	bookings, err := getBookings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	timeline := make([]apiv1.Booking, 0)
+	for _, booking := range bookings {
+		if !booking.Start.Before(to) || !from.Before(booking.End) {
+			continue
+		}
+		if routerID != 0 && !slices.ContainsFunc(booking.Destinations, func(bd apiv1.BookingDestination) bool {
+			return bd.RouterID == routerID && (destID == 0 || bd.DestinationID == destID)
+		}) {
+			continue
+		}
+		timeline = append(timeline, booking)
+	}
+	slices.SortFunc(timeline, func(a apiv1.Booking, b apiv1.Booking) int {
+		return cmp.Or(a.Start.Compare(b.Start), cmp.Compare(a.Name, b.Name))
+	})
+	timelineBody, err := json.Marshal(timeline)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(timelineBody)
+}
+
+func (a *APIHandler) APIV1HandleBooking(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	booking, err := getBooking(name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Booking (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bookingBody, err := json.Marshal(booking)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bookingBody)
+}
+
+func (a *APIHandler) APIV1HandleBookingPut(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	body := apiv1.Booking{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	body.Name = r.PathValue("name")
+	body.Owner = user
+	if body.Owner == "" {
+		http.Error(w, "Booking has no owner, "+errNoUser.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	if !body.End.After(body.Start) {
+		http.Error(w, "Booking end must be after start", http.StatusBadRequest)
+		return
+	}
+	if !body.End.After(now) {
+		http.Error(w, "Booking end is in the past", http.StatusBadRequest)
+		return
+	}
+	if len(body.Destinations) == 0 {
+		http.Error(w, "Booking has no destinations", http.StatusBadRequest)
+		return
+	}
+	for i, bd := range body.Destinations {
+		body.Destinations[i], err = resolveBookingDestination(bd, r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Destination %d: %s", i+1, err.Error()), resolveStatus(err))
+			return
+		}
+	}
+	body.Started = false
+	body.Ended = false
+	body.DisplacedBy = ""
+	body.Errors = make([]string, 0)
+
+	bookingsMutex.Lock()
+	defer bookingsMutex.Unlock()
+	existing, err := getBooking(body.Name)
+	if err == nil {
+		if existing.Owner != user {
+			http.Error(w, fmt.Sprintf("Booking (%s) is owned by %s", body.Name, existing.Owner), http.StatusForbidden)
+			return
+		}
+		// Don't route the start sources again when changing a running booking
+		body.Started = existing.Started && !existing.Ended && !body.Start.After(now)
+	}
+	bookings, err := getBookings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	conflicts := make([]string, 0)
+	displaced := make([]apiv1.Booking, 0)
+	for _, other := range bookings {
+		if other.Name == body.Name || other.Ended || !bookingsConflict(body, other) {
+			continue
+		}
+		if body.Priority > other.Priority && !other.Started && now.Before(other.Start) {
+			displaced = append(displaced, other)
+			continue
+		}
+		conflicts = append(conflicts, fmt.Sprintf("%s (%s, priority %d)", other.Name, other.Owner, other.Priority))
+	}
+	if len(conflicts) > 0 {
+		http.Error(w, "Booking conflicts with "+strings.Join(conflicts, ", "), http.StatusConflict)
+		return
+	}
+	for _, other := range displaced {
+		// Displaced bookings are kept as ended so their owners can see what happened
+		other.Ended = true
+		other.DisplacedBy = body.Name
+		err = Store.Put(store.BucketBookings, other.Name, other)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Infof("Booking %s: Displaced by %s", other.Name, body.Name)
+	}
+	err = Store.Put(store.BucketBookings, body.Name, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bookingBody, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bookingBody)
+}
+
+func (a *APIHandler) APIV1HandleBookingDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	bookingsMutex.Lock()
+	booking, err := getBooking(name)
+	if errors.Is(err, store.ErrNotFound) {
+		bookingsMutex.Unlock()
+		http.Error(w, fmt.Sprintf("Booking (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		bookingsMutex.Unlock()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if booking.Owner != requestUser(r) {
+		bookingsMutex.Unlock()
+		http.Error(w, fmt.Sprintf("Booking (%s) is owned by %s", name, booking.Owner), http.StatusForbidden)
+		return
+	}
+	if !booking.Started || booking.Ended {
+		err = Store.Delete(store.BucketBookings, name)
+		bookingsMutex.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	// A running booking is ended now, so its destinations are released
+	booking.End = time.Now()
+	booking.Ended = true
+	err = Store.Put(store.BucketBookings, name, booking)
+	bookingsMutex.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Infof("Booking %s: Ended early by %s", booking.Name, booking.Owner)
+	recordBookingErrors(booking.Name, routeBooking(booking, true))
+}
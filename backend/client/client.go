@@ -0,0 +1,526 @@
+// Package client is a Go client for the BFC /api/v1 HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/neuronview"
+	"github.com/cassaram/bfc/backend/router"
+)
+
+type Client struct {
+	URL    string // Base URL of the server, without /api/v1
+	Client *http.Client
+	Header http.Header // Sent with every request, e.g. for authentication
+	// Name set to show names from, sent with every request if not empty
+	UseNameSet string
+}
+
+// Error is returned when the server responds with an error status
+type Error struct {
+	StatusCode int
+	Method     string
+	Path       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		URL:    strings.TrimRight(baseURL, "/"),
+		Client: &http.Client{Timeout: 10 * time.Second},
+		Header: make(http.Header),
+	}
+}
+
+// do sends a request to an /api/v1 path, encoding in as JSON if not nil and decoding the response into out if not nil
+func (c *Client) do(ctx context.Context, method string, path string, in any, out any) error {
+	_, err := c.doQuery(ctx, method, path, nil, in, out)
+	return err
+}
+
+// doQuery is do with query parameters, returning the response headers
+func (c *Client) doQuery(ctx context.Context, method string, path string, query url.Values, in any, out any) (http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		inBytes, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(inBytes)
+	}
+	if query == nil {
+		query = make(url.Values)
+	}
+	if c.UseNameSet != "" {
+		query.Set("nameset", c.UseNameSet)
+	}
+	reqURL := c.URL + "/api/v1" + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.Header {
+		req.Header[key] = values
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return resp.Header, &Error{StatusCode: resp.StatusCode, Method: method, Path: path, Message: strings.TrimSpace(string(msg))}
+	}
+	if out == nil {
+		return resp.Header, nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return resp.Header, fmt.Errorf("%s %s: decoding response: %w", method, path, err)
+	}
+	return resp.Header, nil
+}
+
+func routerPath(routerID int, path string) string {
+	return "/routers/" + strconv.Itoa(routerID) + path
+}
+
+func (c *Client) Drivers(ctx context.Context) ([]router.Driver, error) {
+	drivers := make([]router.Driver, 0)
+	err := c.do(ctx, http.MethodGet, "/drivers", nil, &drivers)
+	return drivers, err
+}
+
+func (c *Client) Routers(ctx context.Context) ([]apiv1.Router, error) {
+	routers := make([]apiv1.Router, 0)
+	err := c.do(ctx, http.MethodGet, "/routers", nil, &routers)
+	return routers, err
+}
+
+func (c *Client) Capabilities(ctx context.Context, routerID int) (router.Capabilities, error) {
+	caps := router.Capabilities{}
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/capabilities"), nil, &caps)
+	return caps, err
+}
+
+func (c *Client) Status(ctx context.Context, routerID int) (router.Status, error) {
+	status := router.Status{}
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/status"), nil, &status)
+	return status, err
+}
+
+func (c *Client) Table(ctx context.Context, routerID int) ([]apiv1.RouterTableLine, error) {
+	table := make([]apiv1.RouterTableLine, 0)
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/table"), nil, &table)
+	return table, err
+}
+
+func (c *Client) ValidSources(ctx context.Context, routerID int) (apiv1.RouterTableValidSources, error) {
+	sources := apiv1.RouterTableValidSources{}
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/validsources"), nil, &sources)
+	return sources, err
+}
+
+func (c *Client) Crosspoints(ctx context.Context, routerID int) ([]router.Crosspoint, error) {
+	crosspoints := make([]router.Crosspoint, 0)
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/crosspoints"), nil, &crosspoints)
+	return crosspoints, err
+}
+
+// CrosspointsAt returns a router's crosspoints as they were at a past time
+func (c *Client) CrosspointsAt(ctx context.Context, routerID int, at time.Time) ([]router.Crosspoint, error) {
+	crosspoints := make([]router.Crosspoint, 0)
+	query := url.Values{"at": {at.Format(time.RFC3339)}}
+	_, err := c.doQuery(ctx, http.MethodGet, routerPath(routerID, "/crosspoints"), query, nil, &crosspoints)
+	return crosspoints, err
+}
+
+// History returns a router's crosspoint changes between from and to, for all destinations if destination is empty.
+// Zero times use the server's defaults of the 24 hours until now.
+func (c *Client) History(ctx context.Context, routerID int, destination string, from time.Time, to time.Time) ([]apiv1.HistoryEntry, error) {
+	query := url.Values{}
+	if destination != "" {
+		query.Set("destination", destination)
+	}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+	history := make([]apiv1.HistoryEntry, 0)
+	_, err := c.doQuery(ctx, http.MethodGet, routerPath(routerID, "/history"), query, nil, &history)
+	return history, err
+}
+
+func (c *Client) Destinations(ctx context.Context, routerID int) ([]router.Destination, error) {
+	dests := make([]router.Destination, 0)
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/destinations"), nil, &dests)
+	return dests, err
+}
+
+func (c *Client) Levels(ctx context.Context, routerID int) ([]router.Level, error) {
+	levels := make([]router.Level, 0)
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/levels"), nil, &levels)
+	return levels, err
+}
+
+func (c *Client) Sources(ctx context.Context, routerID int) ([]router.Source, error) {
+	sources := make([]router.Source, 0)
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/sources"), nil, &sources)
+	return sources, err
+}
+
+// Search filters sources or destinations. Empty fields don't filter.
+type Search struct {
+	Query  string   // Fuzzy match on the name
+	Tags   []string // Items must have all of these tags
+	Level  string   // Level name or ID items must be on
+	Limit  int      // Maximum number of items returned, 0 for all
+	Offset int
+}
+
+func (s Search) values() url.Values {
+	values := make(url.Values)
+	if s.Query != "" {
+		values.Set("q", s.Query)
+	}
+	for _, tag := range s.Tags {
+		values.Add("tag", tag)
+	}
+	if s.Level != "" {
+		values.Set("level", s.Level)
+	}
+	if s.Limit > 0 {
+		values.Set("limit", strconv.Itoa(s.Limit))
+	}
+	if s.Offset > 0 {
+		values.Set("offset", strconv.Itoa(s.Offset))
+	}
+	return values
+}
+
+// SearchSources returns a page of matching sources and the total number of matches
+func (c *Client) SearchSources(ctx context.Context, routerID int, search Search) ([]router.Source, int, error) {
+	sources := make([]router.Source, 0)
+	header, err := c.doQuery(ctx, http.MethodGet, routerPath(routerID, "/sources"), search.values(), nil, &sources)
+	if err != nil {
+		return sources, 0, err
+	}
+	total, _ := strconv.Atoi(header.Get("X-Total-Count"))
+	return sources, total, nil
+}
+
+// SearchDestinations returns a page of matching destinations and the total number of matches
+func (c *Client) SearchDestinations(ctx context.Context, routerID int, search Search) ([]router.Destination, int, error) {
+	dests := make([]router.Destination, 0)
+	header, err := c.doQuery(ctx, http.MethodGet, routerPath(routerID, "/destinations"), search.values(), nil, &dests)
+	if err != nil {
+		return dests, 0, err
+	}
+	total, _ := strconv.Atoi(header.Get("X-Total-Count"))
+	return dests, total, nil
+}
+
+// Tags returns every tag used on a router
+func (c *Client) Tags(ctx context.Context, routerID int) ([]string, error) {
+	tags := make([]string, 0)
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/tags"), nil, &tags)
+	return tags, err
+}
+
+// SetSourceTags replaces the tags added to a source through the API
+func (c *Client) SetSourceTags(ctx context.Context, routerID int, source string, tags []string) error {
+	return c.do(ctx, http.MethodPut, routerPath(routerID, "/sources/"+url.PathEscape(source)+"/tags"), tags, nil)
+}
+
+// SetDestinationTags replaces the tags added to a destination through the API
+func (c *Client) SetDestinationTags(ctx context.Context, routerID int, destination string, tags []string) error {
+	return c.do(ctx, http.MethodPut, routerPath(routerID, "/destinations/"+url.PathEscape(destination)+"/tags"), tags, nil)
+}
+
+// SetCrosspoint routes a source to a destination
+func (c *Client) SetCrosspoint(ctx context.Context, routerID int, req apiv1.CrosspointRequest) error {
+	return c.do(ctx, http.MethodPut, routerPath(routerID, "/crosspoints"), req, nil)
+}
+
+// SetMappedCrosspoint routes a source to a destination with a level mapping preset
+func (c *Client) SetMappedCrosspoint(ctx context.Context, routerID int, req apiv1.MappedCrosspointRequest) error {
+	return c.do(ctx, http.MethodPut, routerPath(routerID, "/crosspoints/mapped"), req, nil)
+}
+
+// LevelMappings returns the router's level mapping presets
+func (c *Client) LevelMappings(ctx context.Context, routerID int) ([]apiv1.LevelMapping, error) {
+	mappings := make([]apiv1.LevelMapping, 0)
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/level_mappings"), nil, &mappings)
+	return mappings, err
+}
+
+// SetLock locks or unlocks a destination
+func (c *Client) SetLock(ctx context.Context, routerID int, req apiv1.CrosspointLockRequest) error {
+	return c.do(ctx, http.MethodPut, routerPath(routerID, "/crosspoints/lock"), req, nil)
+}
+
+func (c *Client) MultiviewerLayout(ctx context.Context, routerID int, req apiv1.MultiviewerLayoutRequest) (neuronview.Layout, error) {
+	layout := neuronview.Layout{}
+	err := c.do(ctx, http.MethodPost, routerPath(routerID, "/multiviewer/layout"), req, &layout)
+	return layout, err
+}
+
+func (c *Client) MultiviewerStreamsSDP(ctx context.Context, req apiv1.MultiviewerStreamsSDPRequest) (apiv1.MultiviewerStreamsSDPResponse, error) {
+	resp := apiv1.MultiviewerStreamsSDPResponse{}
+	err := c.do(ctx, http.MethodPost, "/multiviewer/streams/sdp", req, &resp)
+	return resp, err
+}
+
+func (c *Client) NameSets(ctx context.Context, routerID int) ([]apiv1.NameSet, error) {
+	nameSets := make([]apiv1.NameSet, 0)
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/namesets"), nil, &nameSets)
+	return nameSets, err
+}
+
+func (c *Client) NameSet(ctx context.Context, routerID int, name string) (apiv1.NameSet, error) {
+	nameSet := apiv1.NameSet{}
+	err := c.do(ctx, http.MethodGet, routerPath(routerID, "/namesets/"+url.PathEscape(name)), nil, &nameSet)
+	return nameSet, err
+}
+
+// PutNameSet creates or replaces a name set
+func (c *Client) PutNameSet(ctx context.Context, routerID int, nameSet apiv1.NameSet) error {
+	return c.do(ctx, http.MethodPut, routerPath(routerID, "/namesets/"+url.PathEscape(nameSet.Name)), nameSet, nil)
+}
+
+func (c *Client) DeleteNameSet(ctx context.Context, routerID int, name string) error {
+	return c.do(ctx, http.MethodDelete, routerPath(routerID, "/namesets/"+url.PathEscape(name)), nil, nil)
+}
+
+// User returns the user the server identifies the client as
+func (c *Client) User(ctx context.Context) (apiv1.User, error) {
+	user := apiv1.User{}
+	err := c.do(ctx, http.MethodGet, "/user", nil, &user)
+	return user, err
+}
+
+func (c *Client) PutUserPreferences(ctx context.Context, prefs apiv1.UserPreferences) error {
+	return c.do(ctx, http.MethodPut, "/user/preferences", prefs, nil)
+}
+
+// Panels returns the user's panels without their crosspoints
+func (c *Client) Panels(ctx context.Context) ([]apiv1.Panel, error) {
+	panels := make([]apiv1.Panel, 0)
+	err := c.do(ctx, http.MethodGet, "/user/panels", nil, &panels)
+	return panels, err
+}
+
+// Panel returns a user's panel with the current crosspoints of its destinations
+func (c *Client) Panel(ctx context.Context, name string) (apiv1.PanelState, error) {
+	panel := apiv1.PanelState{}
+	err := c.do(ctx, http.MethodGet, "/user/panels/"+url.PathEscape(name), nil, &panel)
+	return panel, err
+}
+
+// PutPanel creates or replaces a panel
+func (c *Client) PutPanel(ctx context.Context, panel apiv1.Panel) error {
+	return c.do(ctx, http.MethodPut, "/user/panels/"+url.PathEscape(panel.Name), panel, nil)
+}
+
+func (c *Client) DeletePanel(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/user/panels/"+url.PathEscape(name), nil, nil)
+}
+
+// UndoHistory returns the user's operations which can be undone, newest first
+func (c *Client) UndoHistory(ctx context.Context) ([]apiv1.UndoOperation, error) {
+	ops := make([]apiv1.UndoOperation, 0)
+	err := c.do(ctx, http.MethodGet, "/undo", nil, &ops)
+	return ops, err
+}
+
+// Undo reverts the user's most recent route or salvo, returning the operation undone
+func (c *Client) Undo(ctx context.Context) (apiv1.UndoOperation, error) {
+	op := apiv1.UndoOperation{}
+	err := c.do(ctx, http.MethodPost, "/undo", nil, &op)
+	return op, err
+}
+
+func (c *Client) Salvos(ctx context.Context) ([]apiv1.Salvo, error) {
+	salvos := make([]apiv1.Salvo, 0)
+	err := c.do(ctx, http.MethodGet, "/salvos", nil, &salvos)
+	return salvos, err
+}
+
+func (c *Client) Salvo(ctx context.Context, name string) (apiv1.Salvo, error) {
+	salvo := apiv1.Salvo{}
+	err := c.do(ctx, http.MethodGet, "/salvos/"+url.PathEscape(name), nil, &salvo)
+	return salvo, err
+}
+
+// PutSalvo creates or replaces a salvo
+func (c *Client) PutSalvo(ctx context.Context, salvo apiv1.Salvo) error {
+	return c.do(ctx, http.MethodPut, "/salvos/"+url.PathEscape(salvo.Name), salvo, nil)
+}
+
+func (c *Client) DeleteSalvo(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/salvos/"+url.PathEscape(name), nil, nil)
+}
+
+// FireSalvo routes every crosspoint of a salvo
+func (c *Client) FireSalvo(ctx context.Context, name string) (apiv1.SalvoFireResult, error) {
+	result := apiv1.SalvoFireResult{}
+	err := c.do(ctx, http.MethodPost, "/salvos/"+url.PathEscape(name)+"/fire", nil, &result)
+	return result, err
+}
+
+func (c *Client) Snapshots(ctx context.Context) ([]apiv1.Snapshot, error) {
+	snapshots := make([]apiv1.Snapshot, 0)
+	err := c.do(ctx, http.MethodGet, "/snapshots", nil, &snapshots)
+	return snapshots, err
+}
+
+func (c *Client) Snapshot(ctx context.Context, name string) (apiv1.Snapshot, error) {
+	snapshot := apiv1.Snapshot{}
+	err := c.do(ctx, http.MethodGet, "/snapshots/"+url.PathEscape(name), nil, &snapshot)
+	return snapshot, err
+}
+
+// SaveSnapshot saves the current crosspoints of routers, or of every router if none are given
+func (c *Client) SaveSnapshot(ctx context.Context, name string, routerIDs ...int) (apiv1.Snapshot, error) {
+	snapshot := apiv1.Snapshot{}
+	err := c.do(ctx, http.MethodPut, "/snapshots/"+url.PathEscape(name), apiv1.SnapshotRequest{RouterIDs: routerIDs}, &snapshot)
+	return snapshot, err
+}
+
+func (c *Client) DeleteSnapshot(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/snapshots/"+url.PathEscape(name), nil, nil)
+}
+
+// RestoreSnapshot routes every crosspoint of a snapshot
+func (c *Client) RestoreSnapshot(ctx context.Context, name string) (apiv1.SalvoFireResult, error) {
+	result := apiv1.SalvoFireResult{}
+	err := c.do(ctx, http.MethodPost, "/snapshots/"+url.PathEscape(name)+"/restore", nil, &result)
+	return result, err
+}
+
+// Audit returns audit records in a time window, optionally of one user. Zero times use the server's defaults.
+func (c *Client) Audit(ctx context.Context, user string, from time.Time, to time.Time) ([]apiv1.AuditRecord, error) {
+	query := url.Values{}
+	if user != "" {
+		query.Set("user", user)
+	}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+	records := make([]apiv1.AuditRecord, 0)
+	_, err := c.doQuery(ctx, http.MethodGet, "/audit", query, nil, &records)
+	return records, err
+}
+
+// Bookings returns the bookings overlapping a time window, in start order.
+// Zero times use the server's defaults of now and 7 days from now.
+func (c *Client) Bookings(ctx context.Context, from time.Time, to time.Time) ([]apiv1.Booking, error) {
+	query := url.Values{}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+	bookings := make([]apiv1.Booking, 0)
+	_, err := c.doQuery(ctx, http.MethodGet, "/bookings", query, nil, &bookings)
+	return bookings, err
+}
+
+func (c *Client) Booking(ctx context.Context, name string) (apiv1.Booking, error) {
+	booking := apiv1.Booking{}
+	err := c.do(ctx, http.MethodGet, "/bookings/"+url.PathEscape(name), nil, &booking)
+	return booking, err
+}
+
+// PutBooking creates or replaces a booking owned by the client's user, returning it as saved
+func (c *Client) PutBooking(ctx context.Context, booking apiv1.Booking) (apiv1.Booking, error) {
+	saved := apiv1.Booking{}
+	err := c.do(ctx, http.MethodPut, "/bookings/"+url.PathEscape(booking.Name), booking, &saved)
+	return saved, err
+}
+
+func (c *Client) DeleteBooking(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/bookings/"+url.PathEscape(name), nil, nil)
+}
+
+func (c *Client) Jobs(ctx context.Context) ([]apiv1.Job, error) {
+	jobs := make([]apiv1.Job, 0)
+	err := c.do(ctx, http.MethodGet, "/schedule/jobs", nil, &jobs)
+	return jobs, err
+}
+
+func (c *Client) Job(ctx context.Context, name string) (apiv1.Job, error) {
+	job := apiv1.Job{}
+	err := c.do(ctx, http.MethodGet, "/schedule/jobs/"+url.PathEscape(name), nil, &job)
+	return job, err
+}
+
+// PutJob creates or replaces a scheduled job
+func (c *Client) PutJob(ctx context.Context, job apiv1.Job) error {
+	return c.do(ctx, http.MethodPut, "/schedule/jobs/"+url.PathEscape(job.Name), job, nil)
+}
+
+func (c *Client) DeleteJob(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/schedule/jobs/"+url.PathEscape(name), nil, nil)
+}
+
+// JobResults returns the results of a job's runs, newest first
+func (c *Client) JobResults(ctx context.Context, name string) ([]apiv1.JobResult, error) {
+	results := make([]apiv1.JobResult, 0)
+	err := c.do(ctx, http.MethodGet, "/schedule/jobs/"+url.PathEscape(name)+"/results", nil, &results)
+	return results, err
+}
+
+// Upcoming returns the runs of all enabled jobs until a time
+func (c *Client) Upcoming(ctx context.Context, until time.Time, limit int) ([]apiv1.ScheduledRun, error) {
+	query := url.Values{}
+	if !until.IsZero() {
+		query.Set("until", until.Format(time.RFC3339))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	runs := make([]apiv1.ScheduledRun, 0)
+	_, err := c.doQuery(ctx, http.MethodGet, "/schedule/upcoming", query, nil, &runs)
+	return runs, err
+}
+
+// Reload makes the server reload its config file
+func (c *Client) Reload(ctx context.Context) (apiv1.ReloadResult, error) {
+	result := apiv1.ReloadResult{}
+	err := c.do(ctx, http.MethodPost, "/admin/reload", nil, &result)
+	return result, err
+}
+
+// OpenAPI returns the server's OpenAPI document
+func (c *Client) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	doc := json.RawMessage{}
+	err := c.do(ctx, http.MethodGet, "/openapi.json", nil, &doc)
+	return doc, err
+}
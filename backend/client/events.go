@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// EventStream receives events from the server's websocket
+type EventStream struct {
+	conn *websocket.Conn
+}
+
+// Events connects to the websocket and streams every event
+func (c *Client) Events(ctx context.Context) (*EventStream, error) {
+	wsURL := "ws" + strings.TrimPrefix(c.URL, "http") + "/api/v1/ws?format=events"
+	if c.UseNameSet != "" {
+		wsURL += "&nameset=" + url.QueryEscape(c.UseNameSet)
+	}
+	// The websocket library requires cancellation through the context rather than a client timeout
+	httpClient := *c.Client
+	httpClient.Timeout = 0
+	conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+		HTTPClient: &httpClient,
+		HTTPHeader: c.Header.Clone(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &EventStream{conn: conn}, nil
+}
+
+// Next blocks until the next event is received
+func (s *EventStream) Next(ctx context.Context) (apiv1.Event, error) {
+	event := apiv1.Event{}
+	err := wsjson.Read(ctx, s.conn, &event)
+	return event, err
+}
+
+func (s *EventStream) Close() error {
+	return s.conn.Close(websocket.StatusNormalClosure, "")
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/client"
+	"github.com/cassaram/bfc/backend/router"
+)
+
+func runRouters(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	routers, err := c.client.Routers(ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(routers))
+	for _, rtr := range routers {
+		rows = append(rows, []string{strconv.Itoa(rtr.ID), rtr.ShortName, rtr.DisplayName, string(rtr.Status.State)})
+	}
+	return c.print(routers, []string{"ID", "SHORT NAME", "NAME", "STATE"}, rows)
+}
+
+// searchFlags parses the search options of the sources and destinations commands
+func searchFlags(name string, args []string) (client.Search, []string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	search := client.Search{}
+	flags.StringVar(&search.Query, "q", "", "Fuzzy match on the name")
+	flags.Func("tag", "Only items with this tag, can be repeated", func(tag string) error {
+		search.Tags = append(search.Tags, tag)
+		return nil
+	})
+	flags.StringVar(&search.Level, "level", "", "Only items on this level")
+	flags.IntVar(&search.Limit, "limit", 0, "Maximum number of items")
+	err := flags.Parse(args)
+	return search, flags.Args(), err
+}
+
+func runSources(ctx context.Context, c *cli, args []string) error {
+	search, args, err := searchFlags("sources", args)
+	if err != nil || len(args) != 1 {
+		return errUsage
+	}
+	rtr, err := c.resolveRouter(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	sources, total, err := c.client.SearchSources(ctx, rtr.ID, search)
+	if err != nil {
+		return err
+	}
+	levels, err := c.client.Levels(ctx, rtr.ID)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(sources))
+	for _, src := range sources {
+		rows = append(rows, []string{strconv.Itoa(src.ID), src.Name, levelNames(levels, src.Levels), strings.Join(src.Tags, ",")})
+	}
+	err = c.print(sources, []string{"ID", "NAME", "LEVELS", "TAGS"}, rows)
+	c.printTruncated(len(sources), total)
+	return err
+}
+
+func runDestinations(ctx context.Context, c *cli, args []string) error {
+	search, args, err := searchFlags("destinations", args)
+	if err != nil || len(args) != 1 {
+		return errUsage
+	}
+	rtr, err := c.resolveRouter(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	dests, total, err := c.client.SearchDestinations(ctx, rtr.ID, search)
+	if err != nil {
+		return err
+	}
+	levels, err := c.client.Levels(ctx, rtr.ID)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(dests))
+	for _, dest := range dests {
+		rows = append(rows, []string{strconv.Itoa(dest.ID), dest.Name, levelNames(levels, dest.Levels), strings.Join(dest.Tags, ",")})
+	}
+	err = c.print(dests, []string{"ID", "NAME", "LEVELS", "TAGS"}, rows)
+	c.printTruncated(len(dests), total)
+	return err
+}
+
+// printTruncated notes on stderr when a limit hid some matches
+func (c *cli) printTruncated(shown int, total int) {
+	if shown < total {
+		fmt.Fprintf(os.Stderr, "%d of %d shown\n", shown, total)
+	}
+}
+
+func runLevels(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	rtr, err := c.resolveRouter(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	levels, err := c.client.Levels(ctx, rtr.ID)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(levels))
+	for _, lvl := range levels {
+		rows = append(rows, []string{strconv.Itoa(lvl.ID), lvl.Name})
+	}
+	return c.print(levels, []string{"ID", "NAME"}, rows)
+}
+
+func runMappings(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	rtr, err := c.resolveRouter(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	mappings, err := c.client.LevelMappings(ctx, rtr.ID)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(mappings))
+	for _, mapping := range mappings {
+		pairs := make([]string, 0, len(mapping.Levels))
+		for _, lvlMap := range mapping.Levels {
+			pairs = append(pairs, fmt.Sprintf("%d>%d", lvlMap.SourceLevel, lvlMap.DestinationLevel))
+		}
+		rows = append(rows, []string{mapping.Name, strings.Join(pairs, " ")})
+	}
+	return c.print(mappings, []string{"NAME", "SOURCE>DESTINATION LEVELS"}, rows)
+}
+
+// parseTime reads an RFC 3339 time or a duration before now
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func runHistory(ctx context.Context, c *cli, args []string) error {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	fromStr := flags.String("from", "", "Start time")
+	toStr := flags.String("to", "", "End time")
+	if flags.Parse(args) != nil || flags.NArg() < 1 || flags.NArg() > 2 {
+		return errUsage
+	}
+	from, err := parseTime(*fromStr)
+	if err != nil {
+		return err
+	}
+	to, err := parseTime(*toStr)
+	if err != nil {
+		return err
+	}
+	rtr, err := c.resolveRouter(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	history, err := c.client.History(ctx, rtr.ID, flags.Arg(1), from, to)
+	if err != nil {
+		return err
+	}
+	levels, err := c.client.Levels(ctx, rtr.ID)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(history))
+	for _, change := range history {
+		src := change.SourceName + "." + levelNames(levels, []int{change.SourceLevel})
+		if change.Locked {
+			src += " (locked)"
+		}
+		rows = append(rows, []string{
+			change.Time.Local().Format(time.RFC3339),
+			change.DestinationName,
+			levelNames(levels, []int{change.DestinationLevel}),
+			src,
+		})
+	}
+	return c.print(history, []string{"TIME", "DESTINATION", "LEVEL", "SOURCE"}, rows)
+}
+
+func runTable(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	rtr, err := c.resolveRouter(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	table, err := c.client.Table(ctx, rtr.ID)
+	if err != nil {
+		return err
+	}
+	levels, err := c.client.Levels(ctx, rtr.ID)
+	if err != nil {
+		return err
+	}
+	header := []string{"ID", "DESTINATION"}
+	for _, lvl := range levels {
+		header = append(header, lvl.Name)
+	}
+	rows := make([][]string, 0, len(table))
+	for _, line := range table {
+		row := []string{strconv.Itoa(line.ID), line.Name}
+		for i, src := range line.CrosspointsAsString {
+			if i < len(line.Crosspoints) && line.Crosspoints[i].Locked {
+				src += " (locked)"
+			}
+			row = append(row, src)
+		}
+		rows = append(rows, row)
+	}
+	return c.print(table, header, rows)
+}
+
+func runRoute(ctx context.Context, c *cli, args []string) error {
+	flags := flag.NewFlagSet("route", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	levelArg := flags.String("level", "", "Level to route, all levels if not given")
+	mappingArg := flags.String("mapping", "", "Level mapping preset to route with")
+	if flags.Parse(args) != nil || flags.NArg() != 3 || (*levelArg != "" && *mappingArg != "") {
+		return errUsage
+	}
+	rtr, err := c.resolveRouter(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	// The server resolves names and IDs
+	if *mappingArg != "" {
+		return c.client.SetMappedCrosspoint(ctx, rtr.ID, apiv1.MappedCrosspointRequest{
+			Destination: apiv1.Ref(flags.Arg(1)),
+			Source:      apiv1.Ref(flags.Arg(2)),
+			Mapping:     *mappingArg,
+		})
+	}
+	return c.client.SetCrosspoint(ctx, rtr.ID, apiv1.CrosspointRequest{
+		Destination: apiv1.Ref(flags.Arg(1)),
+		Source:      apiv1.Ref(flags.Arg(2)),
+		Level:       apiv1.Ref(*levelArg),
+	})
+}
+
+func runLock(ctx context.Context, c *cli, args []string) error {
+	return setLock(ctx, c, "lock", args, true)
+}
+
+func runUnlock(ctx context.Context, c *cli, args []string) error {
+	return setLock(ctx, c, "unlock", args, false)
+}
+
+func setLock(ctx context.Context, c *cli, name string, args []string, locked bool) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	levelArg := flags.String("level", "", "Level to "+name+", all levels if not given")
+	if flags.Parse(args) != nil || flags.NArg() != 2 {
+		return errUsage
+	}
+	rtr, err := c.resolveRouter(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return c.client.SetLock(ctx, rtr.ID, apiv1.CrosspointLockRequest{
+		Destination: apiv1.Ref(flags.Arg(1)),
+		Level:       apiv1.Ref(*levelArg),
+		Locked:      locked,
+	})
+}
+
+func runUndo(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	op, err := c.client.Undo(ctx)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(op, nil, nil)
+	}
+	fmt.Printf("Undid %s\n", op.Description)
+	return nil
+}
+
+func runSalvos(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	salvos, err := c.client.Salvos(ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(salvos))
+	for _, salvo := range salvos {
+		rows = append(rows, []string{salvo.Name, strconv.Itoa(len(salvo.Crosspoints))})
+	}
+	return c.print(salvos, []string{"NAME", "CROSSPOINTS"}, rows)
+}
+
+func runFire(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	result, err := c.client.FireSalvo(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if c.json {
+		err = c.print(result, nil, nil)
+		if err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("%d crosspoints routed\n", result.Routed)
+	}
+	if len(result.Errors) > 0 {
+		for _, msg := range result.Errors {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+		return fmt.Errorf("%d crosspoints failed", len(result.Errors))
+	}
+	return nil
+}
+
+func runBookings(ctx context.Context, c *cli, args []string) error {
+	flags := flag.NewFlagSet("bookings", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	window := flags.Duration("for", 7*24*time.Hour, "How far ahead to look")
+	if flags.Parse(args) != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+	now := time.Now()
+	bookings, err := c.client.Bookings(ctx, now, now.Add(*window))
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(bookings))
+	for _, booking := range bookings {
+		dests := make([]string, 0, len(booking.Destinations))
+		for _, bd := range booking.Destinations {
+			dests = append(dests, fmt.Sprintf("%d/%d", bd.RouterID, bd.DestinationID))
+		}
+		rows = append(rows, []string{
+			booking.Start.Local().Format(time.RFC3339),
+			booking.End.Local().Format(time.RFC3339),
+			booking.Name,
+			booking.Owner,
+			strconv.Itoa(booking.Priority),
+			strings.Join(dests, ","),
+		})
+	}
+	return c.print(bookings, []string{"START", "END", "NAME", "OWNER", "PRIORITY", "DESTINATIONS"}, rows)
+}
+
+func runJobs(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	jobs, err := c.client.Jobs(ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(jobs))
+	for _, job := range jobs {
+		when := job.Cron
+		if job.At != nil {
+			when = job.At.Format(time.RFC3339)
+		}
+		next := ""
+		if job.NextRun != nil {
+			next = job.NextRun.Local().Format(time.RFC3339)
+		}
+		if job.Disabled {
+			next = "disabled"
+		}
+		target := job.Salvo
+		if target == "" {
+			target = fmt.Sprintf("%d crosspoints", len(job.Crosspoints))
+		}
+		rows = append(rows, []string{job.Name, when, job.Timezone, target, next})
+	}
+	return c.print(jobs, []string{"NAME", "WHEN", "TIMEZONE", "ROUTES", "NEXT"}, rows)
+}
+
+func runUpcoming(ctx context.Context, c *cli, args []string) error {
+	flags := flag.NewFlagSet("upcoming", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	window := flags.Duration("for", 24*time.Hour, "How far ahead to look")
+	if flags.Parse(args) != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+	runs, err := c.client.Upcoming(ctx, time.Now().Add(*window), 0)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(runs))
+	for _, run := range runs {
+		rows = append(rows, []string{run.At.Local().Format(time.RFC3339), run.Job})
+	}
+	return c.print(runs, []string{"AT", "JOB"}, rows)
+}
+
+func runPanels(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	panels, err := c.client.Panels(ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(panels))
+	for _, panel := range panels {
+		rows = append(rows, []string{panel.Name, strconv.Itoa(len(panel.Destinations))})
+	}
+	return c.print(panels, []string{"NAME", "DESTINATIONS"}, rows)
+}
+
+func runPanel(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	panel, err := c.client.Panel(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(panel.Rows))
+	for _, line := range panel.Rows {
+		if line.Error != "" {
+			rows = append(rows, []string{strconv.Itoa(line.RouterID), strconv.Itoa(line.DestinationID), "", line.Error})
+			continue
+		}
+		srcs := make([]string, 0, len(line.CrosspointsAsString))
+		for i, src := range line.CrosspointsAsString {
+			if i < len(line.Crosspoints) && line.Crosspoints[i].Locked {
+				src += " (locked)"
+			}
+			srcs = append(srcs, src)
+		}
+		rows = append(rows, []string{strconv.Itoa(line.RouterID), strconv.Itoa(line.DestinationID), line.Name, strings.Join(srcs, ", ")})
+	}
+	return c.print(panel, []string{"ROUTER", "ID", "DESTINATION", "SOURCES"}, rows)
+}
+
+// routerNames caches a router's names for printing events
+type routerNames struct {
+	shortName string
+	dests     map[int]string
+	sources   map[int]string
+	levels    map[int]string
+}
+
+func (c *cli) loadNames(ctx context.Context, rtr apiv1.Router) *routerNames {
+	// Names come from the client's name set, so they match the server's
+	names := &routerNames{
+		shortName: rtr.ShortName,
+		dests:     make(map[int]string),
+		sources:   make(map[int]string),
+		levels:    make(map[int]string),
+	}
+	// Names are only cosmetic here, fall back to IDs if they can't be fetched
+	dests, _ := c.client.Destinations(ctx, rtr.ID)
+	for _, dest := range dests {
+		names.dests[dest.ID] = dest.Name
+	}
+	sources, _ := c.client.Sources(ctx, rtr.ID)
+	for _, src := range sources {
+		names.sources[src.ID] = src.Name
+	}
+	levels, _ := c.client.Levels(ctx, rtr.ID)
+	for _, lvl := range levels {
+		names.levels[lvl.ID] = lvl.Name
+	}
+	return names
+}
+
+func nameOr(names map[int]string, id int) string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+	return strconv.Itoa(id)
+}
+
+func (n *routerNames) crosspoint(xpt router.Crosspoint) string {
+	str := fmt.Sprintf("%s.%s <- %s.%s", nameOr(n.dests, xpt.Destination), nameOr(n.levels, xpt.DestinationLevel), nameOr(n.sources, xpt.Source), nameOr(n.levels, xpt.SourceLevel))
+	if xpt.Locked {
+		str += " (locked)"
+	}
+	return str
+}
+
+func runWatch(ctx context.Context, c *cli, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	routerID := 0
+	if len(args) == 1 {
+		rtr, err := c.resolveRouter(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		routerID = rtr.ID
+	}
+	routers, err := c.client.Routers(ctx)
+	if err != nil {
+		return err
+	}
+	names := make(map[int]*routerNames)
+	if !c.json {
+		for _, rtr := range routers {
+			if routerID == 0 || rtr.ID == routerID {
+				names[rtr.ID] = c.loadNames(ctx, rtr)
+			}
+		}
+	}
+
+	events, err := c.client.Events(ctx)
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		event, err := events.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if routerID != 0 && event.RouterID != routerID {
+			continue
+		}
+		if c.json {
+			enc.Encode(event)
+			continue
+		}
+		rtrNames, ok := names[event.RouterID]
+		if !ok {
+			rtrNames = &routerNames{shortName: strconv.Itoa(event.RouterID)}
+		}
+		now := time.Now().Format(time.TimeOnly)
+		switch {
+		case event.Type == apiv1.EventCrosspoint && event.Crosspoint != nil:
+			fmt.Printf("%s %s %s\n", now, rtrNames.shortName, rtrNames.crosspoint(*event.Crosspoint))
+		case event.Type == apiv1.EventRouterStatus && event.Status != nil:
+			fmt.Printf("%s %s status %s %s\n", now, rtrNames.shortName, event.Status.State, event.Status.LastError)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// bfcctl controls BFC routers from the command line through the HTTP API.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/cassaram/bfc/backend/client"
+	"golang.org/x/exp/maps"
+)
+
+type command struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"routers":      {"routers", "List routers", runRouters},
+	"sources":      {"sources [-q QUERY] [-tag TAG] [-level LEVEL] [-limit N] ROUTER", "List or search sources", runSources},
+	"destinations": {"destinations [-q QUERY] [-tag TAG] [-level LEVEL] [-limit N] ROUTER", "List or search destinations", runDestinations},
+	"levels":       {"levels ROUTER", "List levels", runLevels},
+	"mappings":     {"mappings ROUTER", "List level mapping presets", runMappings},
+	"table":        {"table ROUTER", "Show the router table", runTable},
+	"history":      {"history [-from TIME] [-to TIME] ROUTER [DESTINATION]", "Show crosspoint changes, TIME is RFC 3339 or a duration ago like 2h", runHistory},
+	"route":        {"route [-level LEVEL | -mapping PRESET] ROUTER DESTINATION SOURCE", "Route a source to a destination, all levels unless -level or a level mapping preset is given", runRoute},
+	"lock":         {"lock [-level LEVEL] ROUTER DESTINATION", "Lock a destination", runLock},
+	"unlock":       {"unlock [-level LEVEL] ROUTER DESTINATION", "Unlock a destination", runUnlock},
+	"undo":         {"undo", "Undo your most recent route or salvo", runUndo},
+	"salvos":       {"salvos", "List salvos", runSalvos},
+	"fire":         {"fire SALVO", "Fire a salvo", runFire},
+	"bookings":     {"bookings [-for DURATION]", "Show bookings from now, default for 7 days", runBookings},
+	"jobs":         {"jobs", "List scheduled jobs", runJobs},
+	"upcoming":     {"upcoming [-for DURATION]", "Show upcoming runs of scheduled jobs, default for 24h", runUpcoming},
+	"panels":       {"panels", "List your panels", runPanels},
+	"panel":        {"panel NAME", "Show the destinations of a panel with their current sources", runPanel},
+	"watch":        {"watch [ROUTER]", "Print crosspoint and status changes as they happen", runWatch},
+}
+
+// cli holds the global options shared by every command
+type cli struct {
+	client *client.Client
+	json   bool
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: bfcctl [options] COMMAND [arguments]")
+	fmt.Fprintln(out, "\nRouters, destinations, sources and levels can be given by name or ID.")
+	fmt.Fprintln(out, "\nCommands:")
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	names := maps.Keys(commands)
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", commands[name].usage, commands[name].help)
+	}
+	tw.Flush()
+	fmt.Fprintln(out, "\nOptions:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	defaultServer := os.Getenv("BFC_SERVER")
+	if defaultServer == "" {
+		defaultServer = "http://localhost"
+	}
+	server := flag.String("server", defaultServer, "BFC server URL, defaults to $BFC_SERVER")
+	output := flag.String("o", "table", "Output format: table or json")
+	nameSet := flag.String("nameset", "", "Show names from this name set")
+	user := flag.String("user", os.Getenv("BFC_USER"), "User to identify as when the server trusts the X-BFC-User header, defaults to $BFC_USER")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "bfcctl: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "bfcctl: unknown output format %q\n", *output)
+		os.Exit(2)
+	}
+
+	c := &cli{
+		client: client.New(*server),
+		json:   *output == "json",
+	}
+	c.client.UseNameSet = *nameSet
+	if *user != "" {
+		c.client.Header.Set("X-BFC-User", *user)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := cmd.run(ctx, c, flag.Args()[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprintln(os.Stderr, "Usage: bfcctl", cmd.usage)
+		os.Exit(2)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "bfcctl:", err.Error())
+		os.Exit(1)
+	}
+}
+
+var errUsage = errors.New("usage")
+
+// print writes v as JSON, or the rows as a table with a header
+func (c *cli) print(v any, header []string, rows [][]string) error {
+	if c.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
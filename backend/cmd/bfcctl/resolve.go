@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/router"
+)
+
+// resolveRouter finds a router by ID or short name
+func (c *cli) resolveRouter(ctx context.Context, arg string) (apiv1.Router, error) {
+	routers, err := c.client.Routers(ctx)
+	if err != nil {
+		return apiv1.Router{}, err
+	}
+	id, idErr := strconv.Atoi(arg)
+	for _, rtr := range routers {
+		if (idErr == nil && rtr.ID == id) || strings.EqualFold(rtr.ShortName, arg) {
+			return rtr, nil
+		}
+	}
+	return apiv1.Router{}, fmt.Errorf("router %q not found", arg)
+}
+
+func levelNames(levels []router.Level, ids []int) string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		name := strconv.Itoa(id)
+		for _, lvl := range levels {
+			if lvl.ID == id {
+				name = lvl.Name
+			}
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
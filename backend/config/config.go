@@ -7,9 +7,84 @@ type RouterConfig struct {
 	Type            string                 `json:"type"`
 	Config          map[string]interface{} `json:"config"`
 	AlternateLevels map[string][]int       `json:"alternate_levels"`
+	LevelMappings   map[string][]LevelMap  `json:"level_mappings"` // Mapping presets by name
+	Tags            []TagRule              `json:"tags"`
+}
+
+// LevelMap routes a source level to a destination level, such as audio pair 3/4 onto destination levels 1/2
+type LevelMap struct {
+	SourceLevel      int `json:"source_level"`
+	DestinationLevel int `json:"destination_level"`
+}
+
+// TagRule.AppliesTo values, empty applies to both
+const (
+	TagSources      = "sources"
+	TagDestinations = "destinations"
+)
+
+// TagRule tags the sources and destinations whose name starts with Prefix or matches Regex
+type TagRule struct {
+	Tag       string `json:"tag"`
+	AppliesTo string `json:"applies_to"`
+	Prefix    string `json:"prefix"`
+	Regex     string `json:"regex"`
+}
+
+// Listen address value that disables a listener
+const ListenerOff = "off"
+
+type HTTPConfig struct {
+	ListenAddress      string   `json:"listen_address"`       // Default ":80"
+	TLSListenAddress   string   `json:"tls_listen_address"`   // Default ":443"
+	RedirectToHTTPS    bool     `json:"redirect_to_https"`    // Redirect plain HTTP requests to the TLS listener
+	CertFile           string   `json:"cert_file"`            // Default "server.crt"
+	KeyFile            string   `json:"key_file"`             // Default "server.key"
+	MinTLSVersion      string   `json:"min_tls_version"`      // "1.2" (default) or "1.3"
+	ClientCAFile       string   `json:"client_ca_file"`       // Enables client certificate authentication
+	RequireClientCert  bool     `json:"require_client_cert"`  // Reject TLS clients without a valid certificate
+	TrustUserHeader    bool     `json:"trust_user_header"`    // Identify users by the X-BFC-User header, ignored with client_ca_file
+	CORSAllowedOrigins []string `json:"cors_allowed_origins"` // Default ["*"]
+	APIURL             string   `json:"api_url"`              // API base URL given to the frontend, default is the URL the frontend was loaded from
+}
+
+// WithDefaults returns the config with defaults filled in for empty values
+func (h HTTPConfig) WithDefaults() HTTPConfig {
+	if h.ListenAddress == "" {
+		h.ListenAddress = ":80"
+	}
+	if h.TLSListenAddress == "" {
+		h.TLSListenAddress = ":443"
+	}
+	if h.CertFile == "" {
+		h.CertFile = "server.crt"
+	}
+	if h.KeyFile == "" {
+		h.KeyFile = "server.key"
+	}
+	if h.MinTLSVersion == "" {
+		h.MinTLSVersion = "1.2"
+	}
+	if h.CORSAllowedOrigins == nil {
+		h.CORSAllowedOrigins = []string{"*"}
+	}
+	return h
+}
+
+// EmberPlusConfig publishes routers to Ember+ consumers such as mixing consoles
+type EmberPlusConfig struct {
+	ListenAddress string `json:"listen_address"` // Provider TCP address such as ":9000", empty disables the provider
+	Routers       []int  `json:"routers"`        // IDs of the routers to publish, default all
 }
 
 type ConfigFile struct {
-	LogLevel string         `json:"log_level"`
-	Routers  []RouterConfig `json:"routers"`
+	LogLevel        string `json:"log_level"`
+	NMOSRegistryURL string `json:"nmos_registry_url"`
+	DataFile        string `json:"data_file"`
+	// Crosspoint history, kept for HistoryRetentionDays (default 90)
+	HistoryFile          string          `json:"history_file"`
+	HistoryRetentionDays int             `json:"history_retention_days"`
+	HTTP                 HTTPConfig      `json:"http"`
+	EmberPlus            EmberPlusConfig `json:"emberplus"`
+	Routers              []RouterConfig  `json:"routers"`
 }
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// ValidationError is a single problem with the config, located by its JSON path
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// DriverValidator checks the driver specific "config" object of a router.
+// Paths in returned errors are relative to the "config" object.
+type DriverValidator func(conf map[string]interface{}) []ValidationError
+
+var logLevels = []string{"", "trace", "debug", "info", "warn", "error", "fatal", "panic"}
+
+// Parse decodes a config file, reporting syntax errors with their line and column
+func Parse(data []byte) (ConfigFile, error) {
+	cfg := ConfigFile{}
+	err := json.Unmarshal(data, &cfg)
+	if err == nil {
+		return cfg, nil
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, col := offsetPosition(data, syntaxErr.Offset)
+		return cfg, fmt.Errorf("line %d column %d: %s", line, col, syntaxErr.Error())
+	case errors.As(err, &typeErr):
+		line, col := offsetPosition(data, typeErr.Offset)
+		return cfg, ValidationErrors{{
+			Path:    "$." + typeErr.Field,
+			Message: fmt.Sprintf("expected %s, got %s (line %d column %d)", typeErr.Type, typeErr.Value, line, col),
+		}}
+	}
+	return cfg, err
+}
+
+func offsetPosition(data []byte, offset int64) (int, int) {
+	line, col := 1, 1
+	for i := int64(0); i < offset && i < int64(len(data)); i++ {
+		if data[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+// Validate checks the config file and returns every problem found.
+// drivers maps lower case router types to the validator for their config.
+func (c *ConfigFile) Validate(drivers map[string]DriverValidator) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	addErr := func(path string, format string, args ...any) {
+		errs = append(errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !slices.Contains(logLevels, strings.ToLower(c.LogLevel)) {
+		addErr("$.log_level", "unknown log level %q", c.LogLevel)
+	}
+
+	if c.HistoryRetentionDays < 0 {
+		addErr("$.history_retention_days", "must not be negative, got %d", c.HistoryRetentionDays)
+	}
+
+	httpCfg := c.HTTP.WithDefaults()
+	if httpCfg.MinTLSVersion != "1.2" && httpCfg.MinTLSVersion != "1.3" {
+		addErr("$.http.min_tls_version", "must be \"1.2\" or \"1.3\", got %q", c.HTTP.MinTLSVersion)
+	}
+	if httpCfg.ListenAddress == ListenerOff && httpCfg.TLSListenAddress == ListenerOff {
+		addErr("$.http", "both listeners are off")
+	}
+	if httpCfg.TLSListenAddress == ListenerOff {
+		if c.HTTP.RedirectToHTTPS {
+			addErr("$.http.redirect_to_https", "requires the TLS listener")
+		}
+		if c.HTTP.ClientCAFile != "" {
+			addErr("$.http.client_ca_file", "requires the TLS listener")
+		}
+	}
+	if c.HTTP.RequireClientCert && c.HTTP.ClientCAFile == "" {
+		addErr("$.http.require_client_cert", "requires client_ca_file")
+	}
+	for i, origin := range httpCfg.CORSAllowedOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			addErr(fmt.Sprintf("$.http.cors_allowed_origins[%d]", i), "origin must be \"*\" or start with http:// or https://, got %q", origin)
+		}
+	}
+	if c.HTTP.APIURL != "" && !strings.HasPrefix(c.HTTP.APIURL, "http://") && !strings.HasPrefix(c.HTTP.APIURL, "https://") {
+		addErr("$.http.api_url", "must start with http:// or https://, got %q", c.HTTP.APIURL)
+	}
+
+	if c.EmberPlus.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.EmberPlus.ListenAddress); err != nil {
+			addErr("$.emberplus.listen_address", "must be host:port or :port, got %q", c.EmberPlus.ListenAddress)
+		}
+	}
+	for i, routerID := range c.EmberPlus.Routers {
+		if !slices.ContainsFunc(c.Routers, func(rtrCfg RouterConfig) bool { return rtrCfg.ID == routerID }) {
+			addErr(fmt.Sprintf("$.emberplus.routers[%d]", i), "unknown router ID %d", routerID)
+		}
+	}
+
+	ids := make(map[int]int)
+	shortNames := make(map[string]int)
+	for i, rtrCfg := range c.Routers {
+		path := fmt.Sprintf("$.routers[%d]", i)
+
+		if rtrCfg.ID <= 0 {
+			addErr(path+".id", "must be a positive integer, got %d", rtrCfg.ID)
+		} else if first, dup := ids[rtrCfg.ID]; dup {
+			addErr(path+".id", "duplicate router ID %d (also used by $.routers[%d])", rtrCfg.ID, first)
+		} else {
+			ids[rtrCfg.ID] = i
+		}
+
+		shortName := strings.ToLower(rtrCfg.ShortName)
+		if shortName == "" {
+			addErr(path+".short_name", "must not be empty")
+		} else if first, dup := shortNames[shortName]; dup {
+			addErr(path+".short_name", "duplicate short name %q (also used by $.routers[%d])", rtrCfg.ShortName, first)
+		} else {
+			shortNames[shortName] = i
+		}
+
+		validator, known := drivers[strings.ToLower(rtrCfg.Type)]
+		if !known {
+			addErr(path+".type", "unknown router type %q", rtrCfg.Type)
+		} else if validator != nil {
+			for _, err := range validator(rtrCfg.Config) {
+				err.Path = path + ".config" + err.Path
+				errs = append(errs, err)
+			}
+		}
+
+		altLevelKeys := maps.Keys(rtrCfg.AlternateLevels)
+		slices.Sort(altLevelKeys)
+		for _, key := range altLevelKeys {
+			altLevels := rtrCfg.AlternateLevels[key]
+			keyPath := fmt.Sprintf("%s.alternate_levels[%q]", path, key)
+			lvl, err := strconv.Atoi(key)
+			if err != nil || lvl <= 0 {
+				addErr(keyPath, "key must be a positive level number")
+			}
+			for j, altLvl := range altLevels {
+				if altLvl <= 0 {
+					addErr(fmt.Sprintf("%s[%d]", keyPath, j), "level %d does not exist, levels start at 1", altLvl)
+				}
+			}
+		}
+
+		mappingNames := maps.Keys(rtrCfg.LevelMappings)
+		slices.Sort(mappingNames)
+		for _, name := range mappingNames {
+			mappingPath := fmt.Sprintf("%s.level_mappings[%q]", path, name)
+			if strings.TrimSpace(name) == "" {
+				addErr(mappingPath, "name must not be empty")
+			}
+			if len(rtrCfg.LevelMappings[name]) == 0 {
+				addErr(mappingPath, "must map at least one level")
+			}
+			mapped := make(map[int]int)
+			for j, lvlMap := range rtrCfg.LevelMappings[name] {
+				mapPath := fmt.Sprintf("%s[%d]", mappingPath, j)
+				if lvlMap.SourceLevel <= 0 {
+					addErr(mapPath+".source_level", "level %d does not exist, levels start at 1", lvlMap.SourceLevel)
+				}
+				if lvlMap.DestinationLevel <= 0 {
+					addErr(mapPath+".destination_level", "level %d does not exist, levels start at 1", lvlMap.DestinationLevel)
+				} else if first, dup := mapped[lvlMap.DestinationLevel]; dup {
+					addErr(mapPath+".destination_level", "level %d is already mapped by %s[%d]", lvlMap.DestinationLevel, mappingPath, first)
+				} else {
+					mapped[lvlMap.DestinationLevel] = j
+				}
+			}
+		}
+
+		for j, rule := range rtrCfg.Tags {
+			rulePath := fmt.Sprintf("%s.tags[%d]", path, j)
+			if strings.TrimSpace(rule.Tag) == "" {
+				addErr(rulePath+".tag", "must not be empty")
+			}
+			if rule.AppliesTo != "" && rule.AppliesTo != TagSources && rule.AppliesTo != TagDestinations {
+				addErr(rulePath+".applies_to", "must be %q, %q or empty for both, got %q", TagSources, TagDestinations, rule.AppliesTo)
+			}
+			if (rule.Prefix == "") == (rule.Regex == "") {
+				addErr(rulePath, "needs exactly one of prefix or regex")
+			}
+			if rule.Regex != "" {
+				if _, err := regexp.Compile(rule.Regex); err != nil {
+					addErr(rulePath+".regex", "%s", err.Error())
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+// ParsePort converts a port given as a JSON number or string
+func ParsePort(val interface{}) (uint16, error) {
+	port := -1
+	switch v := val.(type) {
+	case string:
+		p, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid port %q", v)
+		}
+		port = p
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("invalid port %v", v)
+		}
+		port = int(v)
+	default:
+		return 0, fmt.Errorf("invalid port %v", val)
+	}
+	if port <= 0 || port > 0xFFFF {
+		return 0, fmt.Errorf("port %d out of range", port)
+	}
+	return uint16(port), nil
+}
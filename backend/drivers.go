@@ -0,0 +1,8 @@
+package main
+
+// Router drivers compiled into BFC. Each driver registers itself with the
+// router package when imported; out-of-tree drivers are added the same way.
+import (
+	_ "github.com/cassaram/bfc/backend/router/emberplus"
+	_ "github.com/cassaram/bfc/backend/router/harrislrc"
+)
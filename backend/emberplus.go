@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/emberplus"
+	log "github.com/sirupsen/logrus"
+)
+
+// emberPlusPublished reports whether the Ember+ provider publishes a router
+func emberPlusPublished(routerID int) bool {
+	published := getConfig().EmberPlus.Routers
+	return len(published) == 0 || slices.Contains(published, routerID)
+}
+
+// emberPlusRouters returns the routers published over Ember+, with their last known state while they sync
+func emberPlusRouters() []emberplus.Router {
+	routers := make([]emberplus.Router, 0)
+	for _, rtrCfg := range getConfig().Routers {
+		if !emberPlusPublished(rtrCfg.ID) {
+			continue
+		}
+		rtr, rtr_ok := getRouter(rtrCfg.ID)
+		if !rtr_ok {
+			continue
+		}
+		rtr, _ = withLastKnownState(rtrCfg.ID, rtr)
+		routers = append(routers, emberplus.Router{ID: rtrCfg.ID, Identifier: rtrCfg.ShortName, Description: rtrCfg.DisplayName, Router: rtr})
+	}
+	return routers
+}
+
+// emberPlusRoute routes a connection request from an Ember+ consumer, audited under its address.
+// Consumers are anonymous, so destinations in an active booking are refused.
+func emberPlusRoute(consumer string, routerID int, destID int, destLevelID int, srcID int, srcLevelID int) error {
+	rtr, rtr_ok := getRouter(routerID)
+	if !rtr_ok {
+		return fmt.Errorf("Router ID (%d) not found", routerID)
+	}
+	err := checkBooking(routerID, destID, "")
+	if err != nil {
+		return err
+	}
+	err = setCrosspoint(routerID, rtr, destID, destLevelID, srcID, srcLevelID)
+	description := fmt.Sprintf("Route %s to %s", rtr.GetSource(srcID).Name, rtr.GetDestination(destID).Name)
+	recordAudit("emberplus:"+consumer, apiv1.AuditRoute, description, errorStrings(err))
+	return err
+}
+
+// startEmberPlus starts the Ember+ provider if it has a listen address
+func startEmberPlus() {
+	address := getConfig().EmberPlus.ListenAddress
+	if address == "" {
+		return
+	}
+	provider := &emberplus.Provider{Routers: emberPlusRouters, Route: emberPlusRoute}
+	err := provider.Listen(address)
+	if err != nil {
+		log.Error("Ember+ Provider: Not starting: ", err.Error())
+		return
+	}
+	EmberPlus = provider
+}
@@ -0,0 +1,388 @@
+package emberplus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// BER tag classes
+const (
+	classUniversal   = 0x00
+	classApplication = 0x40
+	classContext     = 0x80
+)
+
+// Universal tags used by Glow
+const (
+	tagBoolean     = 1
+	tagInteger     = 2
+	tagOctetString = 4
+	tagNull        = 5
+	tagReal        = 9
+	tagUTF8String  = 12
+	tagRelativeOID = 13
+	tagSequence    = 16
+	tagSet         = 17
+)
+
+// Nesting deeper than this is rejected when decoding
+const maxDepth = 64
+
+var errTruncated = errors.New("ember+: BER value truncated")
+
+type tag struct {
+	class  byte
+	number int
+}
+
+// tlv is a BER value. Constructed values hold children, primitive values hold data.
+type tlv struct {
+	tag         tag
+	constructed bool
+	data        []byte
+	children    []tlv
+}
+
+func universal(number int, data []byte) tlv {
+	return tlv{tag: tag{class: classUniversal, number: number}, data: data}
+}
+
+// context wraps a value in an explicit context tag
+func context(number int, v tlv) tlv {
+	return tlv{tag: tag{class: classContext, number: number}, constructed: true, children: []tlv{v}}
+}
+
+// application returns an implicitly tagged sequence or set
+func application(number int, children ...tlv) tlv {
+	return tlv{tag: tag{class: classApplication, number: number}, constructed: true, children: children}
+}
+
+func sequence(children ...tlv) tlv {
+	return tlv{tag: tag{class: classUniversal, number: tagSequence}, constructed: true, children: children}
+}
+
+func set(children ...tlv) tlv {
+	return tlv{tag: tag{class: classUniversal, number: tagSet}, constructed: true, children: children}
+}
+
+func integer(v int64) tlv {
+	data := binary.BigEndian.AppendUint64(nil, uint64(v))
+	// Drop leading bytes which only repeat the sign
+	for len(data) > 1 && (data[0] == 0x00 && data[1]&0x80 == 0 || data[0] == 0xff && data[1]&0x80 != 0) {
+		data = data[1:]
+	}
+	return universal(tagInteger, data)
+}
+
+func utf8String(s string) tlv {
+	return universal(tagUTF8String, []byte(s))
+}
+
+func boolean(b bool) tlv {
+	if b {
+		return universal(tagBoolean, []byte{0xff})
+	}
+	return universal(tagBoolean, []byte{0x00})
+}
+
+func relativeOID(path []int) tlv {
+	data := make([]byte, 0, len(path))
+	for _, n := range path {
+		data = appendBase128(data, uint64(uint32(n)))
+	}
+	return universal(tagRelativeOID, data)
+}
+
+func appendBase128(buf []byte, n uint64) []byte {
+	start := len(buf)
+	buf = append(buf, byte(n&0x7f))
+	for n >>= 7; n > 0; n >>= 7 {
+		buf = append(buf, byte(n&0x7f)|0x80)
+	}
+	// Digits were appended least significant first
+	for i, j := start, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return buf
+}
+
+// encode appends the value with definite lengths
+func (v tlv) encode(buf []byte) []byte {
+	content := v.data
+	if v.constructed {
+		content = nil
+		for _, child := range v.children {
+			content = child.encode(content)
+		}
+	}
+	first := v.tag.class
+	if v.constructed {
+		first |= 0x20
+	}
+	if v.tag.number < 0x1f {
+		buf = append(buf, first|byte(v.tag.number))
+	} else {
+		buf = appendBase128(append(buf, first|0x1f), uint64(v.tag.number))
+	}
+	buf = appendLength(buf, len(content))
+	return append(buf, content...)
+}
+
+func appendLength(buf []byte, length int) []byte {
+	if length < 0x80 {
+		return append(buf, byte(length))
+	}
+	n := 0
+	for l := length; l > 0; l >>= 8 {
+		n++
+	}
+	buf = append(buf, 0x80|byte(n))
+	for i := n - 1; i >= 0; i-- {
+		buf = append(buf, byte(length>>(8*i)))
+	}
+	return buf
+}
+
+// decode reads one value from data and returns the bytes after it. Indefinite lengths are accepted.
+func decode(data []byte) (tlv, []byte, error) {
+	return decodeDepth(data, 0)
+}
+
+func decodeDepth(data []byte, depth int) (tlv, []byte, error) {
+	v := tlv{}
+	if depth > maxDepth {
+		return v, nil, errors.New("ember+: BER value nested too deeply")
+	}
+	if len(data) < 2 {
+		return v, nil, errTruncated
+	}
+	v.tag.class = data[0] & 0xc0
+	v.constructed = data[0]&0x20 != 0
+	v.tag.number = int(data[0] & 0x1f)
+	data = data[1:]
+	if v.tag.number == 0x1f {
+		v.tag.number = 0
+		for {
+			if len(data) == 0 {
+				return v, nil, errTruncated
+			}
+			if v.tag.number > math.MaxInt32>>7 {
+				return v, nil, errors.New("ember+: BER tag number too large")
+			}
+			b := data[0]
+			data = data[1:]
+			v.tag.number = v.tag.number<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+	}
+	if len(data) == 0 {
+		return v, nil, errTruncated
+	}
+	lengthByte := data[0]
+	data = data[1:]
+	if lengthByte == 0x80 {
+		if !v.constructed {
+			return v, nil, errors.New("ember+: indefinite length on a primitive BER value")
+		}
+		// Children follow until an end of contents marker
+		for {
+			if len(data) >= 2 && data[0] == 0 && data[1] == 0 {
+				return v, data[2:], nil
+			}
+			child, rest, err := decodeDepth(data, depth+1)
+			if err != nil {
+				return v, nil, err
+			}
+			v.children = append(v.children, child)
+			data = rest
+		}
+	}
+	length := int(lengthByte)
+	if lengthByte > 0x80 {
+		n := int(lengthByte & 0x7f)
+		if n > 4 || len(data) < n {
+			return v, nil, errTruncated
+		}
+		length = 0
+		for _, b := range data[:n] {
+			length = length<<8 | int(b)
+		}
+		data = data[n:]
+	}
+	if length > len(data) {
+		return v, nil, errTruncated
+	}
+	content, rest := data[:length], data[length:]
+	if !v.constructed {
+		v.data = content
+		return v, rest, nil
+	}
+	for len(content) > 0 {
+		child, childRest, err := decodeDepth(content, depth+1)
+		if err != nil {
+			return v, nil, err
+		}
+		v.children = append(v.children, child)
+		content = childRest
+	}
+	return v, rest, nil
+}
+
+func (v tlv) is(class byte, number int) bool {
+	return v.tag.class == class && v.tag.number == number
+}
+
+// field returns the value inside the explicit context tag number of a sequence or set
+func (v tlv) field(number int) (tlv, bool) {
+	for _, child := range v.children {
+		if child.is(classContext, number) && len(child.children) == 1 {
+			return child.children[0], true
+		}
+	}
+	return tlv{}, false
+}
+
+func (v tlv) int() (int64, error) {
+	if v.constructed || len(v.data) == 0 || len(v.data) > 8 {
+		return 0, fmt.Errorf("ember+: invalid BER integer of %d bytes", len(v.data))
+	}
+	n := int64(int8(v.data[0]))
+	for _, b := range v.data[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+func (v tlv) string() (string, error) {
+	if v.constructed {
+		return "", errors.New("ember+: invalid BER UTF8String")
+	}
+	// Some devices send labels in other encodings
+	return strings.ToValidUTF8(string(v.data), string(utf8.RuneError)), nil
+}
+
+func (v tlv) bool() (bool, error) {
+	if v.constructed || len(v.data) != 1 {
+		return false, errors.New("ember+: invalid BER boolean")
+	}
+	return v.data[0] != 0, nil
+}
+
+func (v tlv) relativeOID() ([]int, error) {
+	path := make([]int, 0, len(v.data))
+	n := uint64(0)
+	for i, b := range v.data {
+		n = n<<7 | uint64(b&0x7f)
+		if n > math.MaxUint32 {
+			return nil, errors.New("ember+: BER relative OID component too large")
+		}
+		if b&0x80 == 0 {
+			path = append(path, int(int32(uint32(n))))
+			n = 0
+		} else if i == len(v.data)-1 {
+			return nil, errTruncated
+		}
+	}
+	return path, nil
+}
+
+// real decodes a binary encoded BER real
+func (v tlv) real() (float64, error) {
+	if len(v.data) == 0 {
+		return 0, nil
+	}
+	first := v.data[0]
+	if first&0x80 == 0 {
+		switch first {
+		case 0x40:
+			return math.Inf(1), nil
+		case 0x41:
+			return math.Inf(-1), nil
+		case 0x42:
+			return math.NaN(), nil
+		case 0x43:
+			return math.Copysign(0, -1), nil
+		}
+		return 0, errors.New("ember+: decimal BER reals are not supported")
+	}
+	base := 2
+	switch first & 0x30 {
+	case 0x10:
+		base = 8
+	case 0x20:
+		base = 16
+	case 0x30:
+		return 0, errors.New("ember+: invalid BER real base")
+	}
+	data := v.data[1:]
+	expLen := int(first&0x03) + 1
+	if first&0x03 == 0x03 {
+		if len(data) == 0 {
+			return 0, errTruncated
+		}
+		expLen = int(data[0])
+		data = data[1:]
+	}
+	if expLen == 0 || expLen > 8 || len(data) < expLen {
+		return 0, errTruncated
+	}
+	exp := int64(int8(data[0]))
+	for _, b := range data[1:expLen] {
+		exp = exp<<8 | int64(b)
+	}
+	mantissa := 0.0
+	for _, b := range data[expLen:] {
+		mantissa = mantissa*256 + float64(b)
+	}
+	mantissa *= math.Pow(2, float64((first>>2)&0x03))
+	f := mantissa * math.Pow(float64(base), float64(exp))
+	if first&0x40 != 0 {
+		f = -f
+	}
+	return f, nil
+}
+
+// value decodes a Glow Value choice
+func (v tlv) value() (any, error) {
+	if v.tag.class != classUniversal {
+		return nil, fmt.Errorf("ember+: unexpected BER tag %d in value", v.tag.number)
+	}
+	switch v.tag.number {
+	case tagInteger:
+		return v.int()
+	case tagReal:
+		return v.real()
+	case tagUTF8String:
+		return v.string()
+	case tagBoolean:
+		return v.bool()
+	case tagOctetString:
+		return v.data, nil
+	case tagNull:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("ember+: unexpected BER tag %d in value", v.tag.number)
+}
+
+// encodeValue encodes a Glow Value choice
+func encodeValue(value any) tlv {
+	switch val := value.(type) {
+	case string:
+		return utf8String(val)
+	case int:
+		return integer(int64(val))
+	case int64:
+		return integer(val)
+	case bool:
+		return boolean(val)
+	case []byte:
+		return universal(tagOctetString, val)
+	}
+	return universal(tagNull, nil)
+}
@@ -0,0 +1,277 @@
+package emberplus
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIntegerEncoding(t *testing.T) {
+	tests := []struct {
+		v    int64
+		want []byte
+	}{
+		{0, []byte{0x02, 0x01, 0x00}},
+		{1, []byte{0x02, 0x01, 0x01}},
+		{127, []byte{0x02, 0x01, 0x7f}},
+		{128, []byte{0x02, 0x02, 0x00, 0x80}},
+		{256, []byte{0x02, 0x02, 0x01, 0x00}},
+		{-1, []byte{0x02, 0x01, 0xff}},
+		{-128, []byte{0x02, 0x01, 0x80}},
+		{-129, []byte{0x02, 0x02, 0xff, 0x7f}},
+		{math.MaxInt64, []byte{0x02, 0x08, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{math.MinInt64, []byte{0x02, 0x08, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		got := integer(tt.v).encode(nil)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("integer(%d) = % x, want % x", tt.v, got, tt.want)
+		}
+		v, rest, err := decode(got)
+		if err != nil || len(rest) != 0 {
+			t.Fatalf("decode(% x): %v, %d bytes left", got, err, len(rest))
+		}
+		n, err := v.int()
+		if err != nil || n != tt.v {
+			t.Errorf("int() of % x = %d, %v, want %d", got, n, err, tt.v)
+		}
+	}
+}
+
+func TestRelativeOIDRoundTrip(t *testing.T) {
+	tests := []struct {
+		path []int
+		want []byte
+	}{
+		{[]int{}, []byte{0x0d, 0x00}},
+		{[]int{1, 2, 3}, []byte{0x0d, 0x03, 0x01, 0x02, 0x03}},
+		{[]int{127, 128}, []byte{0x0d, 0x03, 0x7f, 0x81, 0x00}},
+		{[]int{16384}, []byte{0x0d, 0x03, 0x81, 0x80, 0x00}},
+		{[]int{math.MaxInt32}, []byte{0x0d, 0x05, 0x87, 0xff, 0xff, 0xff, 0x7f}},
+	}
+	for _, tt := range tests {
+		got := relativeOID(tt.path).encode(nil)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("relativeOID(%v) = % x, want % x", tt.path, got, tt.want)
+		}
+		v, _, err := decode(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, err := v.relativeOID()
+		if err != nil || !slices.Equal(path, tt.path) {
+			t.Errorf("relativeOID() of % x = %v, %v, want %v", got, path, err, tt.path)
+		}
+	}
+
+	// The last component is cut short
+	_, err := universal(tagRelativeOID, []byte{0x01, 0x81}).relativeOID()
+	if !errors.Is(err, errTruncated) {
+		t.Errorf("truncated relative OID: %v", err)
+	}
+	_, err = universal(tagRelativeOID, []byte{0x90, 0x80, 0x80, 0x80, 0x00}).relativeOID()
+	if err == nil {
+		t.Error("relative OID component over 32 bits accepted")
+	}
+}
+
+func TestTagsAndLengths(t *testing.T) {
+	long := bytes.Repeat([]byte{'x'}, 300)
+	tests := []struct {
+		name   string
+		v      tlv
+		prefix []byte
+	}{
+		{"short", utf8String("abc"), []byte{0x0c, 0x03}},
+		{"one length byte", universal(tagOctetString, long[:200]), []byte{0x04, 0x81, 0xc8}},
+		{"two length bytes", universal(tagOctetString, long), []byte{0x04, 0x82, 0x01, 0x2c}},
+		{"tag 30", application(30), []byte{0x7e, 0x00}},
+		{"tag 31", application(31), []byte{0x7f, 0x1f, 0x00}},
+		{"tag 200", context(200, boolean(true)), []byte{0xbf, 0x81, 0x48, 0x03, 0x01, 0x01, 0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := tt.v.encode(nil)
+			if !bytes.HasPrefix(encoded, tt.prefix) {
+				t.Fatalf("encoded % x, want prefix % x", encoded[:min(len(encoded), 8)], tt.prefix)
+			}
+			decoded, rest, err := decode(encoded)
+			if err != nil || len(rest) != 0 {
+				t.Fatalf("decode: %v, %d bytes left", err, len(rest))
+			}
+			if !bytes.Equal(decoded.encode(nil), encoded) {
+				t.Errorf("round trip changed the encoding")
+			}
+			if decoded.tag != tt.v.tag || decoded.constructed != tt.v.constructed {
+				t.Errorf("decoded tag %+v constructed %v, want %+v %v", decoded.tag, decoded.constructed, tt.v.tag, tt.v.constructed)
+			}
+		})
+	}
+}
+
+func TestDecodeIndefiniteLength(t *testing.T) {
+	data := []byte{
+		0x60, 0x80, // Application 0, indefinite
+		0x02, 0x01, 0x05,
+		0x30, 0x80, // Sequence, indefinite
+		0x0c, 0x02, 'h', 'i',
+		0x00, 0x00,
+		0x00, 0x00,
+		0xaa, // After the value
+	}
+	v, rest, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, []byte{0xaa}) {
+		t.Errorf("rest = % x", rest)
+	}
+	if !v.is(classApplication, 0) || len(v.children) != 2 {
+		t.Fatalf("decoded %+v", v)
+	}
+	if n, _ := v.children[0].int(); n != 5 {
+		t.Errorf("first child = %d", n)
+	}
+	inner := v.children[1]
+	if !inner.is(classUniversal, tagSequence) || len(inner.children) != 1 {
+		t.Fatalf("inner %+v", inner)
+	}
+	if s, _ := inner.children[0].string(); s != "hi" {
+		t.Errorf("inner child = %q", s)
+	}
+	// Encoding always uses definite lengths
+	want := []byte{0x60, 0x09, 0x02, 0x01, 0x05, 0x30, 0x04, 0x0c, 0x02, 'h', 'i'}
+	if got := v.encode(nil); !bytes.Equal(got, want) {
+		t.Errorf("encode = % x, want % x", got, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x30, 0x80}, maxDepth+2)
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, errTruncated.Error()},
+		{"tag only", []byte{0x02}, errTruncated.Error()},
+		{"short content", []byte{0x02, 0x02, 0x01}, errTruncated.Error()},
+		{"length past the end", []byte{0x04, 0x81, 0x10, 0x00}, errTruncated.Error()},
+		{"long tag cut short", []byte{0x7f, 0x81}, errTruncated.Error()},
+		{"long length cut short", []byte{0x04, 0x82, 0x01}, errTruncated.Error()},
+		{"five length bytes", []byte{0x04, 0x85, 0, 0, 0, 0, 1, 0}, errTruncated.Error()},
+		{"child past the parent", []byte{0x30, 0x03, 0x02, 0x05, 0x01}, errTruncated.Error()},
+		{"no end of contents", []byte{0x30, 0x80, 0x02, 0x01, 0x01}, errTruncated.Error()},
+		{"indefinite primitive", []byte{0x04, 0x80, 0x00, 0x00}, "indefinite length on a primitive"},
+		{"tag number too large", []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0x7f, 0x00}, "tag number too large"},
+		{"nested too deeply", deep, "nested too deeply"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decode(tt.data)
+			if err == nil {
+				t.Fatal("decode succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("decode error %q, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecodeTrailingData(t *testing.T) {
+	data := append(integer(7).encode(nil), utf8String("next").encode(nil)...)
+	v, rest, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := v.int(); n != 7 {
+		t.Errorf("first = %d", n)
+	}
+	v, rest, err = decode(rest)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("second: %v, %d bytes left", err, len(rest))
+	}
+	if s, _ := v.string(); s != "next" {
+		t.Errorf("second = %q", s)
+	}
+}
+
+func TestPrimitiveErrors(t *testing.T) {
+	if _, err := universal(tagInteger, nil).int(); err == nil {
+		t.Error("empty integer accepted")
+	}
+	if _, err := universal(tagInteger, make([]byte, 9)).int(); err == nil {
+		t.Error("9 byte integer accepted")
+	}
+	if _, err := universal(tagBoolean, []byte{1, 1}).bool(); err == nil {
+		t.Error("2 byte boolean accepted")
+	}
+	if s, _ := universal(tagUTF8String, []byte{'a', 0xff, 'b'}).string(); s != "a�b" {
+		t.Errorf("invalid UTF-8 = %q", s)
+	}
+}
+
+func TestReal(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want float64
+	}{
+		{"zero", nil, 0},
+		{"one", []byte{0x80, 0x00, 0x01}, 1},
+		{"negative with scale", []byte{0xc4, 0x01, 0x03}, -12},
+		{"fraction", []byte{0x80, 0xff, 0x01}, 0.5},
+		{"base 16", []byte{0xa0, 0x01, 0x02}, 32},
+		{"long exponent", []byte{0x83, 0x02, 0x00, 0x0a, 0x01}, 1024},
+		{"infinity", []byte{0x40}, math.Inf(1)},
+		{"minus infinity", []byte{0x41}, math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		got, err := universal(tagReal, tt.data).real()
+		if err != nil || got != tt.want {
+			t.Errorf("%s: real() = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+	if f, _ := universal(tagReal, []byte{0x42}).real(); !math.IsNaN(f) {
+		t.Errorf("NaN = %v", f)
+	}
+	if f, _ := universal(tagReal, []byte{0x43}).real(); f != 0 || !math.Signbit(f) {
+		t.Errorf("minus zero = %v", f)
+	}
+	for name, data := range map[string][]byte{
+		"decimal":         {0x01, '1'},
+		"reserved base":   {0xb0, 0x01, 0x01},
+		"no exponent":     {0x81, 0x01},
+		"no length octet": {0x83},
+	} {
+		if _, err := universal(tagReal, data).real(); err == nil {
+			t.Errorf("%s real accepted", name)
+		}
+	}
+}
+
+func TestValueRoundTrip(t *testing.T) {
+	for _, value := range []any{"label", int64(-42), true, false, []byte{1, 2, 0xff}, nil} {
+		encoded := encodeValue(value).encode(nil)
+		v, _, err := decode(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := v.value()
+		if err != nil || !reflect.DeepEqual(got, value) {
+			t.Errorf("value %#v decoded as %#v, %v", value, got, err)
+		}
+	}
+	// Ints are encoded like int64
+	if got := encodeValue(7).encode(nil); !bytes.Equal(got, integer(7).encode(nil)) {
+		t.Errorf("int encoded as % x", got)
+	}
+	if _, err := application(1).value(); err == nil {
+		t.Error("application tag accepted as a value")
+	}
+}
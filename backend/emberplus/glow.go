@@ -0,0 +1,511 @@
+// Package emberplus speaks Ember+: Glow elements encoded with BER and framed with S101 over TCP.
+// Provider publishes routers as matrices to consumers such as mixing consoles.
+package emberplus
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Glow application tags
+const (
+	appRoot                  = 0
+	appParameter             = 1
+	appCommand               = 2
+	appNode                  = 3
+	appElementCollection     = 4
+	appQualifiedParameter    = 9
+	appQualifiedNode         = 10
+	appRootElementCollection = 11
+	appMatrix                = 13
+	appTarget                = 14
+	appSource                = 15
+	appConnection            = 16
+	appQualifiedMatrix       = 17
+	appLabel                 = 18
+	appFunction              = 19
+	appQualifiedFunction     = 20
+)
+
+// Command numbers
+const (
+	CommandSubscribe    = 30
+	CommandUnsubscribe  = 31
+	CommandGetDirectory = 32
+	CommandInvoke       = 33
+)
+
+// Field mask asking for every field of the elements in a directory
+const fieldFlagsAll = -1
+
+// Parameter access
+const (
+	AccessNone      = 0
+	AccessRead      = 1
+	AccessWrite     = 2
+	AccessReadWrite = 3
+)
+
+// Parameter types
+const (
+	parameterTypeInteger = 1
+	parameterTypeString  = 3
+	parameterTypeBoolean = 4
+	parameterTypeOctets  = 7
+)
+
+// Matrix types and addressing modes
+const (
+	MatrixOneToN        = 0
+	MatrixOneToOne      = 1
+	MatrixNToN          = 2
+	AddressingLinear    = 0
+	AddressingNonLinear = 1
+)
+
+// Connection operations and dispositions
+const (
+	OperationAbsolute   = 0
+	OperationConnect    = 1
+	OperationDisconnect = 2
+
+	DispositionTally    = 0
+	DispositionModified = 1
+	DispositionPending  = 2
+	DispositionLocked   = 3
+)
+
+type ElementType int
+
+const (
+	ElementNode ElementType = iota + 1
+	ElementParameter
+	ElementMatrix
+	ElementFunction
+	ElementCommand
+)
+
+// Label points a matrix at the node holding its target and source labels
+type Label struct {
+	BasePath    []int
+	Description string
+}
+
+// Connection is the sources connected to a matrix target
+type Connection struct {
+	Target      int
+	Sources     []int
+	Operation   int
+	Disposition int
+}
+
+// Element is a node, parameter, matrix, function or command in a Glow message.
+// Path is the full path from the root. A command has the path of the element it applies to.
+type Element struct {
+	Type        ElementType
+	Path        []int
+	Contents    bool // Identifier and the other contents are set
+	Identifier  string
+	Description string
+	IsOnline    bool
+	// Parameters
+	Value  any // string, int64, float64, bool, []byte or nil. Reals are only decoded.
+	Access int
+	// Matrices
+	MatrixType           int
+	AddressingMode       int
+	TargetCount          int
+	SourceCount          int
+	MaxConnectsPerTarget int
+	Labels               []Label
+	Targets              []int
+	Sources              []int
+	Connections          []Connection
+	// Commands
+	Command int
+	// Elements inside this one
+	Children []*Element
+}
+
+// Number returns the element's number within its parent
+func (e *Element) Number() int {
+	if len(e.Path) == 0 {
+		return 0
+	}
+	return e.Path[len(e.Path)-1]
+}
+
+// Walk calls fn for every element and its children, parents first
+func Walk(elements []*Element, fn func(*Element)) {
+	for _, el := range elements {
+		fn(el)
+		Walk(el.Children, fn)
+	}
+}
+
+// EncodeRoot encodes elements as a Glow root. Top level elements are qualified with their path.
+func EncodeRoot(elements []*Element) []byte {
+	items := make([]tlv, 0, len(elements))
+	for _, el := range elements {
+		items = append(items, context(0, encodeElement(el, true)))
+	}
+	return application(appRoot, application(appRootElementCollection, items...)).encode(nil)
+}
+
+func encodeElement(el *Element, qualified bool) tlv {
+	if el.Type == ElementCommand {
+		fields := []tlv{context(0, integer(int64(el.Command)))}
+		if el.Command == CommandGetDirectory {
+			fields = append(fields, context(1, integer(fieldFlagsAll)))
+		}
+		return application(appCommand, fields...)
+	}
+	var tagNumber int
+	switch el.Type {
+	case ElementNode:
+		tagNumber = appNode
+		if qualified {
+			tagNumber = appQualifiedNode
+		}
+	case ElementParameter:
+		tagNumber = appParameter
+		if qualified {
+			tagNumber = appQualifiedParameter
+		}
+	case ElementMatrix:
+		tagNumber = appMatrix
+		if qualified {
+			tagNumber = appQualifiedMatrix
+		}
+	case ElementFunction:
+		tagNumber = appFunction
+		if qualified {
+			tagNumber = appQualifiedFunction
+		}
+	}
+	fields := make([]tlv, 0, 6)
+	if qualified {
+		fields = append(fields, context(0, relativeOID(el.Path)))
+	} else {
+		fields = append(fields, context(0, integer(int64(el.Number()))))
+	}
+	if el.Contents {
+		fields = append(fields, context(1, set(encodeContents(el)...)))
+	}
+	if len(el.Children) > 0 {
+		children := make([]tlv, 0, len(el.Children))
+		for _, child := range el.Children {
+			children = append(children, context(0, encodeElement(child, false)))
+		}
+		fields = append(fields, context(2, application(appElementCollection, children...)))
+	}
+	if el.Type == ElementMatrix {
+		if el.Targets != nil {
+			fields = append(fields, context(3, encodeSignals(appTarget, el.Targets)))
+		}
+		if el.Sources != nil {
+			fields = append(fields, context(4, encodeSignals(appSource, el.Sources)))
+		}
+		if el.Connections != nil {
+			conns := make([]tlv, 0, len(el.Connections))
+			for _, conn := range el.Connections {
+				connFields := []tlv{context(0, integer(int64(conn.Target))), context(1, relativeOID(conn.Sources))}
+				if conn.Operation != OperationAbsolute {
+					connFields = append(connFields, context(2, integer(int64(conn.Operation))))
+				}
+				if conn.Disposition != DispositionTally {
+					connFields = append(connFields, context(3, integer(int64(conn.Disposition))))
+				}
+				conns = append(conns, context(0, application(appConnection, connFields...)))
+			}
+			fields = append(fields, context(5, sequence(conns...)))
+		}
+	}
+	return application(tagNumber, fields...)
+}
+
+func encodeContents(el *Element) []tlv {
+	contents := []tlv{context(0, utf8String(el.Identifier))}
+	if el.Description != "" {
+		contents = append(contents, context(1, utf8String(el.Description)))
+	}
+	switch el.Type {
+	case ElementNode:
+		contents = append(contents, context(3, boolean(el.IsOnline)))
+	case ElementParameter:
+		if el.Value != nil {
+			contents = append(contents, context(2, encodeValue(el.Value)))
+		}
+		contents = append(contents, context(5, integer(int64(el.Access))))
+		contents = append(contents, context(9, boolean(el.IsOnline)))
+		switch el.Value.(type) {
+		case string:
+			contents = append(contents, context(13, integer(parameterTypeString)))
+		case int, int64:
+			contents = append(contents, context(13, integer(parameterTypeInteger)))
+		case bool:
+			contents = append(contents, context(13, integer(parameterTypeBoolean)))
+		case []byte:
+			contents = append(contents, context(13, integer(parameterTypeOctets)))
+		}
+	case ElementMatrix:
+		contents = append(contents,
+			context(2, integer(int64(el.MatrixType))),
+			context(3, integer(int64(el.AddressingMode))),
+			context(4, integer(int64(el.TargetCount))),
+			context(5, integer(int64(el.SourceCount))),
+		)
+		if el.MaxConnectsPerTarget > 0 {
+			contents = append(contents, context(7, integer(int64(el.MaxConnectsPerTarget))))
+		}
+		if len(el.Labels) > 0 {
+			labels := make([]tlv, 0, len(el.Labels))
+			for _, label := range el.Labels {
+				labels = append(labels, context(0, application(appLabel, context(0, relativeOID(label.BasePath)), context(1, utf8String(label.Description)))))
+			}
+			contents = append(contents, context(10, sequence(labels...)))
+		}
+	}
+	return contents
+}
+
+func encodeSignals(tagNumber int, numbers []int) tlv {
+	signals := make([]tlv, 0, len(numbers))
+	for _, n := range numbers {
+		signals = append(signals, context(0, application(tagNumber, context(0, integer(int64(n))))))
+	}
+	return sequence(signals...)
+}
+
+// DecodeRoot decodes a Glow root. Streams and invocation results are ignored.
+func DecodeRoot(data []byte) ([]*Element, error) {
+	root, _, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if !root.is(classApplication, appRoot) || len(root.children) != 1 {
+		return nil, errors.New("ember+: message is not a Glow root")
+	}
+	collection := root.children[0]
+	if !collection.is(classApplication, appRootElementCollection) {
+		return nil, nil
+	}
+	elements := make([]*Element, 0, len(collection.children))
+	for _, item := range collection.children {
+		if !item.is(classContext, 0) || len(item.children) != 1 {
+			continue
+		}
+		el, err := decodeElement(item.children[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		if el != nil {
+			elements = append(elements, el)
+		}
+	}
+	return elements, nil
+}
+
+// fields reads the explicitly tagged fields of a sequence or set, keeping the first error
+type fields struct {
+	v   tlv
+	err error
+}
+
+func (f *fields) int(number int, def int) int {
+	v, ok := f.v.field(number)
+	if !ok || f.err != nil {
+		return def
+	}
+	n, err := v.int()
+	f.err = err
+	return int(n)
+}
+
+func (f *fields) string(number int) string {
+	v, ok := f.v.field(number)
+	if !ok || f.err != nil {
+		return ""
+	}
+	s, err := v.string()
+	f.err = err
+	return s
+}
+
+func (f *fields) bool(number int, def bool) bool {
+	v, ok := f.v.field(number)
+	if !ok || f.err != nil {
+		return def
+	}
+	b, err := v.bool()
+	f.err = err
+	return b
+}
+
+func (f *fields) path(number int) []int {
+	v, ok := f.v.field(number)
+	if !ok || f.err != nil {
+		return nil
+	}
+	path, err := v.relativeOID()
+	f.err = err
+	return path
+}
+
+func decodeElement(v tlv, parent []int) (*Element, error) {
+	if v.tag.class != classApplication {
+		return nil, fmt.Errorf("ember+: unexpected tag %d in element collection", v.tag.number)
+	}
+	el := &Element{IsOnline: true}
+	qualified := false
+	switch v.tag.number {
+	case appCommand:
+		el.Type = ElementCommand
+		el.Path = parent
+		f := fields{v: v}
+		el.Command = f.int(0, 0)
+		return el, f.err
+	case appNode:
+		el.Type = ElementNode
+	case appQualifiedNode:
+		el.Type = ElementNode
+		qualified = true
+	case appParameter:
+		el.Type = ElementParameter
+	case appQualifiedParameter:
+		el.Type = ElementParameter
+		qualified = true
+	case appMatrix:
+		el.Type = ElementMatrix
+	case appQualifiedMatrix:
+		el.Type = ElementMatrix
+		qualified = true
+	case appFunction:
+		el.Type = ElementFunction
+	case appQualifiedFunction:
+		el.Type = ElementFunction
+		qualified = true
+	default:
+		// Templates and anything newer
+		return nil, nil
+	}
+	f := fields{v: v}
+	if qualified {
+		el.Path = f.path(0)
+	} else {
+		el.Path = append(slices.Clone(parent), f.int(0, 0))
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	if contents, ok := v.field(1); ok {
+		err := decodeContents(el, contents)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if children, ok := v.field(2); ok {
+		for _, item := range children.children {
+			if !item.is(classContext, 0) || len(item.children) != 1 {
+				continue
+			}
+			child, err := decodeElement(item.children[0], el.Path)
+			if err != nil {
+				return nil, err
+			}
+			if child != nil {
+				el.Children = append(el.Children, child)
+			}
+		}
+	}
+	if el.Type != ElementMatrix {
+		return el, nil
+	}
+	var err error
+	if targets, ok := v.field(3); ok {
+		el.Targets, err = decodeSignals(targets, appTarget)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if sources, ok := v.field(4); ok {
+		el.Sources, err = decodeSignals(sources, appSource)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conns, ok := v.field(5); ok {
+		el.Connections = make([]Connection, 0, len(conns.children))
+		for _, item := range conns.children {
+			if !item.is(classContext, 0) || len(item.children) != 1 || !item.children[0].is(classApplication, appConnection) {
+				continue
+			}
+			cf := fields{v: item.children[0]}
+			conn := Connection{
+				Target:      cf.int(0, 0),
+				Sources:     cf.path(1),
+				Operation:   cf.int(2, OperationAbsolute),
+				Disposition: cf.int(3, DispositionTally),
+			}
+			if cf.err != nil {
+				return nil, cf.err
+			}
+			el.Connections = append(el.Connections, conn)
+		}
+	}
+	return el, nil
+}
+
+func decodeContents(el *Element, v tlv) error {
+	el.Contents = true
+	f := fields{v: v}
+	el.Identifier = f.string(0)
+	el.Description = f.string(1)
+	switch el.Type {
+	case ElementNode:
+		el.IsOnline = f.bool(3, true)
+	case ElementParameter:
+		if value, ok := v.field(2); ok && f.err == nil {
+			el.Value, f.err = value.value()
+		}
+		el.Access = f.int(5, AccessRead)
+		el.IsOnline = f.bool(9, true)
+	case ElementMatrix:
+		el.MatrixType = f.int(2, MatrixOneToN)
+		el.AddressingMode = f.int(3, AddressingLinear)
+		el.TargetCount = f.int(4, 0)
+		el.SourceCount = f.int(5, 0)
+		el.MaxConnectsPerTarget = f.int(7, 0)
+		if labels, ok := v.field(10); ok {
+			for _, item := range labels.children {
+				if !item.is(classContext, 0) || len(item.children) != 1 || !item.children[0].is(classApplication, appLabel) {
+					continue
+				}
+				lf := fields{v: item.children[0]}
+				label := Label{BasePath: lf.path(0), Description: lf.string(1)}
+				if lf.err != nil {
+					return lf.err
+				}
+				el.Labels = append(el.Labels, label)
+			}
+		}
+	}
+	return f.err
+}
+
+func decodeSignals(v tlv, tagNumber int) ([]int, error) {
+	numbers := make([]int, 0, len(v.children))
+	for _, item := range v.children {
+		if !item.is(classContext, 0) || len(item.children) != 1 || !item.children[0].is(classApplication, tagNumber) {
+			continue
+		}
+		f := fields{v: item.children[0]}
+		n := f.int(0, 0)
+		if f.err != nil {
+			return nil, f.err
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, nil
+}
@@ -0,0 +1,166 @@
+package emberplus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeGetDirectory(t *testing.T) {
+	// GetDirectory on the root, as sent by most consumers
+	got := EncodeRoot([]*Element{{Type: ElementCommand, Command: CommandGetDirectory}})
+	want, _ := hex.DecodeString("60106b0ea00c620aa003020120a1030201ff")
+	if !bytes.Equal(got, want) {
+		t.Errorf("EncodeRoot = % x, want % x", got, want)
+	}
+}
+
+func TestGlowRoundTrip(t *testing.T) {
+	elements := []*Element{
+		{
+			Type:        ElementNode,
+			Path:        []int{1},
+			Contents:    true,
+			Identifier:  "router",
+			Description: "Main router",
+			IsOnline:    true,
+			Children: []*Element{
+				{Type: ElementParameter, Path: []int{1, 1}, Contents: true, Identifier: "name", Value: "Studio ä", Access: AccessReadWrite, IsOnline: true},
+				{Type: ElementParameter, Path: []int{1, 3}, Contents: true, Identifier: "count", Value: int64(-70000), Access: AccessRead, IsOnline: false},
+				{Type: ElementParameter, Path: []int{1, 4}, Contents: true, Identifier: "enabled", Value: true, Access: AccessRead, IsOnline: true},
+				{Type: ElementParameter, Path: []int{1, 5}, Contents: true, Identifier: "blob", Value: []byte{0, 0xff}, Access: AccessNone, IsOnline: true},
+				{Type: ElementParameter, Path: []int{1, 6}, Contents: true, Identifier: "empty", Access: AccessRead, IsOnline: true},
+				{Type: ElementNode, Path: []int{1, 7}, IsOnline: true},
+			},
+		},
+		{
+			Type:                 ElementMatrix,
+			Path:                 []int{1, 2},
+			Contents:             true,
+			Identifier:           "video",
+			Description:          "VIDEO",
+			IsOnline:             true,
+			MatrixType:           MatrixOneToN,
+			AddressingMode:       AddressingNonLinear,
+			TargetCount:          3,
+			SourceCount:          2,
+			MaxConnectsPerTarget: 1,
+			Labels:               []Label{{BasePath: []int{1, 2, 1000}, Description: "Primary"}},
+			Targets:              []int{0, 5, 200},
+			Sources:              []int{1, 65536},
+			Connections: []Connection{
+				{Target: 0, Sources: []int{1}, Operation: OperationAbsolute, Disposition: DispositionTally},
+				{Target: 5, Sources: []int{}, Operation: OperationDisconnect, Disposition: DispositionModified},
+				{Target: 200, Sources: []int{65536}, Operation: OperationConnect, Disposition: DispositionLocked},
+			},
+		},
+		{
+			// A command is encoded inside the element it applies to
+			Type:     ElementMatrix,
+			Path:     []int{1, 9},
+			IsOnline: true,
+			Children: []*Element{{Type: ElementCommand, Path: []int{1, 9}, Command: CommandSubscribe, IsOnline: true}},
+		},
+		{Type: ElementFunction, Path: []int{2}, Contents: true, Identifier: "reset", IsOnline: true},
+	}
+	encoded := EncodeRoot(elements)
+	decoded, err := DecodeRoot(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(elements) {
+		t.Fatalf("decoded %d elements, want %d", len(decoded), len(elements))
+	}
+	for i := range elements {
+		if !reflect.DeepEqual(decoded[i], elements[i]) {
+			t.Errorf("element %d:\n got %+v\nwant %+v", i, decoded[i], elements[i])
+		}
+	}
+	if again := EncodeRoot(decoded); !bytes.Equal(again, encoded) {
+		t.Error("encoding the decoded elements changed the bytes")
+	}
+
+	paths := make([]string, 0)
+	Walk(decoded, func(el *Element) { paths = append(paths, fmt.Sprint(el.Path)) })
+	if got := strings.Join(paths, " "); got != "[1] [1 1] [1 3] [1 4] [1 5] [1 6] [1 7] [1 2] [1 9] [1 9] [2]" {
+		t.Errorf("Walk order %s", got)
+	}
+}
+
+func TestDecodeLinearMatrixDefaults(t *testing.T) {
+	// Only the required contents, so the optional fields take their defaults
+	matrix := application(appQualifiedMatrix,
+		context(0, relativeOID([]int{3})),
+		context(1, set(context(0, utf8String("m")), context(4, integer(2)), context(5, integer(4)))),
+	)
+	data := application(appRoot, application(appRootElementCollection, context(0, matrix))).encode(nil)
+	elements, err := DecodeRoot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	el := elements[0]
+	if el.MatrixType != MatrixOneToN || el.AddressingMode != AddressingLinear || el.TargetCount != 2 || el.SourceCount != 4 {
+		t.Errorf("decoded %+v", el)
+	}
+	if el.Targets != nil || el.Sources != nil || el.Connections != nil {
+		t.Errorf("signals %v %v %v, want none", el.Targets, el.Sources, el.Connections)
+	}
+}
+
+func TestDecodeRootSkipsUnknown(t *testing.T) {
+	template := application(24, context(0, integer(1)))
+	node := application(appQualifiedNode, context(0, relativeOID([]int{1})))
+	data := application(appRoot, application(appRootElementCollection, context(0, template), context(0, node), context(1, node))).encode(nil)
+	elements, err := DecodeRoot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elements) != 1 || elements[0].Type != ElementNode {
+		t.Errorf("decoded %+v, want only the node", elements)
+	}
+
+	// Streams and invocation results are not element collections
+	data = application(appRoot, application(6)).encode(nil)
+	elements, err = DecodeRoot(data)
+	if err != nil || elements != nil {
+		t.Errorf("stream root decoded as %v, %v", elements, err)
+	}
+}
+
+func TestDecodeRootErrors(t *testing.T) {
+	node := application(appQualifiedNode, context(0, relativeOID([]int{1})))
+	valid := application(appRoot, application(appRootElementCollection, context(0, node))).encode(nil)
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"not a root", application(appNode).encode(nil), "not a Glow root"},
+		{"empty root", application(appRoot).encode(nil), "not a Glow root"},
+		{"truncated", valid[:len(valid)-1], "truncated"},
+		{"bad element tag", application(appRoot, application(appRootElementCollection, context(0, integer(1)))).encode(nil), "unexpected tag"},
+		{"bad path", application(appRoot, application(appRootElementCollection, context(0,
+			application(appQualifiedNode, context(0, universal(tagRelativeOID, []byte{0x81}))),
+		))).encode(nil), "truncated"},
+		{"bad identifier", application(appRoot, application(appRootElementCollection, context(0,
+			application(appQualifiedNode, context(0, relativeOID([]int{1})), context(1, set(context(0, set())))),
+		))).encode(nil), "UTF8String"},
+		{"bad connection", application(appRoot, application(appRootElementCollection, context(0,
+			application(appQualifiedMatrix, context(0, relativeOID([]int{1})), context(5, sequence(context(0, application(appConnection, context(0, universal(tagInteger, nil))))))),
+		))).encode(nil), "integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeRoot(tt.data)
+			if err == nil {
+				t.Fatal("DecodeRoot succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("DecodeRoot error %q, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
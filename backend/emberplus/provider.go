@@ -0,0 +1,499 @@
+package emberplus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cassaram/bfc/backend/router"
+)
+
+// Router is a router published by the provider
+type Router struct {
+	ID          int
+	Identifier  string
+	Description string
+	Router      router.Router
+}
+
+// Numbers of the nodes below a router node, and below a level's labels node
+const (
+	nodeMatrices = 1
+	nodeLabels   = 2
+	nodeTargets  = 1
+	nodeSources  = 2
+)
+
+// Messages queued for a consumer before it is considered stuck and disconnected
+const clientQueueLength = 256
+
+// Provider publishes routers to Ember+ consumers. The tree holds a node per router, numbered by router ID:
+//
+//	<router>/1/<level>            matrix per level, targets and sources numbered by destination and source ID
+//	<router>/2/<level>/1/<dest>   destination name parameters, the matrix's target labels
+//	<router>/2/<level>/2/<src>    source name parameters, the matrix's source labels
+//
+// Crosspoint changes are sent to every connected consumer.
+type Provider struct {
+	// Routers returns the routers to publish
+	Routers func() []Router
+	// Route is called for connection requests with the consumer's address. Follow only routers are routed with -1 levels.
+	Route        func(consumer string, routerID int, destID int, destLevelID int, srcID int, srcLevelID int) error
+	listener     net.Listener
+	clients      map[*providerClient]bool
+	clientsMutex sync.Mutex
+}
+
+type providerClient struct {
+	conn      *Conn
+	send      chan []byte
+	done      chan bool // Closed when the consumer is disconnected
+	closeOnce sync.Once
+}
+
+// Listen starts accepting consumers on a TCP address
+func (p *Provider) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	p.clientsMutex.Lock()
+	p.listener = listener
+	p.clients = make(map[*providerClient]bool)
+	p.clientsMutex.Unlock()
+	log.Info("Ember+ Provider: Listening on ", listener.Addr())
+	go p.accept(listener)
+	return nil
+}
+
+// Close stops listening and disconnects every consumer
+func (p *Provider) Close() error {
+	p.clientsMutex.Lock()
+	listener := p.listener
+	clients := make([]*providerClient, 0, len(p.clients))
+	for c := range p.clients {
+		clients = append(clients, c)
+	}
+	p.clientsMutex.Unlock()
+	for _, c := range clients {
+		p.disconnect(c)
+	}
+	if listener == nil {
+		return nil
+	}
+	return listener.Close()
+}
+
+func (p *Provider) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Error("Ember+ Provider: ", err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+		c := &providerClient{
+			conn: NewConn(conn),
+			send: make(chan []byte, clientQueueLength),
+			done: make(chan bool),
+		}
+		p.clientsMutex.Lock()
+		p.clients[c] = true
+		p.clientsMutex.Unlock()
+		log.Info("Ember+ Provider: Consumer connected from ", conn.RemoteAddr())
+		go p.writeLoop(c)
+		go p.readLoop(c)
+	}
+}
+
+// disconnect closes a consumer's connection. It is safe to call more than once.
+func (p *Provider) disconnect(c *providerClient) {
+	c.closeOnce.Do(func() {
+		p.clientsMutex.Lock()
+		delete(p.clients, c)
+		p.clientsMutex.Unlock()
+		close(c.done)
+		c.conn.Close()
+		log.Info("Ember+ Provider: Consumer disconnected from ", c.conn.RemoteAddr())
+	})
+}
+
+func (p *Provider) readLoop(c *providerClient) {
+	defer p.disconnect(c)
+	for {
+		payload, err := c.conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Error("Ember+ Provider: ", err.Error())
+			}
+			return
+		}
+		elements, err := DecodeRoot(payload)
+		if err != nil {
+			log.Warnf("Ember+ Provider: %s: %s", c.conn.RemoteAddr(), err.Error())
+			continue
+		}
+		for _, reply := range p.handle(c.conn.RemoteAddr().String(), elements) {
+			p.queue(c, reply)
+		}
+	}
+}
+
+func (p *Provider) writeLoop(c *providerClient) {
+	for {
+		select {
+		case message := <-c.send:
+			err := c.conn.WriteMessage(message)
+			if err != nil {
+				log.Error("Ember+ Provider: ", err.Error())
+				p.disconnect(c)
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// queue sends a message to a consumer without waiting. Consumers which fall behind are disconnected.
+func (p *Provider) queue(c *providerClient, message []byte) {
+	select {
+	case c.send <- message:
+	default:
+		log.Warnf("Ember+ Provider: %s is not keeping up, disconnecting", c.conn.RemoteAddr())
+		go p.disconnect(c)
+	}
+}
+
+// NotifyCrosspoint sends a crosspoint change to every consumer. Only call it for published routers.
+func (p *Provider) NotifyCrosspoint(routerID int, xpt router.Crosspoint) {
+	p.clientsMutex.Lock()
+	clients := make([]*providerClient, 0, len(p.clients))
+	for c := range p.clients {
+		clients = append(clients, c)
+	}
+	p.clientsMutex.Unlock()
+	if len(clients) == 0 {
+		return
+	}
+	message := EncodeRoot([]*Element{{
+		Type:        ElementMatrix,
+		Path:        []int{routerID, nodeMatrices, xpt.DestinationLevel},
+		Connections: []Connection{crosspointConnection(xpt)},
+	}})
+	for _, c := range clients {
+		p.queue(c, message)
+	}
+}
+
+// handle answers the commands and connection requests in a message from a consumer
+func (p *Provider) handle(consumer string, elements []*Element) [][]byte {
+	replies := make([][]byte, 0)
+	Walk(elements, func(el *Element) {
+		var reply []*Element
+		switch {
+		case el.Type == ElementCommand && el.Command == CommandGetDirectory:
+			reply = p.directory(el.Path)
+		case el.Type == ElementMatrix && len(el.Connections) > 0:
+			reply = p.connect(consumer, el.Path, el.Connections)
+		}
+		// Subscriptions aren't needed, every consumer gets every change
+		if len(reply) > 0 {
+			replies = append(replies, EncodeRoot(reply))
+		}
+	})
+	return replies
+}
+
+func findRouter(routers []Router, routerID int) (Router, bool) {
+	idx := slices.IndexFunc(routers, func(rtr Router) bool {
+		return rtr.ID == routerID
+	})
+	if idx == -1 {
+		return Router{}, false
+	}
+	return routers[idx], true
+}
+
+// identifier makes a name safe to use as an element identifier
+func identifier(name string, fallback string) string {
+	id := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' {
+			return r
+		}
+		return '_'
+	}, name)
+	if id == "" {
+		return fallback
+	}
+	return id
+}
+
+func node(path []int, ident string, description string, online bool) *Element {
+	return &Element{Type: ElementNode, Path: path, Contents: true, Identifier: ident, Description: description, IsOnline: online}
+}
+
+func routerNode(rtr Router) *Element {
+	state := rtr.Router.GetStatus().State
+	online := state == router.StateReady || state == router.StateSyncing
+	return node([]int{rtr.ID}, identifier(rtr.Identifier, fmt.Sprintf("router-%d", rtr.ID)), rtr.Description, online)
+}
+
+func hasLevel(levels []int, lvlID int) bool {
+	// Items without levels are on every level
+	return len(levels) == 0 || slices.Contains(levels, lvlID)
+}
+
+// levelSignals returns the destinations and sources on a level
+func levelSignals(rtr router.Router, lvlID int) ([]router.Destination, []router.Source) {
+	dests := make([]router.Destination, 0)
+	for _, dest := range rtr.GetDestinations() {
+		if hasLevel(dest.Levels, lvlID) {
+			dests = append(dests, dest)
+		}
+	}
+	srcs := make([]router.Source, 0)
+	for _, src := range rtr.GetSources() {
+		if hasLevel(src.Levels, lvlID) {
+			srcs = append(srcs, src)
+		}
+	}
+	return dests, srcs
+}
+
+func findLevel(rtr router.Router, lvlID int) (router.Level, bool) {
+	for _, lvl := range rtr.GetLevels() {
+		if lvl.ID == lvlID {
+			return lvl, true
+		}
+	}
+	return router.Level{}, false
+}
+
+func levelIdentifier(lvl router.Level) string {
+	return identifier(lvl.Name, fmt.Sprintf("level-%d", lvl.ID))
+}
+
+// matrix returns a level's matrix with its contents, and its signals and connections if full is set
+func matrix(rtr Router, lvl router.Level, full bool) *Element {
+	dests, srcs := levelSignals(rtr.Router, lvl.ID)
+	el := &Element{
+		Type:                 ElementMatrix,
+		Path:                 []int{rtr.ID, nodeMatrices, lvl.ID},
+		Contents:             true,
+		Identifier:           levelIdentifier(lvl),
+		Description:          lvl.Name,
+		MatrixType:           MatrixOneToN,
+		AddressingMode:       AddressingNonLinear,
+		TargetCount:          len(dests),
+		SourceCount:          len(srcs),
+		MaxConnectsPerTarget: 1,
+		Labels:               []Label{{BasePath: []int{rtr.ID, nodeLabels, lvl.ID}, Description: "Names"}},
+	}
+	if !full {
+		return el
+	}
+	el.Targets = make([]int, 0, len(dests))
+	for _, dest := range dests {
+		el.Targets = append(el.Targets, dest.ID)
+	}
+	el.Sources = make([]int, 0, len(srcs))
+	for _, src := range srcs {
+		el.Sources = append(el.Sources, src.ID)
+	}
+	el.Connections = make([]Connection, 0, len(dests))
+	for _, xpt := range rtr.Router.GetCrosspoints() {
+		if xpt.DestinationLevel == lvl.ID {
+			el.Connections = append(el.Connections, crosspointConnection(xpt))
+		}
+	}
+	return el
+}
+
+func crosspointConnection(xpt router.Crosspoint) Connection {
+	conn := Connection{Target: xpt.Destination, Sources: []int{}}
+	if xpt.Source != 0 {
+		conn.Sources = []int{xpt.Source}
+	}
+	if xpt.Locked {
+		conn.Disposition = DispositionLocked
+	}
+	return conn
+}
+
+func labelParameter(path []int, prefix string, name string) *Element {
+	return &Element{
+		Type:       ElementParameter,
+		Path:       path,
+		Contents:   true,
+		Identifier: fmt.Sprintf("%s%d", prefix, path[len(path)-1]),
+		Value:      name,
+		Access:     AccessRead,
+		IsOnline:   true,
+	}
+}
+
+// element returns the element at a path below a router node with its contents, or nil if there is none
+func element(rtr Router, path []int) *Element {
+	switch len(path) {
+	case 1:
+		return routerNode(rtr)
+	case 2:
+		switch path[1] {
+		case nodeMatrices:
+			return node(path, "matrices", "Matrix per level", true)
+		case nodeLabels:
+			return node(path, "labels", "Destination and source names per level", true)
+		}
+		return nil
+	}
+	lvl, ok := findLevel(rtr.Router, path[2])
+	if !ok {
+		return nil
+	}
+	switch {
+	case len(path) == 3 && path[1] == nodeMatrices:
+		return matrix(rtr, lvl, false)
+	case len(path) == 3 && path[1] == nodeLabels:
+		return node(path, levelIdentifier(lvl), lvl.Name, true)
+	case len(path) == 4 && path[1] == nodeLabels && path[3] == nodeTargets:
+		return node(path, "targets", "Destination names", true)
+	case len(path) == 4 && path[1] == nodeLabels && path[3] == nodeSources:
+		return node(path, "sources", "Source names", true)
+	case len(path) == 5 && path[1] == nodeLabels && path[3] == nodeTargets:
+		dest := rtr.Router.GetDestination(path[4])
+		if dest.ID != path[4] || !hasLevel(dest.Levels, lvl.ID) {
+			return nil
+		}
+		return labelParameter(path, "t", dest.Name)
+	case len(path) == 5 && path[1] == nodeLabels && path[3] == nodeSources:
+		src := rtr.Router.GetSource(path[4])
+		if src.ID != path[4] || !hasLevel(src.Levels, lvl.ID) {
+			return nil
+		}
+		return labelParameter(path, "s", src.Name)
+	}
+	return nil
+}
+
+// children returns the children of the element at a path below a router node, with their contents
+func children(rtr Router, path []int) []*Element {
+	childPath := func(n int) []int {
+		return append(slices.Clone(path), n)
+	}
+	switch {
+	case len(path) == 1:
+		return []*Element{element(rtr, childPath(nodeMatrices)), element(rtr, childPath(nodeLabels))}
+	case len(path) == 2:
+		elements := make([]*Element, 0)
+		for _, lvl := range rtr.Router.GetLevels() {
+			if el := element(rtr, childPath(lvl.ID)); el != nil {
+				elements = append(elements, el)
+			}
+		}
+		return elements
+	case len(path) == 3 && path[1] == nodeLabels:
+		return []*Element{element(rtr, childPath(nodeTargets)), element(rtr, childPath(nodeSources))}
+	case len(path) == 4:
+		dests, srcs := levelSignals(rtr.Router, path[2])
+		elements := make([]*Element, 0)
+		if path[3] == nodeTargets {
+			for _, dest := range dests {
+				elements = append(elements, labelParameter(childPath(dest.ID), "t", dest.Name))
+			}
+		} else {
+			for _, src := range srcs {
+				elements = append(elements, labelParameter(childPath(src.ID), "s", src.Name))
+			}
+		}
+		return elements
+	}
+	return nil
+}
+
+// directory answers a GetDirectory command on the element at path
+func (p *Provider) directory(path []int) []*Element {
+	routers := p.Routers()
+	if len(path) == 0 {
+		elements := make([]*Element, 0, len(routers))
+		for _, rtr := range routers {
+			elements = append(elements, routerNode(rtr))
+		}
+		return elements
+	}
+	rtr, ok := findRouter(routers, path[0])
+	if !ok {
+		return nil
+	}
+	el := element(rtr, path)
+	if el == nil {
+		log.Debugf("Ember+ Provider: GetDirectory on unknown path %v", path)
+		return nil
+	}
+	if el.Type == ElementMatrix {
+		lvl, _ := findLevel(rtr.Router, path[2])
+		return []*Element{matrix(rtr, lvl, true)}
+	}
+	el.Children = children(rtr, path)
+	return []*Element{el}
+}
+
+// connect routes the connection requests on a matrix and answers with the resulting connections
+func (p *Provider) connect(consumer string, path []int, requests []Connection) []*Element {
+	if len(path) != 3 || path[1] != nodeMatrices {
+		return nil
+	}
+	rtr, ok := findRouter(p.Routers(), path[0])
+	if !ok {
+		return nil
+	}
+	lvl, ok := findLevel(rtr.Router, path[2])
+	if !ok {
+		return nil
+	}
+	current := matrix(rtr, lvl, true)
+	connections := make(map[int]Connection)
+	for _, conn := range current.Connections {
+		connections[conn.Target] = conn
+	}
+	replies := make([]Connection, 0, len(requests))
+	for _, req := range requests {
+		conn, known := connections[req.Target]
+		if !known {
+			conn = Connection{Target: req.Target, Sources: []int{}}
+		}
+		// Destinations can't be left without a source, and one to N matrices take the last source given
+		if req.Operation == OperationDisconnect || len(req.Sources) == 0 || conn.Disposition == DispositionLocked {
+			replies = append(replies, conn)
+			continue
+		}
+		src := req.Sources[len(req.Sources)-1]
+		if !slices.Contains(current.Targets, req.Target) || !slices.Contains(current.Sources, src) {
+			log.Warnf("Ember+ Provider: Router %d: source %d can't be routed to destination %d on level %d", rtr.ID, src, req.Target, lvl.ID)
+			replies = append(replies, conn)
+			continue
+		}
+		destLevelID, srcLevelID := lvl.ID, lvl.ID
+		if !rtr.Router.GetCapabilities().Breakaway {
+			destLevelID, srcLevelID = -1, -1
+		}
+		err := p.Route(consumer, rtr.ID, req.Target, destLevelID, src, srcLevelID)
+		if err != nil {
+			log.Warnf("Ember+ Provider: Router %d: destination %d: %s", rtr.ID, req.Target, err.Error())
+			replies = append(replies, conn)
+			continue
+		}
+		replies = append(replies, Connection{Target: req.Target, Sources: []int{src}, Disposition: DispositionPending})
+	}
+	return []*Element{{Type: ElementMatrix, Path: path, Connections: replies}}
+}
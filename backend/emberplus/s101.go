@@ -0,0 +1,228 @@
+package emberplus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// S101 framing bytes
+const (
+	s101BOF     = 0xfe
+	s101EOF     = 0xff
+	s101CE      = 0xfd // Escapes the next byte, which is sent XOR 0x20
+	s101Invalid = 0xf8 // Bytes from here up are escaped
+)
+
+// S101 header values
+const (
+	s101Slot                     = 0x00
+	s101MessageEmber             = 0x0e
+	s101CommandEmber             = 0x00
+	s101CommandKeepAliveRequest  = 0x01
+	s101CommandKeepAliveResponse = 0x02
+	s101Version                  = 0x01
+	s101FlagFirst                = 0x80
+	s101FlagLast                 = 0x40
+	s101FlagEmpty                = 0x20
+	s101DTDGlow                  = 0x01
+)
+
+// Glow DTD version 2.31, minor byte first
+var s101AppBytes = []byte{0x1f, 0x02}
+
+const (
+	maxPacketPayload = 1024    // Outgoing messages are split into packets of this size
+	maxFrameSize     = 1 << 16 // Longer frames are dropped
+	maxMessageSize   = 1 << 24 // Longer multi packet messages are dropped
+	writeTimeout     = 10 * time.Second
+)
+
+var errFrameTooLong = errors.New("ember+: S101 frame too long")
+
+// crcCCITT is the reflected CRC-CCITT used by S101. Over a frame including its CRC it gives 0xf0b8.
+func crcCCITT(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Conn is an S101 framed TCP connection carrying Glow messages
+type Conn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+	pending    []byte // Payload of a multi packet message being received
+	receiving  bool
+}
+
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage returns the next Glow payload. Keep-alive requests are answered and bad frames skipped.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	for {
+		frame, err := c.readFrame()
+		if errors.Is(err, errFrameTooLong) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(frame) < 6 || crcCCITT(frame) != 0xf0b8 {
+			continue
+		}
+		frame = frame[:len(frame)-2]
+		if frame[0] != s101Slot || frame[1] != s101MessageEmber {
+			continue
+		}
+		switch frame[2] {
+		case s101CommandKeepAliveRequest:
+			err := c.writeFrame([]byte{s101Slot, s101MessageEmber, s101CommandKeepAliveResponse, s101Version})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case s101CommandEmber:
+		default:
+			continue
+		}
+		// Version, flags, DTD, application bytes length and the application bytes
+		if len(frame) < 7 || frame[5] != s101DTDGlow || len(frame) < 7+int(frame[6]) {
+			continue
+		}
+		flags := frame[4]
+		payload := frame[7+int(frame[6]):]
+		if flags&s101FlagEmpty != 0 {
+			continue
+		}
+		if flags&s101FlagFirst != 0 {
+			c.pending = c.pending[:0]
+			c.receiving = true
+		}
+		if !c.receiving {
+			continue
+		}
+		if len(c.pending)+len(payload) > maxMessageSize {
+			c.receiving = false
+			continue
+		}
+		c.pending = append(c.pending, payload...)
+		if flags&s101FlagLast != 0 {
+			c.receiving = false
+			message := make([]byte, len(c.pending))
+			copy(message, c.pending)
+			return message, nil
+		}
+	}
+}
+
+// readFrame returns the unescaped bytes between a BOF and EOF
+func (c *Conn) readFrame() ([]byte, error) {
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == s101BOF {
+			break
+		}
+	}
+	frame := make([]byte, 0, 64)
+	escaped := false
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case b == s101BOF:
+			// A new frame starts before the last one ended
+			frame = frame[:0]
+			escaped = false
+		case b == s101EOF:
+			return frame, nil
+		case b == s101CE:
+			escaped = true
+		default:
+			if escaped {
+				b ^= 0x20
+				escaped = false
+			}
+			if len(frame) >= maxFrameSize {
+				return nil, errFrameTooLong
+			}
+			frame = append(frame, b)
+		}
+	}
+}
+
+// writeFrame escapes a frame, adds its CRC and sends it
+func (c *Conn) writeFrame(frame []byte) error {
+	crc := ^crcCCITT(frame)
+	frame = append(frame, byte(crc), byte(crc>>8))
+	buf := make([]byte, 0, len(frame)+len(frame)/8+2)
+	buf = append(buf, s101BOF)
+	for _, b := range frame {
+		if b >= s101Invalid {
+			buf = append(buf, s101CE, b^0x20)
+		} else {
+			buf = append(buf, b)
+		}
+	}
+	buf = append(buf, s101EOF)
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// WriteMessage sends a Glow payload, split into packets if it is long
+func (c *Conn) WriteMessage(payload []byte) error {
+	for first := true; first || len(payload) > 0; first = false {
+		n := min(len(payload), maxPacketPayload)
+		flags := byte(0)
+		if first {
+			flags |= s101FlagFirst
+		}
+		if n == len(payload) {
+			flags |= s101FlagLast
+		}
+		frame := []byte{s101Slot, s101MessageEmber, s101CommandEmber, s101Version, flags, s101DTDGlow, byte(len(s101AppBytes))}
+		frame = append(frame, s101AppBytes...)
+		frame = append(frame, payload[:n]...)
+		err := c.writeFrame(frame)
+		if err != nil {
+			return fmt.Errorf("ember+: %w", err)
+		}
+		payload = payload[n:]
+	}
+	return nil
+}
+
+// KeepAlive sends a keep-alive request. The peer's response is read and dropped by ReadMessage.
+func (c *Conn) KeepAlive() error {
+	return c.writeFrame([]byte{s101Slot, s101MessageEmber, s101CommandKeepAliveRequest, s101Version})
+}
@@ -0,0 +1,222 @@
+package emberplus
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipe returns a Conn reading from and writing to the returned raw end
+func pipe(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	a.SetDeadline(deadline)
+	b.SetDeadline(deadline)
+	return NewConn(a), b
+}
+
+// rawFrame escapes a frame and adds its CRC, independently of Conn.writeFrame
+func rawFrame(frame []byte) []byte {
+	crc := ^crcCCITT(frame)
+	frame = append(frame[:len(frame):len(frame)], byte(crc), byte(crc>>8))
+	buf := []byte{s101BOF}
+	for _, b := range frame {
+		if b >= 0xf8 {
+			buf = append(buf, s101CE, b^0x20)
+		} else {
+			buf = append(buf, b)
+		}
+	}
+	return append(buf, s101EOF)
+}
+
+// emberFrame returns an Ember packet frame with a payload
+func emberFrame(flags byte, payload []byte) []byte {
+	frame := []byte{s101Slot, s101MessageEmber, s101CommandEmber, s101Version, flags, s101DTDGlow, 2, 0x1f, 0x02}
+	return append(frame, payload...)
+}
+
+// readRawFrames reads n frames from the raw end, each from BOF to EOF
+func readRawFrames(t *testing.T, conn net.Conn, n int) [][]byte {
+	t.Helper()
+	reader := bufio.NewReader(conn)
+	frames := make([][]byte, 0, n)
+	for range n {
+		frame, err := reader.ReadBytes(s101EOF)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func TestCRC(t *testing.T) {
+	// CRC-16/X-25 check value
+	if crc := ^crcCCITT([]byte("123456789")); crc != 0x906e {
+		t.Errorf("CRC of 123456789 = %#04x, want 0x906e", crc)
+	}
+	for _, frame := range [][]byte{
+		{s101Slot, s101MessageEmber, s101CommandKeepAliveRequest, s101Version},
+		emberFrame(s101FlagFirst|s101FlagLast, []byte{0x60, 0x00}),
+		bytes.Repeat([]byte{0xff, 0x00}, 100),
+	} {
+		crc := ^crcCCITT(frame)
+		withCRC := append(frame[:len(frame):len(frame)], byte(crc), byte(crc>>8))
+		if residue := crcCCITT(withCRC); residue != 0xf0b8 {
+			t.Errorf("residue over % x = %#04x, want 0xf0b8", withCRC, residue)
+		}
+	}
+}
+
+func TestKeepAliveFrame(t *testing.T) {
+	conn, raw := pipe(t)
+	go conn.KeepAlive()
+	got := readRawFrames(t, raw, 1)[0]
+	want := []byte{s101BOF, 0x00, 0x0e, 0x01, 0x01, 0x94, 0xe4, s101EOF}
+	if !bytes.Equal(got, want) {
+		t.Errorf("keep-alive = % x, want % x", got, want)
+	}
+}
+
+func TestKeepAliveAnswered(t *testing.T) {
+	conn, raw := pipe(t)
+	payload := []byte{0x60, 0x03, 0x02, 0x01, 0x01}
+	go func() {
+		raw.Write(rawFrame([]byte{s101Slot, s101MessageEmber, s101CommandKeepAliveRequest, s101Version}))
+		// Read the response so the reader can carry on
+		bufio.NewReader(raw).ReadBytes(s101EOF)
+		raw.Write(rawFrame(emberFrame(s101FlagFirst|s101FlagLast, payload)))
+	}()
+	got, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("message = % x, want % x", got, payload)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	conn, raw := pipe(t)
+	payload := []byte{0x00, s101Invalid - 1, s101Invalid, 0xf9, s101CE, s101BOF, s101EOF, 0x7f}
+	go conn.WriteMessage(payload)
+	frame := readRawFrames(t, raw, 1)[0]
+	// Only the framing bytes are at or above 0xf8
+	for i, b := range frame[1 : len(frame)-1] {
+		if b >= s101Invalid && b != s101CE {
+			t.Errorf("byte %d of % x is not escaped", i+1, frame)
+		}
+	}
+	wantTail := []byte{0x00, 0xf7, s101CE, 0xd8, s101CE, 0xd9, s101CE, 0xdd, s101CE, 0xde, s101CE, 0xdf, 0x7f}
+	if !bytes.Contains(frame, wantTail) {
+		t.Errorf("frame % x, want the escaped payload % x", frame, wantTail)
+	}
+
+	go raw.Write(frame)
+	got, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("read back % x, want % x", got, payload)
+	}
+}
+
+func TestMultiPacketMessage(t *testing.T) {
+	conn, raw := pipe(t)
+	payload := make([]byte, 2*maxPacketPayload+100)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	go conn.WriteMessage(payload)
+	frames := readRawFrames(t, raw, 3)
+	wantFlags := []byte{s101FlagFirst, 0, s101FlagLast}
+	for i, frame := range frames {
+		// BOF, slot, message type, command and version come before the flags, none of them escaped
+		if frame[5] != wantFlags[i] {
+			t.Errorf("packet %d flags %#02x, want %#02x", i+1, frame[5], wantFlags[i])
+		}
+	}
+
+	go func() {
+		for _, frame := range frames {
+			raw.Write(frame)
+		}
+	}()
+	got, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("reassembled %d bytes, want %d", len(got), len(payload))
+	}
+}
+
+func TestEmptyMessage(t *testing.T) {
+	conn, raw := pipe(t)
+	go conn.WriteMessage(nil)
+	frame := readRawFrames(t, raw, 1)[0]
+	if frame[5] != s101FlagFirst|s101FlagLast {
+		t.Errorf("flags %#02x", frame[5])
+	}
+}
+
+func TestReadMessageSkipsBadFrames(t *testing.T) {
+	conn, raw := pipe(t)
+	good := []byte{0x60, 0x00}
+	badCRC := rawFrame(emberFrame(s101FlagFirst|s101FlagLast, []byte{0x01}))
+	badCRC[len(badCRC)-2] ^= 0x01
+	restarted := append([]byte{s101BOF, 0x00, 0x0e}, rawFrame(emberFrame(s101FlagFirst, good[:1]))...)
+	tooLong := append([]byte{s101BOF}, bytes.Repeat([]byte{0x01}, maxFrameSize+1)...)
+	tooLong = append(tooLong, s101EOF)
+	go func() {
+		for _, data := range [][]byte{
+			[]byte("noise before a frame"),
+			badCRC,
+			// A continuation without a first packet
+			rawFrame(emberFrame(s101FlagLast, []byte{0x02})),
+			rawFrame(emberFrame(s101FlagFirst|s101FlagLast|s101FlagEmpty, nil)),
+			rawFrame([]byte{0x01, s101MessageEmber, s101CommandEmber, s101Version, s101FlagFirst | s101FlagLast, s101DTDGlow, 0}),
+			rawFrame([]byte{s101Slot, s101MessageEmber, s101CommandEmber, s101Version, s101FlagFirst | s101FlagLast, 0x02, 0}),
+			rawFrame([]byte{s101Slot, s101MessageEmber, s101CommandKeepAliveResponse, s101Version}),
+			tooLong,
+			// A frame cut off by a new BOF starts again
+			restarted,
+			rawFrame(emberFrame(s101FlagLast, good[1:])),
+		} {
+			raw.Write(data)
+		}
+	}()
+	got, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, good) {
+		t.Errorf("message = % x, want % x", got, good)
+	}
+}
+
+func TestFirstPacketRestartsMessage(t *testing.T) {
+	conn, raw := pipe(t)
+	go func() {
+		raw.Write(rawFrame(emberFrame(s101FlagFirst, []byte{0x01, 0x02})))
+		// The rest of the first message was lost
+		raw.Write(rawFrame(emberFrame(s101FlagFirst, []byte{0x03})))
+		raw.Write(rawFrame(emberFrame(s101FlagLast, []byte{0x04})))
+	}()
+	got, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{0x03, 0x04}) {
+		t.Errorf("message = % x", got)
+	}
+}
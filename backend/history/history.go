@@ -0,0 +1,313 @@
+// Package history records crosspoint changes so router tables can be reconstructed at any past time.
+//
+// Changes are kept in memory and appended to a file with one compact JSON array per line:
+// [unix milliseconds, router, destination, destination level, source, source level, locked].
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cassaram/bfc/backend/router"
+	log "github.com/sirupsen/logrus"
+)
+
+// Entry is a crosspoint as it was from Time
+type Entry struct {
+	Time       time.Time
+	Crosspoint router.Crosspoint
+}
+
+type key struct {
+	destination      int
+	destinationLevel int
+}
+
+// Changes older than the retention period are dropped this often while the log is open
+const expireInterval = 24 * time.Hour
+
+// Log is the crosspoint history of all routers
+type Log struct {
+	path      string
+	retention time.Duration
+	file      *os.File
+	entries   map[int][]Entry // By router, in time order
+	last      map[int]map[key]router.Crosspoint
+	mutex     sync.RWMutex
+	stop      chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+	skipped   bool // load skipped lines which the next rewrite drops
+}
+
+// Open loads the history at path, dropping changes older than retention, and opens it for appending.
+// Older changes are dropped again every day until the log is closed. The last change of each crosspoint
+// before the retention period is kept, so every crosspoint keeps a known state.
+// A retention of zero keeps everything. An empty path keeps the history in memory only.
+func Open(path string, retention time.Duration) (*Log, error) {
+	l := &Log{
+		path:      path,
+		retention: retention,
+		entries:   make(map[int][]Entry),
+		last:      make(map[int]map[key]router.Crosspoint),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if path != "" {
+		err := l.load()
+		if err != nil {
+			return nil, err
+		}
+		// Rewrite to drop skipped lines too, or the next change would be appended to a line cut short
+		compacted := retention > 0 && l.compact(time.Now().Add(-retention))
+		if compacted || l.skipped {
+			err = l.rewrite()
+			if err != nil {
+				return nil, err
+			}
+		}
+		l.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if retention > 0 {
+		go l.expireEvery(expireInterval)
+	} else {
+		close(l.done)
+	}
+	return l, nil
+}
+
+// expireEvery drops changes older than the retention period every interval until the log is closed
+func (l *Log) expireEvery(interval time.Duration) {
+	defer close(l.done)
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-time.After(interval):
+		}
+		err := l.expire(time.Now().Add(-l.retention))
+		if err != nil {
+			log.Error("History: ", err.Error())
+		}
+	}
+}
+
+// expire drops changes replaced before cutoff, rewriting the file if any were dropped
+func (l *Log) expire(cutoff time.Time) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.compact(cutoff) || l.file == nil {
+		return nil
+	}
+	err := l.rewrite()
+	if err != nil {
+		return err
+	}
+	// The file was replaced, so appends go to the new one
+	l.file.Close()
+	l.file, err = os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		l.file = nil
+		return err
+	}
+	return nil
+}
+
+func (l *Log) load() error {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var rec [7]int64
+		err := json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			// A line cut short by a crash is skipped
+			l.skipped = true
+			continue
+		}
+		xpt := router.Crosspoint{
+			Destination:      int(rec[2]),
+			DestinationLevel: int(rec[3]),
+			Source:           int(rec[4]),
+			SourceLevel:      int(rec[5]),
+			Locked:           rec[6] != 0,
+		}
+		l.add(int(rec[1]), Entry{Time: time.UnixMilli(rec[0]), Crosspoint: xpt})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("history: %s line %d: %w", l.path, line, err)
+	}
+	// Keep entries in time order if the clock went backwards
+	for _, entries := range l.entries {
+		slices.SortStableFunc(entries, func(a Entry, b Entry) int {
+			return a.Time.Compare(b.Time)
+		})
+	}
+	return nil
+}
+
+// add appends an entry if it changes the crosspoint. The caller holds the lock.
+func (l *Log) add(routerID int, e Entry) bool {
+	k := key{destination: e.Crosspoint.Destination, destinationLevel: e.Crosspoint.DestinationLevel}
+	last, ok := l.last[routerID]
+	if !ok {
+		last = make(map[key]router.Crosspoint)
+		l.last[routerID] = last
+	}
+	if prev, ok := last[k]; ok && prev == e.Crosspoint {
+		return false
+	}
+	last[k] = e.Crosspoint
+	l.entries[routerID] = append(l.entries[routerID], e)
+	return true
+}
+
+// compact drops entries before cutoff which were replaced before cutoff. Reports whether any were dropped.
+func (l *Log) compact(cutoff time.Time) bool {
+	dropped := false
+	for routerID, entries := range l.entries {
+		// Walk backwards so the first entry seen of each crosspoint is its latest
+		seen := make(map[key]bool)
+		kept := make([]Entry, 0, len(entries))
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			k := key{destination: e.Crosspoint.Destination, destinationLevel: e.Crosspoint.DestinationLevel}
+			if e.Time.Before(cutoff) && seen[k] {
+				dropped = true
+				continue
+			}
+			if e.Time.Before(cutoff) {
+				seen[k] = true
+			}
+			kept = append(kept, e)
+		}
+		slices.Reverse(kept)
+		l.entries[routerID] = kept
+	}
+	return dropped
+}
+
+// rewrite replaces the file with the entries in memory
+func (l *Log) rewrite() error {
+	tmpPath := l.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for routerID, entries := range l.entries {
+		for _, e := range entries {
+			w.Write(encode(routerID, e))
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, l.path)
+}
+
+func encode(routerID int, e Entry) []byte {
+	locked := 0
+	if e.Crosspoint.Locked {
+		locked = 1
+	}
+	xpt := e.Crosspoint
+	return fmt.Appendf(nil, "[%d,%d,%d,%d,%d,%d,%d]\n", e.Time.UnixMilli(), routerID, xpt.Destination, xpt.DestinationLevel, xpt.Source, xpt.SourceLevel, locked)
+}
+
+// Record adds a crosspoint change. Notifications which don't change the crosspoint, and crosspoints
+// without a source which routers report before they know the state, are ignored.
+func (l *Log) Record(routerID int, xpt router.Crosspoint, t time.Time) error {
+	if xpt.Source == 0 {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	// Times are stored in milliseconds
+	e := Entry{Time: time.UnixMilli(t.UnixMilli()), Crosspoint: xpt}
+	if !l.add(routerID, e) || l.file == nil {
+		return nil
+	}
+	_, err := l.file.Write(encode(routerID, e))
+	return err
+}
+
+// Changes returns a router's changes between from and to, for one destination or all destinations if destID is 0
+func (l *Log) Changes(routerID int, destID int, from time.Time, to time.Time) []Entry {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	entries := l.entries[routerID]
+	start := sort.Search(len(entries), func(i int) bool { return !entries[i].Time.Before(from) })
+	changes := make([]Entry, 0)
+	for _, e := range entries[start:] {
+		if e.Time.After(to) {
+			break
+		}
+		if destID == 0 || e.Crosspoint.Destination == destID {
+			changes = append(changes, e)
+		}
+	}
+	return changes
+}
+
+// At returns a router's crosspoints as they were at a time, sorted by destination and level
+func (l *Log) At(routerID int, at time.Time) []router.Crosspoint {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	state := make(map[key]router.Crosspoint)
+	for _, e := range l.entries[routerID] {
+		if e.Time.After(at) {
+			break
+		}
+		state[key{destination: e.Crosspoint.Destination, destinationLevel: e.Crosspoint.DestinationLevel}] = e.Crosspoint
+	}
+	crosspoints := make([]router.Crosspoint, 0, len(state))
+	for _, xpt := range state {
+		crosspoints = append(crosspoints, xpt)
+	}
+	slices.SortFunc(crosspoints, func(a router.Crosspoint, b router.Crosspoint) int {
+		if a.Destination != b.Destination {
+			return a.Destination - b.Destination
+		}
+		return a.DestinationLevel - b.DestinationLevel
+	})
+	return crosspoints
+}
+
+func (l *Log) Close() error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.done
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,173 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cassaram/bfc/backend/router"
+)
+
+var base = time.UnixMilli(1700000000000)
+
+func xpt(dest int, src int) router.Crosspoint {
+	return router.Crosspoint{Destination: dest, DestinationLevel: 1, Source: src, SourceLevel: 1}
+}
+
+func sources(entries []Entry) []int {
+	srcs := make([]int, 0, len(entries))
+	for _, e := range entries {
+		srcs = append(srcs, e.Crosspoint.Source)
+	}
+	return srcs
+}
+
+func TestRecordDedup(t *testing.T) {
+	l, err := Open("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.Record(1, xpt(1, 5), base)
+	l.Record(1, xpt(1, 5), base.Add(time.Second))
+	l.Record(1, xpt(1, 0), base.Add(2*time.Second))
+	l.Record(1, xpt(1, 6), base.Add(3*time.Second))
+	l.Record(1, xpt(1, 6), base.Add(4*time.Second))
+	l.Record(2, xpt(1, 6), base.Add(5*time.Second))
+
+	got := l.Changes(1, 0, base, base.Add(time.Minute))
+	if !reflect.DeepEqual(sources(got), []int{5, 6}) {
+		t.Errorf("changes %v, want sources [5 6]", got)
+	}
+	if !got[1].Time.Equal(base.Add(3 * time.Second)) {
+		t.Errorf("change at %v, want the first notification", got[1].Time)
+	}
+	if got := l.Changes(2, 0, base, base.Add(time.Minute)); len(got) != 1 {
+		t.Errorf("router 2 changes %v, want 1", got)
+	}
+}
+
+func TestAt(t *testing.T) {
+	l, err := Open("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.Record(1, xpt(2, 5), base)
+	l.Record(1, xpt(1, 5), base.Add(time.Second))
+	l.Record(1, xpt(1, 6), base.Add(2*time.Second))
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want []router.Crosspoint
+	}{
+		{"before changes", base.Add(-time.Second), []router.Crosspoint{}},
+		{"at first change", base, []router.Crosspoint{xpt(2, 5)}},
+		{"between changes", base.Add(1500 * time.Millisecond), []router.Crosspoint{xpt(1, 5), xpt(2, 5)}},
+		{"after changes", base.Add(time.Hour), []router.Crosspoint{xpt(1, 6), xpt(2, 5)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := l.At(1, tt.at); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("At = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompact(t *testing.T) {
+	l, err := Open("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.Record(1, xpt(1, 5), base)
+	l.Record(1, xpt(2, 5), base.Add(time.Second))
+	l.Record(1, xpt(1, 6), base.Add(2*time.Second))
+	l.Record(1, xpt(1, 7), base.Add(4*time.Second))
+	l.Record(1, xpt(1, 8), base.Add(5*time.Second))
+
+	cutoff := base.Add(3 * time.Second)
+	if !l.compact(cutoff) {
+		t.Error("compact dropped nothing")
+	}
+	// Source 5 on destination 1 was replaced before the cutoff, the rest is still needed
+	if got := sources(l.Changes(1, 1, base, base.Add(time.Minute))); !reflect.DeepEqual(got, []int{6, 7, 8}) {
+		t.Errorf("destination 1 sources after compact %v, want [6 7 8]", got)
+	}
+	if got := sources(l.Changes(1, 2, base, base.Add(time.Minute))); !reflect.DeepEqual(got, []int{5}) {
+		t.Errorf("destination 2 sources after compact %v, want [5]", got)
+	}
+	want := []router.Crosspoint{xpt(1, 6), xpt(2, 5)}
+	if got := l.At(1, cutoff); !reflect.DeepEqual(got, want) {
+		t.Errorf("At cutoff = %v, want %v", got, want)
+	}
+	if l.compact(cutoff) {
+		t.Error("compacting again dropped entries")
+	}
+}
+
+func TestExpireRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	l, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(1, xpt(1, 5), base)
+	l.Record(1, xpt(1, 6), base.Add(time.Second))
+	err = l.expire(base.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Appends after the rewrite must go to the new file
+	l.Record(1, xpt(1, 7), base.Add(2*time.Minute))
+	err = l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	l, err = Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if got := sources(l.Changes(1, 0, base, base.Add(time.Hour))); !reflect.DeepEqual(got, []int{6, 7}) {
+		t.Errorf("sources after reopening %v, want [6 7]", got)
+	}
+}
+
+func TestLoadTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	data := "[1700000000000,1,1,1,5,1,0]\n[1700000001000,1,2,1,5,1,1]\n[1700000002000,1,1,1"
+	err := os.WriteFile(path, []byte(data), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []router.Crosspoint{xpt(1, 5), xpt(2, 5)}
+	want[1].Locked = true
+	if got := l.At(1, base.Add(time.Hour)); !reflect.DeepEqual(got, want) {
+		t.Errorf("At = %v, want %v", got, want)
+	}
+	// A change recorded after the cut short line must survive reopening
+	l.Record(1, xpt(1, 6), base.Add(time.Minute))
+	l.Close()
+
+	l, err = Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if got := sources(l.Changes(1, 1, base, base.Add(time.Hour))); !reflect.DeepEqual(got, []int{5, 6}) {
+		t.Errorf("destination 1 sources after reopening %v, want [5 6]", got)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cassaram/bfc/backend/config"
+	"github.com/cassaram/bfc/backend/web"
+	log "github.com/sirupsen/logrus"
+)
+
+func HandleHTTP() {
+	rootMux := http.NewServeMux()
+	apiMux := API.GetServeMux()
+	rootMux.Handle("/api/", http.StripPrefix("/api", apiMux))
+	rootMux.HandleFunc("GET /metrics", handleMetrics)
+	rootMux.HandleFunc("GET /config.js", handleFrontendConfig)
+	frontend := web.NewHandler()
+	if !frontend.Available() {
+		log.Warn("HTTP Server: Frontend not included in this build")
+	}
+	rootMux.Handle("/", frontend)
+
+	httpCfg := getConfig().HTTP.WithDefaults()
+	handler := httpMiddlewareCors(rootMux)
+	HTTPServers = make([]*http.Server, 0)
+
+	if httpCfg.TLSListenAddress != config.ListenerOff {
+		tlsConfig, err := newTLSConfig(httpCfg)
+		if err != nil {
+			// Keep serving plain HTTP so the API stays reachable while certificates are sorted out
+			log.Error("HTTPS Server: Not starting: ", err.Error())
+			httpCfg.RedirectToHTTPS = false
+		} else {
+			httpsServer := &http.Server{Addr: httpCfg.TLSListenAddress, Handler: handler, TLSConfig: tlsConfig}
+			HTTPServers = append(HTTPServers, httpsServer)
+			go func() {
+				log.Info("HTTPS Server: Listening on ", httpsServer.Addr)
+				err := httpsServer.ListenAndServeTLS("", "")
+				if !errors.Is(err, http.ErrServerClosed) {
+					log.Fatal(err)
+				}
+			}()
+		}
+	}
+
+	if httpCfg.ListenAddress != config.ListenerOff {
+		if httpCfg.RedirectToHTTPS {
+			handler = httpsRedirect(httpCfg.TLSListenAddress)
+		}
+		httpServer := &http.Server{Addr: httpCfg.ListenAddress, Handler: handler}
+		HTTPServers = append(HTTPServers, httpServer)
+		go func() {
+			log.Info("HTTP Server: Listening on ", httpServer.Addr)
+			err := httpServer.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+}
+
+// handleFrontendConfig serves the runtime settings the frontend loads before starting
+func handleFrontendConfig(w http.ResponseWriter, r *http.Request) {
+	frontendConfig := map[string]string{
+		"apiUrl": getConfig().HTTP.APIURL,
+	}
+	frontendConfigBytes, err := json.Marshal(frontendConfig)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, "window.BFC_CONFIG = %s;\n", frontendConfigBytes)
+}
+
+// newTLSConfig builds the TLS settings for the HTTPS listener
+func newTLSConfig(httpCfg config.HTTPConfig) (*tls.Config, error) {
+	certs, err := newCertReloader(httpCfg.CertFile, httpCfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	go certs.watch(10 * time.Second)
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	if httpCfg.MinTLSVersion == "1.3" {
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+	if httpCfg.ClientCAFile != "" {
+		caBytes, err := os.ReadFile(httpCfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no certificates found in %s", httpCfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		// Browsers connect without certificates, automation clients present one
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if httpCfg.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// certReloader serves a certificate and key pair, reloading them when the files change
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time
+	mutex    sync.RWMutex
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	err := c.reload()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certReloader) reload() error {
+	modTime := latestModTime(c.certFile, c.keyFile)
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.mutex.Unlock()
+	return nil
+}
+
+// watch reloads the certificate when either file is modified
+func (c *certReloader) watch(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		c.mutex.RLock()
+		modTime := c.modTime
+		c.mutex.RUnlock()
+		if !latestModTime(c.certFile, c.keyFile).After(modTime) {
+			continue
+		}
+		err := c.reload()
+		if err != nil {
+			// Files may be mid-update, keep serving the old certificate and try again next time
+			log.Error("HTTPS Server: Reloading certificate: ", err.Error())
+			continue
+		}
+		log.Info("HTTPS Server: Reloaded certificate ", c.certFile)
+	}
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.cert, nil
+}
+
+func latestModTime(paths ...string) time.Time {
+	latest := time.Time{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// httpsRedirect redirects every request to the same URL on the TLS listener
+func httpsRedirect(tlsAddress string) http.Handler {
+	_, tlsPort, _ := net.SplitHostPort(tlsAddress)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+func httpMiddlewareCors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := getConfig().HTTP.WithDefaults().CORSAllowedOrigins
+		origin := r.Header.Get("Origin")
+		if slices.Contains(allowed, "*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else if origin != "" && slices.Contains(allowed, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+		w.Header().Set("Access-Control-Allow-Methods", "GET,PUT,POST,DELETE,OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "*")
+		if r.Method == "OPTIONS" {
+			// Handle CORS Preflight
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
+	"fmt"
+	"maps"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/cassaram/bfc/backend/config"
+	"github.com/cassaram/bfc/backend/emberplus"
+	"github.com/cassaram/bfc/backend/history"
 	"github.com/cassaram/bfc/backend/router"
-	"github.com/cassaram/bfc/backend/router/harrislrc"
+	"github.com/cassaram/bfc/backend/store"
 	"github.com/coder/websocket"
 	log "github.com/sirupsen/logrus"
 )
@@ -16,54 +25,77 @@ import (
 var Routers map[int]router.Router
 var ConfigFile config.ConfigFile
 var WebsocketConnections []*websocket.Conn
-var API APIHandler
+var API *APIHandler
+var Store store.Store
+var History *history.Log
+var EmberPlus *emberplus.Provider // Nil when the provider is disabled
+var HTTPServers []*http.Server
 
 func main() {
+	flag.StringVar(&ConfigPath, "config", "config.json", "Path to the config file")
+	checkConfig := flag.Bool("check-config", false, "Validate the config file and exit")
+	listDrivers := flag.Bool("list-drivers", false, "List available router types and their config keys and exit")
+	flag.Parse()
+
+	if *listDrivers {
+		printDrivers()
+		os.Exit(0)
+	}
+
 	log.SetOutput(os.Stdout)
-	API = *NewAPIHandler()
+	API = NewAPIHandler()
 
 	Routers = make(map[int]router.Router)
 	WebsocketConnections = make([]*websocket.Conn, 0)
 
 	// Load config file
-	configFileBytes, err := os.ReadFile("config.json")
+	cfg, err := loadConfig(ConfigPath)
+	if *checkConfig {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(ConfigPath + ": OK")
+		os.Exit(0)
+	}
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("Invalid config:\n", err.Error())
 	}
-	json.Unmarshal(configFileBytes, &ConfigFile)
+	ConfigFile = cfg
+	TagRules = compileTagRules(cfg)
 
 	// Handle logging
-	switch strings.ToLower(ConfigFile.LogLevel) {
-	case "trace":
-		log.SetLevel(log.TraceLevel)
-	case "debug":
-		log.SetLevel(log.DebugLevel)
-	case "info":
-		log.SetLevel(log.InfoLevel)
-	case "warn":
-		log.SetLevel(log.WarnLevel)
-	case "error":
-		log.SetLevel(log.ErrorLevel)
-	case "fatal":
-		log.SetLevel(log.FatalLevel)
-	case "panic":
-		log.SetLevel(log.PanicLevel)
+	applyLogLevel(ConfigFile.LogLevel)
+
+	// Open persistent store
+	fileStore, err := store.Open(ConfigFile.DataFile, time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	Store = fileStore
+	go saveRouterStates(5 * time.Second)
+
+	// Open crosspoint history
+	History, err = history.Open(ConfigFile.HistoryFile, time.Duration(ConfigFile.HistoryRetentionDays)*24*time.Hour)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Handle HTTP Server
-	go HandleHTTP()
+	HandleHTTP()
+
+	// Publish routers to Ember+ consumers, before routers start reporting crosspoints
+	startEmberPlus()
 
 	// Handle Routers
 	for _, rtrCfg := range ConfigFile.Routers {
-		switch strings.ToLower(rtrCfg.Type) {
-		case "harrislrc":
-			rtr := harrislrc.HarrisLRCRouter{}
-			rtr.Init(rtrCfg.Config)
-			Routers[rtrCfg.ID] = router.Router(&rtr)
-		default:
-			log.Fatal("Invalid router type: ", rtrCfg.Type)
+		rtr, err := newRouter(rtrCfg)
+		if err != nil {
+			log.Fatal(err)
 		}
-		Routers[rtrCfg.ID].SetCrosspointNotifyFunc(API.APIV1SendCrosspoint)
+		RoutersMutex.Lock()
+		Routers[rtrCfg.ID] = rtr
+		RoutersMutex.Unlock()
 	}
 
 	// Start Routers
@@ -71,32 +103,116 @@ func main() {
 		rtr.Start()
 	}
 
-	// Run forever
-	<-make(chan bool)
-}
-
-func HandleHTTP() {
-	rootMux := http.NewServeMux()
-	apiMux := API.GetServeMux()
-	rootMux.Handle("/api/", http.StripPrefix("/api", apiMux))
+	// Run until asked to stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	// Run scheduled jobs and bookings
+	var scheduling sync.WaitGroup
+	scheduling.Add(2)
 	go func() {
-		log.Fatal(http.ListenAndServe(":80", httpMiddlewareCors(rootMux)))
+		defer scheduling.Done()
+		runScheduler(ctx, time.Second)
 	}()
 	go func() {
-		log.Fatal(http.ListenAndServeTLS(":443", "server.crt", "server.key", httpMiddlewareCors(rootMux)))
+		defer scheduling.Done()
+		runBookings(ctx, time.Second)
 	}()
+
+	// Reload config on SIGHUP or when the file changes
+	go watchConfig(5 * time.Second)
+
+	<-ctx.Done()
+	log.Info("Shutting down")
+	// Jobs and bookings being routed finish before the routers stop
+	scheduling.Wait()
+	shutdown(10 * time.Second)
 }
 
-func httpMiddlewareCors(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,PUT,POST,DELETE,OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "*")
-		if r.Method == "OPTIONS" {
-			// Handle CORS Preflight
-			return
+// shutdown stops accepting requests, disconnects clients and routers and flushes the store, each within timeout
+func shutdown(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, server := range HTTPServers {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			log.Error("HTTP Server: ", err.Error())
+		}
+	}
+	// Websockets are hijacked connections, which the HTTP servers don't close
+	API.CloseWebsockets(websocket.StatusGoingAway, "server shutting down")
+	if EmberPlus != nil {
+		err := EmberPlus.Close()
+		if err != nil {
+			log.Error("Ember+ Provider: ", err.Error())
 		}
-		next.ServeHTTP(w, r)
-	})
+	}
+
+	RoutersMutex.RLock()
+	routers := maps.Clone(Routers)
+	RoutersMutex.RUnlock()
+	var wg sync.WaitGroup
+	for routerID, rtr := range routers {
+		saveRouterState(routerID, rtr)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopRouter(routerID, rtr, timeout)
+		}()
+	}
+	wg.Wait()
+
+	err := Store.Close()
+	if err != nil {
+		log.Error("Store: ", err.Error())
+	}
+	err = History.Close()
+	if err != nil {
+		log.Error("History: ", err.Error())
+	}
+}
+
+// loadConfig reads, parses and validates a config file
+func loadConfig(path string) (config.ConfigFile, error) {
+	configFileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return config.ConfigFile{}, err
+	}
+	cfg, err := config.Parse(configFileBytes)
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	validators := make(map[string]config.DriverValidator)
+	for _, driver := range router.Drivers() {
+		validators[strings.ToLower(driver.Type)] = driver.ValidateConfig
+	}
+	errs := cfg.Validate(validators)
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("%s: %d problem(s):\n%w", path, len(errs), errs)
+	}
+	// Defaults are applied here so a reload compares like with like
+	if cfg.DataFile == "" {
+		cfg.DataFile = "bfc-data.json"
+	}
+	if cfg.HistoryFile == "" {
+		cfg.HistoryFile = "bfc-history.jsonl"
+	}
+	if cfg.HistoryRetentionDays == 0 {
+		cfg.HistoryRetentionDays = 90
+	}
+	return cfg, nil
+}
+
+// printDrivers writes the registered router types and their config keys to stdout
+func printDrivers() {
+	for _, driver := range router.Drivers() {
+		fmt.Printf("%s\t%s\n", driver.Type, driver.Description)
+		for _, key := range driver.Config {
+			required := ""
+			if key.Required {
+				required = " (required)"
+			}
+			fmt.Printf("\t%s\t%s%s\t%s\n", key.Name, key.Type, required, key.Description)
+		}
+	}
 }
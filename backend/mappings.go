@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/config"
+	"github.com/cassaram/bfc/backend/router"
+)
+
+// levelName returns a level's name, or its number if the router doesn't know it
+func levelName(rtr router.Router, lvlID int) string {
+	lvl := rtr.GetLevel(lvlID)
+	if lvl.Name == "" {
+		return strconv.Itoa(lvlID)
+	}
+	return lvl.Name
+}
+
+// checkLevelMapping returns an error if a mapping can't route a source to a destination
+func checkLevelMapping(rtr router.Router, destID int, srcID int, levels []config.LevelMap) error {
+	dest := rtr.GetDestination(destID)
+	if dest.ID != destID {
+		return fmt.Errorf("Destination ID (%d) not found", destID)
+	}
+	src := rtr.GetSource(srcID)
+	if src.ID != srcID {
+		return fmt.Errorf("Source ID (%d) not found", srcID)
+	}
+	for _, lvlMap := range levels {
+		if !slices.Contains(src.Levels, lvlMap.SourceLevel) {
+			return fmt.Errorf("Source %s has no level %s", src.Name, levelName(rtr, lvlMap.SourceLevel))
+		}
+		// Destinations without levels accept every level of the router
+		if len(dest.Levels) > 0 && !slices.Contains(dest.Levels, lvlMap.DestinationLevel) {
+			return fmt.Errorf("Destination %s has no level %s", dest.Name, levelName(rtr, lvlMap.DestinationLevel))
+		}
+	}
+	return nil
+}
+
+func (a *APIHandler) APIV1HandleLevelMappings(w http.ResponseWriter, r *http.Request) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	routerConfig, routerConfig_ok := getRouterConfig(routerID)
+	if !routerConfig_ok {
+		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
+		return
+	}
+	mappings := make([]apiv1.LevelMapping, 0, len(routerConfig.LevelMappings))
+	for name, levels := range routerConfig.LevelMappings {
+		mappings = append(mappings, apiv1.LevelMapping{Name: name, Levels: levels})
+	}
+	slices.SortFunc(mappings, func(a apiv1.LevelMapping, b apiv1.LevelMapping) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	mappingsBody, err := json.Marshal(mappings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(mappingsBody)
+}
+
+func (a *APIHandler) APIV1HandleMappedCrosspointsPut(w http.ResponseWriter, r *http.Request) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	router, router_ok := getRouter(routerID)
+	if !router_ok {
+		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
+		return
+	}
+	body := apiv1.MappedCrosspointRequest{}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	named, err := withNameSet(routerID, router, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	body, err = resolveMappedCrosspointRequest(body, named, router)
+	if err != nil {
+		http.Error(w, err.Error(), resolveStatus(err))
+		return
+	}
+	if !router.GetCapabilities().Breakaway {
+		http.Error(w, "Router is follow only, level mappings need breakaway routing", http.StatusBadRequest)
+		return
+	}
+	routerConfig, _ := getRouterConfig(routerID)
+	levels, levels_ok := routerConfig.LevelMappings[body.Mapping]
+	if !levels_ok {
+		http.Error(w, fmt.Sprintf("Level mapping (%s) not found", body.Mapping), http.StatusNotFound)
+		return
+	}
+	err = checkLevelMapping(named, body.DestinationID, body.SourceID, levels)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = checkBooking(routerID, body.DestinationID, requestUser(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	previous := make([]apiv1.UndoCrosspoint, 0)
+	errs := make([]error, 0)
+	for _, lvlMap := range levels {
+		changes := capturePrevious(routerID, router, body.DestinationID, lvlMap.DestinationLevel, body.SourceID, lvlMap.SourceLevel)
+		err = setCrosspoint(routerID, router, body.DestinationID, lvlMap.DestinationLevel, body.SourceID, lvlMap.SourceLevel)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Level %s: %w", levelName(named, lvlMap.DestinationLevel), err))
+			continue
+		}
+		previous = append(previous, changes...)
+	}
+	description := fmt.Sprintf("Route %s to %s (%s)", named.GetSource(body.SourceID).Name, named.GetDestination(body.DestinationID).Name, body.Mapping)
+	recordUndo(requestUser(r), description, previous)
+	recordAudit(requestUser(r), apiv1.AuditRoute, description, errorStrings(errors.Join(errs...)))
+	if len(errs) > 0 {
+		http.Error(w, errors.Join(errs...).Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cassaram/bfc/backend/metrics"
+	"github.com/cassaram/bfc/backend/router"
+)
+
+var Metrics = metrics.NewRegistry()
+
+var (
+	metricHTTPRequests = metrics.NewCounter("bfc_http_requests_total", "HTTP requests by route pattern and status code.", "pattern", "code")
+	metricHTTPLatency  = metrics.NewHistogram("bfc_http_request_duration_seconds", "HTTP request latency by route pattern.", metrics.DefaultBuckets, "pattern")
+	metricRouteLatency = metrics.NewHistogram("bfc_route_latency_seconds", "Time from a route command to the router confirming the crosspoint.", metrics.DefaultBuckets, "router")
+)
+
+// pendingRoute identifies a route command waiting for the router to confirm it
+type pendingRoute struct {
+	routerID         int
+	destination      int
+	destinationLevel int
+}
+
+var pendingRoutes = make(map[pendingRoute]time.Time)
+var pendingRoutesMutex sync.Mutex
+
+// Routes not confirmed within this time are dropped from latency tracking
+const pendingRouteTimeout = 30 * time.Second
+
+func init() {
+	Metrics.Register(metrics.NewGaugeFunc("bfc_router_up", "Whether the router is connected and ready (1) or not (0).", []string{"router", "short_name"}, func() []metrics.Sample {
+		samples := make([]metrics.Sample, 0)
+		forEachRouter(func(rtrID string, shortName string, rtr router.Router) {
+			up := 0.0
+			if rtr.GetStatus().State == router.StateReady {
+				up = 1
+			}
+			samples = append(samples, metrics.Sample{LabelValues: []string{rtrID, shortName}, Value: up})
+		})
+		return samples
+	}))
+	Metrics.Register(metrics.NewGaugeFunc("bfc_router_state", "Router connection state, 1 for the current state.", []string{"router", "state"}, func() []metrics.Sample {
+		samples := make([]metrics.Sample, 0)
+		states := []router.State{router.StateDisconnected, router.StateConnecting, router.StateSyncing, router.StateReady, router.StateError}
+		forEachRouter(func(rtrID string, shortName string, rtr router.Router) {
+			current := rtr.GetStatus().State
+			for _, state := range states {
+				val := 0.0
+				if state == current {
+					val = 1
+				}
+				samples = append(samples, metrics.Sample{LabelValues: []string{rtrID, string(state)}, Value: val})
+			}
+		})
+		return samples
+	}))
+	Metrics.Register(metrics.NewCounterFunc("bfc_router_reconnects_total", "Router reconnect attempts.", []string{"router"}, func() []metrics.Sample {
+		samples := make([]metrics.Sample, 0)
+		forEachRouter(func(rtrID string, shortName string, rtr router.Router) {
+			samples = append(samples, metrics.Sample{LabelValues: []string{rtrID}, Value: float64(rtr.GetStatus().ReconnectCount)})
+		})
+		return samples
+	}))
+	Metrics.Register(metrics.NewCounterFunc("bfc_router_messages_received_total", "Protocol messages received by message type.", []string{"router", "type"}, func() []metrics.Sample {
+		return messageStatSamples(func(stats router.MessageStats) map[string]uint64 { return stats.Received })
+	}))
+	Metrics.Register(metrics.NewCounterFunc("bfc_router_messages_sent_total", "Protocol messages sent by message type.", []string{"router", "type"}, func() []metrics.Sample {
+		return messageStatSamples(func(stats router.MessageStats) map[string]uint64 { return stats.Sent })
+	}))
+	Metrics.Register(metrics.NewCounterFunc("bfc_router_parse_errors_total", "Protocol messages that could not be parsed.", []string{"router"}, func() []metrics.Sample {
+		samples := make([]metrics.Sample, 0)
+		forEachRouter(func(rtrID string, shortName string, rtr router.Router) {
+			if reporter, ok := rtr.(router.StatsReporter); ok {
+				samples = append(samples, metrics.Sample{LabelValues: []string{rtrID}, Value: float64(reporter.GetMessageStats().ParseErrors)})
+			}
+		})
+		return samples
+	}))
+	Metrics.Register(metricRouteLatency)
+	Metrics.Register(metrics.NewGaugeFunc("bfc_websocket_clients", "Connected websocket clients.", nil, func() []metrics.Sample {
+		clients, _ := API.WebsocketStats()
+		return []metrics.Sample{{Value: float64(clients)}}
+	}))
+	Metrics.Register(metrics.NewGaugeFunc("bfc_websocket_queue_depth", "Messages queued for all websocket clients.", nil, func() []metrics.Sample {
+		_, queued := API.WebsocketStats()
+		return []metrics.Sample{{Value: float64(queued)}}
+	}))
+	Metrics.Register(metricHTTPRequests)
+	Metrics.Register(metricHTTPLatency)
+}
+
+func forEachRouter(fn func(rtrID string, shortName string, rtr router.Router)) {
+	for _, rtrCfg := range getConfig().Routers {
+		rtr, ok := getRouter(rtrCfg.ID)
+		if !ok {
+			continue
+		}
+		fn(strconv.Itoa(rtrCfg.ID), rtrCfg.ShortName, rtr)
+	}
+}
+
+func messageStatSamples(counts func(router.MessageStats) map[string]uint64) []metrics.Sample {
+	samples := make([]metrics.Sample, 0)
+	forEachRouter(func(rtrID string, shortName string, rtr router.Router) {
+		reporter, ok := rtr.(router.StatsReporter)
+		if !ok {
+			return
+		}
+		for msgType, count := range counts(reporter.GetMessageStats()) {
+			samples = append(samples, metrics.Sample{LabelValues: []string{rtrID, msgType}, Value: float64(count)})
+		}
+	})
+	return samples
+}
+
+// setCrosspoint routes a crosspoint and tracks it until the router confirms it
+func setCrosspoint(routerID int, rtr router.Router, destID int, destLevelID int, srcID int, srcLevelID int) error {
+	key := pendingRoute{routerID: routerID, destination: destID, destinationLevel: destLevelID}
+	pendingRoutesMutex.Lock()
+	pendingRoutes[key] = time.Now()
+	pendingRoutesMutex.Unlock()
+	err := rtr.SetCrosspoint(destID, destLevelID, srcID, srcLevelID)
+	if err != nil {
+		pendingRoutesMutex.Lock()
+		delete(pendingRoutes, key)
+		pendingRoutesMutex.Unlock()
+	}
+	return err
+}
+
+// observeRouteConfirmed records the route latency if the crosspoint confirms a pending route
+func observeRouteConfirmed(routerID int, crosspoint router.Crosspoint) {
+	now := time.Now()
+	pendingRoutesMutex.Lock()
+	defer pendingRoutesMutex.Unlock()
+	// Follow routes are sent with level -1 and confirmed per level
+	for _, level := range []int{crosspoint.DestinationLevel, -1} {
+		key := pendingRoute{routerID: routerID, destination: crosspoint.Destination, destinationLevel: level}
+		sent, ok := pendingRoutes[key]
+		if !ok {
+			continue
+		}
+		delete(pendingRoutes, key)
+		metricRouteLatency.Observe(now.Sub(sent).Seconds(), strconv.Itoa(routerID))
+	}
+	for key, sent := range pendingRoutes {
+		if now.Sub(sent) > pendingRouteTimeout {
+			delete(pendingRoutes, key)
+		}
+	}
+}
+
+// handleMetrics serves all metrics in the Prometheus text format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	Metrics.Write(w)
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController and websocket upgrades reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// instrumentHandler counts requests and their latency under the route pattern they were registered with
+func instrumentHandler(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		metricHTTPRequests.Inc(pattern, strconv.Itoa(rec.status))
+		metricHTTPLatency.Observe(time.Since(start).Seconds(), pattern)
+	}
+}
@@ -0,0 +1,271 @@
+// Package metrics implements the Prometheus text exposition format for the few
+// metric types BFC needs, without pulling in the Prometheus client library.
+package metrics
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram buckets in seconds suited to network and HTTP latencies
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collector writes metric families in the text exposition format
+type Collector interface {
+	Write(w io.Writer)
+}
+
+type Registry struct {
+	collectors []Collector
+	mutex      sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(c Collector) {
+	r.mutex.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mutex.Unlock()
+}
+
+// Write writes every registered collector
+func (r *Registry) Write(w io.Writer) {
+	r.mutex.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mutex.Unlock()
+	for _, c := range collectors {
+		c.Write(w)
+	}
+}
+
+// Sample is a single labelled value, used by GaugeFunc
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d desc) writeHeader(w io.Writer, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, metricType)
+}
+
+// labelString formats label pairs, with optional extra pairs appended
+func (d desc) labelString(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, name := range d.labels {
+		val := ""
+		if i < len(values) {
+			val = values[i]
+		}
+		pairs = append(pairs, name+"=\""+escapeLabel(val)+"\"")
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"=\""+escapeLabel(extra[i+1])+"\"")
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// valueVec holds one value per label set
+type valueVec struct {
+	values map[string]float64
+	labels map[string][]string
+	mutex  sync.Mutex
+}
+
+func newValueVec() *valueVec {
+	return &valueVec{
+		values: make(map[string]float64),
+		labels: make(map[string][]string),
+	}
+}
+
+func (v *valueVec) update(labelValues []string, fn func(float64) float64) {
+	key := labelKey(labelValues)
+	v.mutex.Lock()
+	v.values[key] = fn(v.values[key])
+	v.labels[key] = labelValues
+	v.mutex.Unlock()
+}
+
+func (v *valueVec) write(w io.Writer, d desc, metricType string) {
+	d.writeHeader(w, metricType)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for _, key := range sortedKeys(v.values) {
+		fmt.Fprintf(w, "%s%s %s\n", d.name, d.labelString(v.labels[key]), formatFloat(v.values[key]))
+	}
+}
+
+// Counter is a monotonically increasing value per label set
+type Counter struct {
+	desc
+	*valueVec
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{desc: desc{name: name, help: help, labels: labels}, valueVec: newValueVec()}
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.update(labelValues, func(old float64) float64 { return old + v })
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Write(w io.Writer) {
+	c.write(w, c.desc, "counter")
+}
+
+// Gauge is a value per label set that can go up and down
+type Gauge struct {
+	desc
+	*valueVec
+}
+
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{desc: desc{name: name, help: help, labels: labels}, valueVec: newValueVec()}
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 { return v })
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.update(labelValues, func(old float64) float64 { return old + v })
+}
+
+func (g *Gauge) Write(w io.Writer) {
+	g.write(w, g.desc, "gauge")
+}
+
+// GaugeFunc reports gauge or counter samples computed at scrape time
+type GaugeFunc struct {
+	desc
+	metricType string
+	collect    func() []Sample
+}
+
+func NewGaugeFunc(name string, help string, labels []string, collect func() []Sample) *GaugeFunc {
+	return &GaugeFunc{desc: desc{name: name, help: help, labels: labels}, metricType: "gauge", collect: collect}
+}
+
+// NewCounterFunc is a GaugeFunc reported with the counter type, for counters kept elsewhere
+func NewCounterFunc(name string, help string, labels []string, collect func() []Sample) *GaugeFunc {
+	return &GaugeFunc{desc: desc{name: name, help: help, labels: labels}, metricType: "counter", collect: collect}
+}
+
+func (g *GaugeFunc) Write(w io.Writer) {
+	g.writeHeader(w, g.metricType)
+	samples := g.collect()
+	slices.SortFunc(samples, func(a Sample, b Sample) int {
+		return cmp.Compare(labelKey(a.LabelValues), labelKey(b.LabelValues))
+	})
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelString(s.LabelValues), formatFloat(s.Value))
+	}
+}
+
+type histogramValues struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Histogram counts observations into cumulative buckets per label set
+type Histogram struct {
+	desc
+	buckets []float64
+	values  map[string]*histogramValues
+	mutex   sync.Mutex
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{
+		desc:    desc{name: name, help: help, labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramValues),
+	}
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValues{labels: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+func (h *Histogram) Write(w io.Writer) {
+	h.writeHeader(w, "histogram")
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, key := range sortedKeys(h.values) {
+		hv := h.values[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(hv.labels, "le", formatFloat(upper)), hv.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(hv.labels, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(hv.labels), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(hv.labels), hv.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer("\\", `\\`, "\n", `\n`, "\"", `\"`).Replace(s)
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// checkGolden compares a collector's output with testdata/<name>.golden
+func checkGolden(t *testing.T, name string, c Collector) {
+	t.Helper()
+	var buf bytes.Buffer
+	c.Write(&buf)
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("%s output:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("bfc_routes_total", "Routes made", "router", "result")
+	c.Inc("2", "ok")
+	c.Inc("1", "ok")
+	c.Add(2.5, "1", "ok")
+	c.Inc("1", "error")
+	checkGolden(t, "counter", c)
+}
+
+func TestCounterWithoutLabels(t *testing.T) {
+	c := NewCounter("bfc_reloads_total", "Config reloads")
+	c.Inc()
+	c.Inc()
+	checkGolden(t, "counter_no_labels", c)
+}
+
+func TestGauge(t *testing.T) {
+	g := NewGauge("bfc_clients", "Connected clients", "kind")
+	g.Set(5, "websocket")
+	g.Add(-2, "websocket")
+	g.Set(0.000012, "sse")
+	g.Set(math.Inf(1), "inf")
+	g.Set(math.Inf(-1), "-inf")
+	g.Set(1e21, "large")
+	checkGolden(t, "gauge", g)
+}
+
+func TestEscaping(t *testing.T) {
+	g := NewGauge("bfc_router_info", "Router \\ info\nsecond line with \"quotes\"", "name")
+	g.Set(1, "CAM \"A\"\\B\nC")
+	checkGolden(t, "escaping", g)
+}
+
+func TestMissingLabelValues(t *testing.T) {
+	// Values left out are written as empty labels
+	g := NewGauge("bfc_state", "Router state", "router", "state")
+	g.Set(1, "1")
+	checkGolden(t, "missing_labels", g)
+}
+
+func TestGaugeFunc(t *testing.T) {
+	collect := func() []Sample {
+		return []Sample{
+			{LabelValues: []string{"2"}, Value: 3},
+			{LabelValues: []string{"10"}, Value: 1},
+			{LabelValues: []string{"1"}, Value: 7},
+		}
+	}
+	checkGolden(t, "gauge_func", NewGaugeFunc("bfc_destinations", "Destinations per router", []string{"router"}, collect))
+	checkGolden(t, "counter_func", NewCounterFunc("bfc_reconnects_total", "Reconnects per router", []string{"router"}, collect))
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("bfc_route_seconds", "Route latency", []float64{0.01, 0.1, 1}, "router")
+	// Observations on a bucket's upper bound count in that bucket
+	for _, v := range []float64{0.005, 0.01, 0.05, 0.5, 3} {
+		h.Observe(v, "1")
+	}
+	h.Observe(0.25, "2")
+	checkGolden(t, "histogram", h)
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	// Label sets only appear once observed
+	checkGolden(t, "histogram_empty", NewHistogram("bfc_http_seconds", "HTTP latency", DefaultBuckets, "route"))
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	g := NewGauge("bfc_b", "Registered first")
+	g.Set(1)
+	c := NewCounter("bfc_a", "Registered second")
+	c.Inc()
+	r.Register(g)
+	r.Register(c)
+	// Collectors are written in registration order
+	checkGolden(t, "registry", r)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/router"
+	"github.com/cassaram/bfc/backend/store"
+)
+
+func getNameSet(routerID int, name string) (apiv1.NameSet, error) {
+	nameSet := apiv1.NameSet{}
+	err := Store.Get(store.BucketNameSets, store.NameSetKey(routerID, name), &nameSet)
+	return nameSet, err
+}
+
+// requestNameSet returns the name set asked for with ?nameset=, or else the user's preferred name set.
+// The boolean is false if the request asked for a name set the router doesn't have.
+func requestNameSet(routerID int, r *http.Request) (string, bool) {
+	name := r.URL.Query().Get("nameset")
+	if name == "" {
+		// A preferred name set only applies to the routers which have it
+		name = getUserPreferences(requestUser(r)).NameSet
+		if _, err := getNameSet(routerID, name); err != nil {
+			return "", true
+		}
+		return name, true
+	}
+	_, err := getNameSet(routerID, name)
+	return name, err == nil
+}
+
+// withNameSet returns the router showing the names of the request's name set
+func withNameSet(routerID int, rtr router.Router, r *http.Request) (router.Router, error) {
+	name, ok := requestNameSet(routerID, r)
+	if !ok {
+		return rtr, fmt.Errorf("Name set (%s) not found", name)
+	}
+	if name == "" {
+		return rtr, nil
+	}
+	nameSet, err := getNameSet(routerID, name)
+	if err != nil {
+		return rtr, err
+	}
+	return &nameSetRouter{Router: rtr, nameSet: nameSet}, nil
+}
+
+// nameSetRouter shows a router's sources and destinations under the names of a name set
+type nameSetRouter struct {
+	router.Router
+	nameSet apiv1.NameSet
+}
+
+func (r *nameSetRouter) GetSources() []router.Source {
+	sources := slices.Clone(r.Router.GetSources())
+	for i := range sources {
+		if name, ok := r.nameSet.Sources[sources[i].ID]; ok {
+			sources[i].Name = name
+		}
+	}
+	return sources
+}
+
+func (r *nameSetRouter) GetSource(srcID int) router.Source {
+	src := r.Router.GetSource(srcID)
+	if name, ok := r.nameSet.Sources[srcID]; ok {
+		src.Name = name
+	}
+	return src
+}
+
+func (r *nameSetRouter) GetDestinations() []router.Destination {
+	dests := slices.Clone(r.Router.GetDestinations())
+	for i := range dests {
+		if name, ok := r.nameSet.Destinations[dests[i].ID]; ok {
+			dests[i].Name = name
+		}
+	}
+	return dests
+}
+
+func (r *nameSetRouter) GetDestination(destID int) router.Destination {
+	dest := r.Router.GetDestination(destID)
+	if name, ok := r.nameSet.Destinations[destID]; ok {
+		dest.Name = name
+	}
+	return dest
+}
+
+// nameCrosspointEvent fills in the destination and source names of a crosspoint event
+func nameCrosspointEvent(event apiv1.Event, nameSet string) apiv1.Event {
+	rtr, rtr_ok := getRouter(event.RouterID)
+	if !rtr_ok || event.Crosspoint == nil {
+		return event
+	}
+	if nameSet != "" {
+		set, err := getNameSet(event.RouterID, nameSet)
+		if err == nil {
+			rtr = &nameSetRouter{Router: rtr, nameSet: set}
+		}
+	}
+	event.DestinationName = rtr.GetDestination(event.Crosspoint.Destination).Name
+	event.SourceName = rtr.GetSource(event.Crosspoint.Source).Name
+	return event
+}
+
+func (a *APIHandler) APIV1HandleNameSets(w http.ResponseWriter, r *http.Request) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	keys, err := Store.Keys(store.BucketNameSets)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nameSets := make([]apiv1.NameSet, 0)
+	prefix := store.NameSetKey(routerID, "")
+	for _, key := range keys {
+		escaped, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		name, err := url.PathUnescape(escaped)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		nameSet, err := getNameSet(routerID, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		nameSets = append(nameSets, nameSet)
+	}
+	nameSetsBody, err := json.Marshal(nameSets)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(nameSetsBody)
+}
+
+func (a *APIHandler) APIV1HandleNameSet(w http.ResponseWriter, r *http.Request) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	name := r.PathValue("name")
+	nameSet, err := getNameSet(routerID, name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Name set (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nameSetBody, err := json.Marshal(nameSet)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(nameSetBody)
+}
+
+func (a *APIHandler) APIV1HandleNameSetPut(w http.ResponseWriter, r *http.Request) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	body := apiv1.NameSet{}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	body.Name = r.PathValue("name")
+	if body.Sources == nil {
+		body.Sources = make(map[int]string)
+	}
+	if body.Destinations == nil {
+		body.Destinations = make(map[int]string)
+	}
+	err = Store.Put(store.BucketNameSets, store.NameSetKey(routerID, body.Name), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *APIHandler) APIV1HandleNameSetDelete(w http.ResponseWriter, r *http.Request) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	name := r.PathValue("name")
+	_, err = getNameSet(routerID, name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Name set (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	err = Store.Delete(store.BucketNameSets, store.NameSetKey(routerID, name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -2,6 +2,14 @@ package neuronview
 
 type Card struct {
 	Heads   []Head
+	Widgets []Widget
 	Groups  []InputGroup
 	Streams []InputStream
 }
+
+// AddLayout adds a generated layout's head, widgets and input groups to the card
+func (c *Card) AddLayout(l Layout) {
+	c.Heads = append(c.Heads, l.Head)
+	c.Widgets = append(c.Widgets, l.Widgets...)
+	c.Groups = append(c.Groups, l.Groups...)
+}
@@ -1,5 +1,11 @@
 package neuronview
 
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
 type InputStream struct {
 	UUID       string `json:"uuid"`
 	Name       string `json:"name"`
@@ -10,3 +16,48 @@ type InputStream struct {
 	SDP        string `json:"sdp"`
 	Type       string `json:"type"`
 }
+
+// AssignSDP validates an SDP and assigns it to the stream with the given UUID.
+// Streams without a type take the essence of the SDP, otherwise the essence must match.
+func (c *Card) AssignSDP(streamUUID string, sdpText string) error {
+	for i, stream := range c.Streams {
+		if stream.UUID != streamUUID {
+			continue
+		}
+		sdp, err := ParseSDP(sdpText)
+		if err != nil {
+			return err
+		}
+		err = sdp.Validate()
+		if err != nil {
+			return err
+		}
+		if stream.Type == "" {
+			stream.Type = sdp.Essence()
+		} else if !strings.EqualFold(stream.Type, sdp.Essence()) {
+			return fmt.Errorf("neuronview: stream %s is %s but SDP describes %s", stream.Name, stream.Type, sdp.Essence())
+		}
+		stream.SDP = sdpText
+		c.Streams[i] = stream
+		return nil
+	}
+	return fmt.Errorf("neuronview: stream %s not found", streamUUID)
+}
+
+// AssignSDPFromNMOS assigns the SDP of the registry sender matching the stream's NMOS label
+func (c *Card) AssignSDPFromNMOS(ctx context.Context, registry *NMOSRegistry, streamUUID string) error {
+	for _, stream := range c.Streams {
+		if stream.UUID != streamUUID {
+			continue
+		}
+		if stream.NMOSLabel == "" {
+			return fmt.Errorf("neuronview: stream %s has no NMOS label", stream.Name)
+		}
+		sdp, err := registry.SenderSDP(ctx, stream.NMOSLabel)
+		if err != nil {
+			return err
+		}
+		return c.AssignSDP(streamUUID, sdp)
+	}
+	return fmt.Errorf("neuronview: stream %s not found", streamUUID)
+}
@@ -0,0 +1,210 @@
+package neuronview
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cassaram/bfc/backend/router"
+)
+
+// Label positions supported by LabelStyle
+const (
+	LabelTop    = "top"
+	LabelBottom = "bottom"
+	LabelNone   = "none"
+)
+
+// Stream types used to bind streams to an input group
+const (
+	StreamTypeVideo = "video"
+	StreamTypeAudio = "audio"
+	StreamTypeData  = "data"
+)
+
+type LabelStyle struct {
+	Position        string  `json:"position"`
+	Height          float32 `json:"height"` // Fraction of the tile height used by the label
+	TextColor       string  `json:"textColor"`
+	BackgroundColor string  `json:"backgroundColor"`
+	Horizontal      string  `json:"horizontal"`
+}
+
+// LayoutTemplate describes a rows x columns grid of tiles on a single head
+type LayoutTemplate struct {
+	Name            string     `json:"name"`
+	Rows            int        `json:"rows"`
+	Columns         int        `json:"columns"`
+	Width           int        `json:"width"`
+	Height          int        `json:"height"`
+	BackgroundColor string     `json:"backgroundColor"`
+	BorderColor     string     `json:"borderColor"`
+	BorderSize      string     `json:"borderSize"`
+	FitMode         string     `json:"fitMode"`
+	Label           LabelStyle `json:"label"`
+}
+
+// Layout is a generated head with its widgets and input groups
+type Layout struct {
+	Head    Head         `json:"head"`
+	Widgets []Widget     `json:"widgets"`
+	Groups  []InputGroup `json:"groups"`
+}
+
+// DefaultLayoutTemplate returns a 4x4 1080p template with labels under each tile
+func DefaultLayoutTemplate() LayoutTemplate {
+	return LayoutTemplate{
+		Name:            "Multiviewer",
+		Rows:            4,
+		Columns:         4,
+		Width:           1920,
+		Height:          1080,
+		BackgroundColor: "#000000",
+		BorderColor:     "#404040",
+		BorderSize:      "1",
+		FitMode:         "fit",
+		Label: LabelStyle{
+			Position:        LabelBottom,
+			Height:          0.15,
+			TextColor:       "#FFFFFF",
+			BackgroundColor: "#000000",
+			Horizontal:      "center",
+		},
+	}
+}
+
+// Validate checks the template describes a usable grid
+func (t LayoutTemplate) Validate() error {
+	if t.Rows <= 0 || t.Columns <= 0 {
+		return fmt.Errorf("neuronview: invalid grid %dx%d", t.Rows, t.Columns)
+	}
+	if t.Width <= 0 || t.Height <= 0 {
+		return fmt.Errorf("neuronview: invalid head size %dx%d", t.Width, t.Height)
+	}
+	switch t.Label.Position {
+	case LabelTop, LabelBottom:
+		if t.Label.Height <= 0 || t.Label.Height >= 1 {
+			return fmt.Errorf("neuronview: label height (%v) must be between 0 and 1", t.Label.Height)
+		}
+	case LabelNone, "":
+	default:
+		return fmt.Errorf("neuronview: unknown label position %q", t.Label.Position)
+	}
+	return nil
+}
+
+// GenerateLayout builds a head with one tile per destination, filling the grid left to right, top to bottom.
+// Each tile gets an input group bound to the streams whose name or NMOS label matches the destination name.
+func GenerateLayout(tmpl LayoutTemplate, dests []router.Destination, streams []InputStream) (Layout, error) {
+	err := tmpl.Validate()
+	if err != nil {
+		return Layout{}, err
+	}
+	if len(dests) > tmpl.Rows*tmpl.Columns {
+		return Layout{}, fmt.Errorf("neuronview: %d destinations do not fit in a %dx%d grid", len(dests), tmpl.Rows, tmpl.Columns)
+	}
+
+	layout := Layout{
+		Head: Head{
+			UUID:            newUUID(),
+			Name:            tmpl.Name,
+			BackgroundColor: tmpl.BackgroundColor,
+			BackgroundMode:  "color",
+			Height:          tmpl.Height,
+			Width:           tmpl.Width,
+			Widgets:         make([]string, 0, len(dests)),
+		},
+		Widgets: make([]Widget, 0, len(dests)),
+		Groups:  make([]InputGroup, 0, len(dests)),
+	}
+
+	tileWidth := float32(tmpl.Width) / float32(tmpl.Columns)
+	tileHeight := float32(tmpl.Height) / float32(tmpl.Rows)
+	for i, dest := range dests {
+		group := InputGroup{
+			UUID:     newUUID(),
+			Name:     dest.Name,
+			Bindings: make([]ProtocolBinding, 0),
+		}
+		for _, stream := range matchStreams(dest.Name, streams) {
+			switch strings.ToLower(stream.Type) {
+			case StreamTypeVideo:
+				group.VideoUUID = stream.UUID
+			case StreamTypeAudio:
+				group.AudioUUID = stream.UUID
+			case StreamTypeData:
+				group.DataUUID = stream.UUID
+			}
+		}
+
+		widget := Widget{
+			UUID: newUUID(),
+			Name: dest.Name,
+			Geometry: WidgetGeometry{
+				Height: tileHeight,
+				Width:  tileWidth,
+				X:      float32(i%tmpl.Columns) * tileWidth,
+				Y:      float32(i/tmpl.Columns) * tileHeight,
+			},
+			Elements:  tileElements(tmpl, dest.Name, tileWidth, tileHeight),
+			GroupUUID: group.UUID,
+		}
+
+		layout.Head.Widgets = append(layout.Head.Widgets, widget.UUID)
+		layout.Widgets = append(layout.Widgets, widget)
+		layout.Groups = append(layout.Groups, group)
+	}
+
+	return layout, nil
+}
+
+// tileElements returns the video and label elements of a tile, positioned relative to the tile
+func tileElements(tmpl LayoutTemplate, name string, width float32, height float32) []WidgetElement {
+	videoGeometry := WidgetGeometry{Height: height, Width: width}
+	labelGeometry := WidgetGeometry{Height: height * tmpl.Label.Height, Width: width}
+	switch tmpl.Label.Position {
+	case LabelTop:
+		videoGeometry.Y = labelGeometry.Height
+		videoGeometry.Height -= labelGeometry.Height
+	case LabelBottom:
+		videoGeometry.Height -= labelGeometry.Height
+		labelGeometry.Y = videoGeometry.Height
+	}
+
+	elements := []WidgetElement{
+		{
+			Geometry: videoGeometry,
+			Properties: WidgetProperties{
+				BorderColor: tmpl.BorderColor,
+				BorderSize:  tmpl.BorderSize,
+				FitMode:     tmpl.FitMode,
+			},
+			Type:    "video",
+			Visible: true,
+		},
+	}
+	if tmpl.Label.Position == LabelTop || tmpl.Label.Position == LabelBottom {
+		elements = append(elements, WidgetElement{
+			Geometry: labelGeometry,
+			Properties: WidgetProperties{
+				BackgroundColor: tmpl.Label.BackgroundColor,
+				Text:            name,
+				TextColor:       tmpl.Label.TextColor,
+				Horizontal:      tmpl.Label.Horizontal,
+			},
+			Type:    "label",
+			Visible: true,
+		})
+	}
+	return elements
+}
+
+// matchStreams returns the streams named after a destination
+func matchStreams(name string, streams []InputStream) []InputStream {
+	matches := make([]InputStream, 0)
+	for _, stream := range streams {
+		if strings.EqualFold(stream.Name, name) || (stream.NMOSLabel != "" && strings.EqualFold(stream.NMOSLabel, name)) {
+			matches = append(matches, stream)
+		}
+	}
+	return matches
+}
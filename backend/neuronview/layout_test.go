@@ -0,0 +1,125 @@
+package neuronview
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cassaram/bfc/backend/router"
+)
+
+func TestGenerateLayoutDefaults(t *testing.T) {
+	dests := []router.Destination{{ID: 1, Name: "MON 1"}, {ID: 2, Name: "MON 2"}, {ID: 5, Name: "MON 5"}}
+	streams := []InputStream{
+		{UUID: "v1", Name: "mon 1", Type: "Video"},
+		{UUID: "a1", NMOSLabel: "MON 1", Type: StreamTypeAudio},
+		{UUID: "v2", Name: "MON 3", Type: StreamTypeVideo},
+	}
+	layout, err := GenerateLayout(DefaultLayoutTemplate(), dests, streams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.Head.Name != "Multiviewer" || layout.Head.Width != 1920 || layout.Head.Height != 1080 {
+		t.Errorf("head %+v", layout.Head)
+	}
+	if len(layout.Widgets) != 3 || len(layout.Groups) != 3 || len(layout.Head.Widgets) != 3 {
+		t.Fatalf("%d widgets, %d groups, %d head widgets, want 3 of each", len(layout.Widgets), len(layout.Groups), len(layout.Head.Widgets))
+	}
+
+	// Tiles fill a 4x4 grid left to right
+	for i, want := range []WidgetGeometry{{X: 0, Y: 0}, {X: 480, Y: 0}, {X: 960, Y: 0}} {
+		got := layout.Widgets[i].Geometry
+		if got.X != want.X || got.Y != want.Y || got.Width != 480 || got.Height != 270 {
+			t.Errorf("widget %d geometry %+v", i, got)
+		}
+		if layout.Widgets[i].GroupUUID != layout.Groups[i].UUID || layout.Head.Widgets[i] != layout.Widgets[i].UUID {
+			t.Errorf("widget %d isn't linked to its group and head", i)
+		}
+	}
+
+	// The label sits under the video
+	elements := layout.Widgets[0].Elements
+	if len(elements) != 2 || elements[0].Type != "video" || elements[1].Type != "label" {
+		t.Fatalf("elements %+v, want video and label", elements)
+	}
+	if elements[0].Geometry.Height+elements[1].Geometry.Height != 270 || elements[1].Geometry.Y != elements[0].Geometry.Height {
+		t.Errorf("video %+v, label %+v", elements[0].Geometry, elements[1].Geometry)
+	}
+	if elements[1].Properties.Text != "MON 1" {
+		t.Errorf("label text %q", elements[1].Properties.Text)
+	}
+
+	// Streams are matched by name or NMOS label regardless of case
+	if g := layout.Groups[0]; g.VideoUUID != "v1" || g.AudioUUID != "a1" {
+		t.Errorf("group 0 %+v, want video v1 and audio a1", g)
+	}
+	if g := layout.Groups[1]; g.VideoUUID != "" || g.AudioUUID != "" {
+		t.Errorf("group 1 %+v, want no streams", g)
+	}
+}
+
+func TestGenerateLayoutPartialTemplate(t *testing.T) {
+	// Fields left out of a requested template keep their defaults, as the API decodes over them
+	tmpl := DefaultLayoutTemplate()
+	err := json.Unmarshal([]byte(`{"rows": 1, "columns": 2, "label": {"position": "top"}}`), &tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dests := []router.Destination{{ID: 1, Name: "A"}, {ID: 2, Name: "B"}}
+	layout, err := GenerateLayout(tmpl, dests, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.Head.Width != 1920 || layout.Head.Height != 1080 {
+		t.Errorf("head %dx%d, want the default 1920x1080", layout.Head.Width, layout.Head.Height)
+	}
+	second := layout.Widgets[1]
+	if second.Geometry.X != 960 || second.Geometry.Width != 960 || second.Geometry.Height != 1080 {
+		t.Errorf("second widget geometry %+v", second.Geometry)
+	}
+	video, label := second.Elements[0], second.Elements[1]
+	if label.Geometry.Y != 0 || label.Geometry.Height != 1080*0.15 || video.Geometry.Y != label.Geometry.Height {
+		t.Errorf("video %+v, label %+v, want the default height label on top", video.Geometry, label.Geometry)
+	}
+	if label.Properties.TextColor != "#FFFFFF" || video.Properties.FitMode != "fit" {
+		t.Errorf("label %+v, video %+v, want default colours and fit", label.Properties, video.Properties)
+	}
+
+	// Without a label only the video is drawn
+	tmpl.Label.Position = LabelNone
+	layout, err = GenerateLayout(tmpl, dests, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elements := layout.Widgets[0].Elements; len(elements) != 1 || elements[0].Geometry.Height != 1080 {
+		t.Errorf("elements %+v, want only a full height video", elements)
+	}
+}
+
+func TestGenerateLayoutErrors(t *testing.T) {
+	dests := []router.Destination{{ID: 1, Name: "A"}, {ID: 2, Name: "B"}}
+	tests := []struct {
+		name string
+		edit func(*LayoutTemplate)
+		err  string
+	}{
+		{"empty grid", func(l *LayoutTemplate) { l.Rows = 0 }, "invalid grid"},
+		{"no head size", func(l *LayoutTemplate) { l.Width = 0 }, "invalid head size"},
+		{"label too tall", func(l *LayoutTemplate) { l.Label.Height = 1 }, "label height"},
+		{"unknown label", func(l *LayoutTemplate) { l.Label.Position = "left" }, "unknown label position"},
+		{"too many destinations", func(l *LayoutTemplate) { l.Rows, l.Columns = 1, 1 }, "do not fit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := DefaultLayoutTemplate()
+			tt.edit(&tmpl)
+			_, err := GenerateLayout(tmpl, dests, nil)
+			if err == nil {
+				t.Fatal("GenerateLayout succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("GenerateLayout error %q, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
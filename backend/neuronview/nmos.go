@@ -0,0 +1,84 @@
+package neuronview
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NMOSRegistry queries an NMOS IS-04 registry's Query API
+type NMOSRegistry struct {
+	URL     string
+	Version string
+	Client  *http.Client
+}
+
+type nmosSender struct {
+	ID           string `json:"id"`
+	Label        string `json:"label"`
+	ManifestHref string `json:"manifest_href"`
+}
+
+func NewNMOSRegistry(registryURL string) *NMOSRegistry {
+	return &NMOSRegistry{
+		URL:     strings.TrimRight(registryURL, "/"),
+		Version: "v1.3",
+		Client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// SenderSDP finds the sender with the given label and fetches the SDP from its manifest
+func (n *NMOSRegistry) SenderSDP(ctx context.Context, label string) (string, error) {
+	query := n.URL + "/x-nmos/query/" + n.Version + "/senders?label=" + url.QueryEscape(label)
+	body, err := n.get(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	senders := make([]nmosSender, 0)
+	err = json.Unmarshal(body, &senders)
+	if err != nil {
+		return "", fmt.Errorf("nmos: parsing senders: %w", err)
+	}
+	// Registries may do substring matching on query parameters, so filter again
+	matches := make([]nmosSender, 0)
+	for _, sender := range senders {
+		if sender.Label == label {
+			matches = append(matches, sender)
+		}
+	}
+	switch {
+	case len(matches) == 0:
+		return "", fmt.Errorf("nmos: no sender labelled %q", label)
+	case len(matches) > 1:
+		return "", fmt.Errorf("nmos: %d senders labelled %q", len(matches), label)
+	case matches[0].ManifestHref == "":
+		return "", fmt.Errorf("nmos: sender %s has no manifest", matches[0].ID)
+	}
+
+	sdp, err := n.get(ctx, matches[0].ManifestHref)
+	if err != nil {
+		return "", err
+	}
+	return string(sdp), nil
+}
+
+func (n *NMOSRegistry) get(ctx context.Context, reqURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("nmos: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nmos: GET %s returned %s", reqURL, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
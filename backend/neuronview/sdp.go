@@ -0,0 +1,336 @@
+package neuronview
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Essences carried by an ST 2110 stream
+const (
+	EssenceVideo = "video"
+	EssenceAudio = "audio"
+	EssenceData  = "data"
+)
+
+type SDPMedia struct {
+	Media        string              `json:"media"` // m= media type (video, audio)
+	Port         int                 `json:"port"`
+	Protocol     string              `json:"protocol"`
+	PayloadType  int                 `json:"payload_type"`
+	Address      string              `json:"address"` // Destination (multicast) address from c=
+	TTL          int                 `json:"ttl"`
+	SourceFilter string              `json:"source_filter"` // Source address from a=source-filter
+	MID          string              `json:"mid"`
+	Encoding     string              `json:"encoding"` // Encoding name from a=rtpmap
+	ClockRate    int                 `json:"clock_rate"`
+	Channels     int                 `json:"channels"`
+	Format       map[string]string   `json:"format"` // Parameters from a=fmtp
+	Attributes   map[string][]string `json:"attributes"`
+}
+
+type SDP struct {
+	Origin      string     `json:"origin"`
+	SessionName string     `json:"session_name"`
+	DupGroup    []string   `json:"dup_group"` // Media IDs from a=group:DUP (ST 2022-7)
+	Media       []SDPMedia `json:"media"`
+}
+
+// ParseSDP parses an RFC 4566 session description
+func ParseSDP(text string) (*SDP, error) {
+	sdp := &SDP{
+		Media: make([]SDPMedia, 0),
+	}
+	sessionAddress := ""
+	sessionTTL := 0
+	sessionFilter := ""
+	var media *SDPMedia
+	seenVersion := false
+
+	text = strings.ReplaceAll(text, "\r", "")
+	for i, line := range strings.Split(text, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return nil, fmt.Errorf("sdp: line %d: malformed line %q", i+1, line)
+		}
+		value := line[2:]
+		switch line[0] {
+		case 'v':
+			if value != "0" {
+				return nil, fmt.Errorf("sdp: line %d: unsupported version %q", i+1, value)
+			}
+			seenVersion = true
+		case 'o':
+			sdp.Origin = value
+		case 's':
+			sdp.SessionName = value
+		case 'c':
+			address, ttl, err := parseSDPConnection(value)
+			if err != nil {
+				return nil, fmt.Errorf("sdp: line %d: %w", i+1, err)
+			}
+			if media == nil {
+				sessionAddress = address
+				sessionTTL = ttl
+			} else {
+				media.Address = address
+				media.TTL = ttl
+			}
+		case 'm':
+			if media != nil {
+				sdp.Media = append(sdp.Media, *media)
+			}
+			fields := strings.Fields(value)
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("sdp: line %d: malformed media line %q", i+1, value)
+			}
+			port, err := strconv.Atoi(fields[1])
+			if err != nil || port <= 0 || port > 0xFFFF {
+				return nil, fmt.Errorf("sdp: line %d: invalid port %q", i+1, fields[1])
+			}
+			payloadType, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return nil, fmt.Errorf("sdp: line %d: invalid payload type %q", i+1, fields[3])
+			}
+			media = &SDPMedia{
+				Media:        fields[0],
+				Port:         port,
+				Protocol:     fields[2],
+				PayloadType:  payloadType,
+				Address:      sessionAddress,
+				TTL:          sessionTTL,
+				SourceFilter: sessionFilter,
+				Format:       make(map[string]string),
+				Attributes:   make(map[string][]string),
+			}
+		case 'a':
+			name, attrValue, _ := strings.Cut(value, ":")
+			if media == nil {
+				switch name {
+				case "group":
+					semantics, mids, _ := strings.Cut(attrValue, " ")
+					if semantics == "DUP" {
+						sdp.DupGroup = strings.Fields(mids)
+					}
+				case "source-filter":
+					sessionFilter = parseSDPSourceFilter(attrValue)
+				}
+				continue
+			}
+			media.Attributes[name] = append(media.Attributes[name], attrValue)
+			switch name {
+			case "mid":
+				media.MID = attrValue
+			case "source-filter":
+				media.SourceFilter = parseSDPSourceFilter(attrValue)
+			case "rtpmap":
+				err := media.parseRTPMap(attrValue)
+				if err != nil {
+					return nil, fmt.Errorf("sdp: line %d: %w", i+1, err)
+				}
+			case "fmtp":
+				_, params, _ := strings.Cut(attrValue, " ")
+				for _, param := range strings.Split(params, ";") {
+					key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+					if key != "" {
+						media.Format[key] = val
+					}
+				}
+			}
+		}
+	}
+	if media != nil {
+		sdp.Media = append(sdp.Media, *media)
+	}
+	if !seenVersion {
+		return nil, fmt.Errorf("sdp: missing version line")
+	}
+	return sdp, nil
+}
+
+// parseSDPConnection parses "IN IP4 239.1.1.1/64" into its address and TTL
+func parseSDPConnection(value string) (string, int, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 || fields[0] != "IN" {
+		return "", 0, fmt.Errorf("malformed connection %q", value)
+	}
+	if fields[1] != "IP4" && fields[1] != "IP6" {
+		return "", 0, fmt.Errorf("unsupported address type %q", fields[1])
+	}
+	parts := strings.Split(fields[2], "/")
+	if net.ParseIP(parts[0]) == nil {
+		return "", 0, fmt.Errorf("invalid address %q", parts[0])
+	}
+	ttl := 0
+	if len(parts) > 1 {
+		var err error
+		ttl, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid TTL %q", parts[1])
+		}
+	}
+	return parts[0], ttl, nil
+}
+
+// parseSDPSourceFilter returns the source address from "incl IN IP4 239.1.1.1 10.0.0.1"
+func parseSDPSourceFilter(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) < 5 {
+		return ""
+	}
+	return fields[4]
+}
+
+// parseRTPMap parses "96 raw/90000" or "97 L24/48000/2"
+func (m *SDPMedia) parseRTPMap(value string) error {
+	payloadStr, encoding, _ := strings.Cut(value, " ")
+	payloadType, err := strconv.Atoi(payloadStr)
+	if err != nil {
+		return fmt.Errorf("invalid rtpmap %q", value)
+	}
+	if payloadType != m.PayloadType {
+		return nil
+	}
+	parts := strings.Split(encoding, "/")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid rtpmap %q", value)
+	}
+	m.Encoding = parts[0]
+	m.ClockRate, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid clock rate in rtpmap %q", value)
+	}
+	m.Channels = 1
+	if len(parts) > 2 {
+		m.Channels, err = strconv.Atoi(parts[2])
+		if err != nil {
+			return fmt.Errorf("invalid channel count in rtpmap %q", value)
+		}
+	}
+	return nil
+}
+
+// Essence returns which ST 2110 essence the media section carries
+func (m SDPMedia) Essence() string {
+	switch {
+	case m.Media == "video" && strings.EqualFold(m.Encoding, "smpte291"):
+		return EssenceData
+	case m.Media == "video":
+		return EssenceVideo
+	case m.Media == "audio":
+		return EssenceAudio
+	}
+	return ""
+}
+
+// Essence returns the essence of the stream described by the SDP
+func (s *SDP) Essence() string {
+	if len(s.Media) == 0 {
+		return ""
+	}
+	return s.Media[0].Essence()
+}
+
+// Validate checks the SDP describes a single ST 2110 stream, optionally with ST 2022-7 redundant paths
+func (s *SDP) Validate() error {
+	if len(s.Media) == 0 {
+		return fmt.Errorf("sdp: no media sections")
+	}
+	if len(s.Media) > 2 {
+		return fmt.Errorf("sdp: %d media sections, at most 2 (ST 2022-7) are supported", len(s.Media))
+	}
+	essence := s.Essence()
+	for i, m := range s.Media {
+		if m.Essence() != essence {
+			return fmt.Errorf("sdp: media %d: essence %q does not match %q", i, m.Essence(), essence)
+		}
+		err := m.validate()
+		if err != nil {
+			return fmt.Errorf("sdp: media %d: %w", i, err)
+		}
+	}
+
+	// Redundant (ST 2022-7) streams must be grouped by media ID
+	if len(s.Media) == 2 || len(s.DupGroup) > 0 {
+		if len(s.DupGroup) != len(s.Media) {
+			return fmt.Errorf("sdp: DUP group lists %d media IDs for %d media sections", len(s.DupGroup), len(s.Media))
+		}
+		for i, m := range s.Media {
+			if !slices.Contains(s.DupGroup, m.MID) {
+				return fmt.Errorf("sdp: media %d: mid %q not in DUP group", i, m.MID)
+			}
+		}
+		if s.Media[0].Address == s.Media[1].Address && s.Media[0].Port == s.Media[1].Port {
+			return fmt.Errorf("sdp: redundant paths share destination %s:%d", s.Media[0].Address, s.Media[0].Port)
+		}
+	}
+	return nil
+}
+
+func (m SDPMedia) validate() error {
+	if m.Protocol != "RTP/AVP" {
+		return fmt.Errorf("unsupported protocol %q", m.Protocol)
+	}
+	if m.Address == "" {
+		return fmt.Errorf("missing connection address")
+	}
+	ip := net.ParseIP(m.Address)
+	if ip.IsMulticast() {
+		if ip.To4() != nil && m.TTL <= 0 {
+			return fmt.Errorf("multicast address %s missing TTL", m.Address)
+		}
+	} else if ip.IsUnspecified() {
+		return fmt.Errorf("unspecified connection address %s", m.Address)
+	}
+	if m.SourceFilter != "" && net.ParseIP(m.SourceFilter) == nil {
+		return fmt.Errorf("invalid source filter address %q", m.SourceFilter)
+	}
+	if m.Encoding == "" {
+		return fmt.Errorf("missing rtpmap for payload type %d", m.PayloadType)
+	}
+
+	switch m.Essence() {
+	case EssenceVideo:
+		switch strings.ToLower(m.Encoding) {
+		case "raw":
+			// ST 2110-20
+			for _, key := range []string{"sampling", "width", "height", "exactframerate", "depth", "colorimetry"} {
+				if _, ok := m.Format[key]; !ok {
+					return fmt.Errorf("video missing fmtp parameter %q", key)
+				}
+			}
+		case "jxsv":
+			// ST 2110-22
+		default:
+			return fmt.Errorf("unsupported video encoding %q", m.Encoding)
+		}
+		if m.ClockRate != 90000 {
+			return fmt.Errorf("video clock rate %d, expected 90000", m.ClockRate)
+		}
+	case EssenceAudio:
+		switch strings.ToUpper(m.Encoding) {
+		case "L16", "L24", "AM824":
+			// ST 2110-30 / ST 2110-31
+		default:
+			return fmt.Errorf("unsupported audio encoding %q", m.Encoding)
+		}
+		if m.ClockRate != 48000 && m.ClockRate != 96000 {
+			return fmt.Errorf("audio clock rate %d, expected 48000 or 96000", m.ClockRate)
+		}
+		if m.Channels <= 0 {
+			return fmt.Errorf("audio channel count %d", m.Channels)
+		}
+	case EssenceData:
+		// ST 2110-40
+		if m.ClockRate != 90000 {
+			return fmt.Errorf("ancillary clock rate %d, expected 90000", m.ClockRate)
+		}
+	default:
+		return fmt.Errorf("unsupported media type %q", m.Media)
+	}
+	return nil
+}
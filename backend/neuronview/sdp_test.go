@@ -0,0 +1,163 @@
+package neuronview
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func readSDP(t *testing.T, name string) *SDP {
+	t.Helper()
+	text, err := os.ReadFile(filepath.Join("testdata", "sdp", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdp, err := ParseSDP(string(text))
+	if err != nil {
+		t.Fatalf("ParseSDP(%s): %v", name, err)
+	}
+	return sdp
+}
+
+func TestValidateValidSDPs(t *testing.T) {
+	tests := []struct {
+		file    string
+		essence string
+		media   int
+	}{
+		{"video_raw.sdp", EssenceVideo, 1},
+		{"video_jxsv.sdp", EssenceVideo, 1},
+		{"video_dup.sdp", EssenceVideo, 2},
+		{"audio_l24.sdp", EssenceAudio, 1},
+		{"audio_am824.sdp", EssenceAudio, 1},
+		{"audio_unicast_ipv6.sdp", EssenceAudio, 1},
+		{"anc.sdp", EssenceData, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			sdp := readSDP(t, tt.file)
+			if err := sdp.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if sdp.Essence() != tt.essence {
+				t.Errorf("Essence = %q, want %q", sdp.Essence(), tt.essence)
+			}
+			if len(sdp.Media) != tt.media {
+				t.Errorf("%d media sections, want %d", len(sdp.Media), tt.media)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidSDPs(t *testing.T) {
+	tests := []struct {
+		file string
+		err  string
+	}{
+		{"video_missing_fmtp.sdp", `video missing fmtp parameter "depth"`},
+		{"video_clock_rate.sdp", "video clock rate 48000"},
+		{"video_encoding.sdp", `unsupported video encoding "H264"`},
+		{"audio_clock_rate.sdp", "audio clock rate 44100"},
+		{"audio_encoding.sdp", `unsupported audio encoding "opus"`},
+		{"anc_clock_rate.sdp", "ancillary clock rate 48000"},
+		{"multicast_no_ttl.sdp", "missing TTL"},
+		{"no_rtpmap.sdp", "missing rtpmap for payload type 97"},
+		{"wrong_protocol.sdp", `unsupported protocol "RTP/SAVP"`},
+		{"dup_missing_group.sdp", "DUP group lists 0 media IDs for 2 media sections"},
+		{"dup_mid_mismatch.sdp", `media 1: mid "backup" not in DUP group`},
+		{"dup_same_destination.sdp", "redundant paths share destination 239.100.2.1:50010"},
+		{"dup_mixed_essence.sdp", `media 1: essence "audio" does not match "data"`},
+		{"dup_three_paths.sdp", "3 media sections"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			err := readSDP(t, tt.file).Validate()
+			if err == nil {
+				t.Fatal("Validate succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Validate error %q, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseSDPFields(t *testing.T) {
+	sdp := readSDP(t, "video_dup.sdp")
+	if !slices.Equal(sdp.DupGroup, []string{"primary", "secondary"}) {
+		t.Errorf("DupGroup = %v", sdp.DupGroup)
+	}
+	m := sdp.Media[1]
+	if m.Address != "239.200.1.1" || m.TTL != 64 || m.Port != 50000 {
+		t.Errorf("connection = %s/%d port %d", m.Address, m.TTL, m.Port)
+	}
+	if m.SourceFilter != "192.168.20.11" {
+		t.Errorf("SourceFilter = %q", m.SourceFilter)
+	}
+	if m.MID != "secondary" {
+		t.Errorf("MID = %q", m.MID)
+	}
+	if m.Encoding != "raw" || m.ClockRate != 90000 || m.Channels != 1 {
+		t.Errorf("rtpmap = %s/%d/%d", m.Encoding, m.ClockRate, m.Channels)
+	}
+	if m.Format["width"] != "1920" || m.Format["exactframerate"] != "25" {
+		t.Errorf("Format = %v", m.Format)
+	}
+
+	audio := readSDP(t, "audio_l24.sdp").Media[0]
+	if audio.Channels != 8 || audio.ClockRate != 48000 {
+		t.Errorf("audio rtpmap = %s/%d/%d", audio.Encoding, audio.ClockRate, audio.Channels)
+	}
+	if !slices.Equal(audio.Attributes["ptime"], []string{"1"}) {
+		t.Errorf("ptime = %v", audio.Attributes["ptime"])
+	}
+}
+
+func TestParseSDPSessionConnection(t *testing.T) {
+	// Session level connection and source filter apply to every media section
+	text := "v=0\r\ns=Session\r\nc=IN IP4 239.1.1.1/32\r\na=source-filter: incl IN IP4 239.1.1.1 10.0.0.1\r\nm=audio 5004 RTP/AVP 97\r\na=rtpmap:97 L24/48000/2\r\n"
+	sdp, err := ParseSDP(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := sdp.Media[0]
+	if m.Address != "239.1.1.1" || m.TTL != 32 || m.SourceFilter != "10.0.0.1" {
+		t.Errorf("media connection = %s/%d from %s", m.Address, m.TTL, m.SourceFilter)
+	}
+	if err := sdp.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestParseSDPErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		err  string
+	}{
+		{"no version", "s=x\nm=audio 5004 RTP/AVP 97\n", "missing version line"},
+		{"bad version", "v=1\n", `unsupported version "1"`},
+		{"malformed line", "v=0\nhello\n", "line 2: malformed line"},
+		{"bad port", "v=0\nm=audio 70000 RTP/AVP 97\n", `invalid port "70000"`},
+		{"short media", "v=0\nm=audio 5004\n", "malformed media line"},
+		{"bad payload type", "v=0\nm=audio 5004 RTP/AVP x\n", `invalid payload type "x"`},
+		{"bad address", "v=0\nc=IN IP4 not-an-ip/32\n", `invalid address "not-an-ip"`},
+		{"bad address type", "v=0\nc=IN IPX 239.1.1.1\n", `unsupported address type "IPX"`},
+		{"bad ttl", "v=0\nc=IN IP4 239.1.1.1/x\n", `invalid TTL "x"`},
+		{"bad rtpmap", "v=0\nm=audio 5004 RTP/AVP 97\na=rtpmap:97 L24\n", "invalid rtpmap"},
+		{"bad channels", "v=0\nm=audio 5004 RTP/AVP 97\na=rtpmap:97 L24/48000/x\n", "invalid channel count"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSDP(tt.text)
+			if err == nil {
+				t.Fatal("ParseSDP succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseSDP error %q, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
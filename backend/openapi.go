@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/neuronview"
+	"github.com/cassaram/bfc/backend/openapi"
+	"github.com/cassaram/bfc/backend/router"
+)
+
+// apiV1Route documents a route registered in GetServeMux
+type apiV1Route struct {
+	Summary     string
+	Description string
+	Tag         string
+	Query       []openapi.Parameter
+	Request     any // Body type, nil if the route takes no body
+	Response    any // Body type, nil if the route returns no body
+	Stale       bool
+	Paginated   bool // Takes limit and offset and returns X-Total-Count
+}
+
+var apiV1Routes = map[string]apiV1Route{
+	"/ws": {
+		Summary:     "Websocket stream of changes",
+		Description: "Upgrades to a websocket. By default each message is a Crosspoint. With format=events each message is an Event.",
+		Tag:         "events",
+		Query:       []openapi.Parameter{queryParam("format", "Set to \"events\" to receive Event messages", false), nameSetParam},
+		Response:    apiv1.Event{},
+	},
+	"GET /drivers":                          {Summary: "List available router drivers", Tag: "admin", Response: []router.Driver{}},
+	"GET /routers":                          {Summary: "List routers", Tag: "routers", Response: []apiv1.Router{}},
+	"GET /routers/{router_id}/capabilities": {Summary: "Get router capabilities", Tag: "routers", Response: router.Capabilities{}},
+	"GET /routers/{router_id}/status":       {Summary: "Get router connection status", Tag: "routers", Response: router.Status{}},
+	"GET /routers/{router_id}/table":        {Summary: "Get the crosspoint table by destination", Tag: "routers", Response: []apiv1.RouterTableLine{}, Query: []openapi.Parameter{nameSetParam}, Stale: true},
+	"GET /routers/{router_id}/validsources": {Summary: "Get the sources which can be routed to each level", Tag: "routers", Response: apiv1.RouterTableValidSources{}, Query: []openapi.Parameter{nameSetParam}, Stale: true},
+	"GET /routers/{router_id}/crosspoints": {
+		Summary:     "List crosspoints",
+		Description: "With at, the crosspoints as they were at that time, reconstructed from the crosspoint history.",
+		Tag:         "crosspoints",
+		Query:       []openapi.Parameter{queryParam("at", "Past time as an RFC 3339 time", false)},
+		Response:    []router.Crosspoint{},
+		Stale:       true,
+	},
+	"GET /routers/{router_id}/history": {
+		Summary:     "List crosspoint changes",
+		Description: "Changes between from and to in time order, named with the destination and source names they have now.",
+		Tag:         "crosspoints",
+		Query: []openapi.Parameter{
+			queryParam("destination", "Only changes of this destination, by ID or name", false),
+			queryParam("from", "Start as an RFC 3339 time, defaults to 24 hours before to", false),
+			queryParam("to", "End as an RFC 3339 time, defaults to now", false),
+			nameSetParam,
+		},
+		Response: []apiv1.HistoryEntry{},
+	},
+	"PUT /routers/{router_id}/crosspoints": {
+		Summary:     "Route a crosspoint",
+		Description: "Destination, source and levels can be given by ID or name. Unknown names return 404, ambiguous names 409. Destinations in another user's active booking return 403.",
+		Tag:         "crosspoints",
+		Request:     apiv1.CrosspointRequest{},
+	},
+	"PUT /routers/{router_id}/crosspoints/lock": {Summary: "Lock or unlock a destination", Description: "Destinations in another user's active booking return 403.", Tag: "crosspoints", Request: apiv1.CrosspointLockRequest{}},
+	"PUT /routers/{router_id}/crosspoints/mapped": {
+		Summary:     "Route a source with a level mapping preset",
+		Description: "Routes each source level of the preset to its destination level. Every source level must be one of the source's levels, otherwise nothing is routed and 400 is returned. Destinations in another user's active booking return 403.",
+		Tag:         "crosspoints",
+		Request:     apiv1.MappedCrosspointRequest{},
+	},
+	"GET /routers/{router_id}/level_mappings": {Summary: "List the router's level mapping presets", Tag: "routers", Response: []apiv1.LevelMapping{}},
+	"GET /routers/{router_id}/destinations": {
+		Summary:     "List or search destinations",
+		Description: "Without q destinations are sorted by ID, with q best matches come first.",
+		Tag:         "routers",
+		Query:       append([]openapi.Parameter{nameSetParam}, searchParams...),
+		Response:    []router.Destination{},
+		Stale:       true,
+		Paginated:   true,
+	},
+	"GET /routers/{router_id}/levels": {Summary: "List levels", Tag: "routers", Response: []router.Level{}, Stale: true},
+	"GET /routers/{router_id}/sources": {
+		Summary:     "List or search sources",
+		Description: "Without q sources are sorted by ID, with q best matches come first.",
+		Tag:         "routers",
+		Query:       append([]openapi.Parameter{nameSetParam}, searchParams...),
+		Response:    []router.Source{},
+		Stale:       true,
+		Paginated:   true,
+	},
+	"GET /routers/{router_id}/tags":                            {Summary: "List the tags used on a router's sources and destinations", Tag: "routers", Response: []string{}},
+	"PUT /routers/{router_id}/sources/{source}/tags":           {Summary: "Replace the tags added to a source through the API", Description: "Tags from the config's tag rules are kept.", Tag: "routers", Request: []string{}},
+	"PUT /routers/{router_id}/destinations/{destination}/tags": {Summary: "Replace the tags added to a destination through the API", Description: "Tags from the config's tag rules are kept.", Tag: "routers", Request: []string{}},
+	"POST /routers/{router_id}/multiviewer/layout":             {Summary: "Generate a multiviewer layout from the router's destinations", Tag: "multiviewer", Request: apiv1.MultiviewerLayoutRequest{}, Response: neuronview.Layout{}, Query: []openapi.Parameter{nameSetParam}, Stale: true},
+	"POST /multiviewer/streams/sdp":                            {Summary: "Assign SDPs to multiviewer input streams", Tag: "multiviewer", Request: apiv1.MultiviewerStreamsSDPRequest{}, Response: apiv1.MultiviewerStreamsSDPResponse{}},
+	"GET /routers/{router_id}/namesets":                        {Summary: "List name sets", Tag: "namesets", Response: []apiv1.NameSet{}},
+	"GET /routers/{router_id}/namesets/{name}":                 {Summary: "Get a name set", Tag: "namesets", Response: apiv1.NameSet{}},
+	"PUT /routers/{router_id}/namesets/{name}":                 {Summary: "Create or replace a name set", Tag: "namesets", Request: apiv1.NameSet{}},
+	"DELETE /routers/{router_id}/namesets/{name}":              {Summary: "Delete a name set", Tag: "namesets"},
+	"GET /user": {
+		Summary:     "Get the requesting user and their preferences",
+		Description: "Users are identified by their TLS client certificate, or by the X-BFC-User header when http.trust_user_header is set and no client CA is configured.",
+		Tag:         "users",
+		Response:    apiv1.User{},
+	},
+	"PUT /user/preferences": {Summary: "Set the requesting user's preferences", Tag: "users", Request: apiv1.UserPreferences{}},
+	"GET /user/panels":      {Summary: "List the requesting user's panels", Tag: "users", Response: []apiv1.Panel{}},
+	"GET /user/panels/{name}": {
+		Summary:     "Get a panel with the current crosspoints of its destinations",
+		Description: "Rows are in panel order. Rows of routers which aren't ready are served from their last known state and marked stale.",
+		Tag:         "users",
+		Query:       []openapi.Parameter{nameSetParam},
+		Response:    apiv1.PanelState{},
+		Stale:       true,
+	},
+	"PUT /user/panels/{name}":    {Summary: "Create or replace a panel", Description: "Destinations and sources given by name are saved as IDs.", Tag: "users", Request: apiv1.Panel{}},
+	"DELETE /user/panels/{name}": {Summary: "Delete a panel", Tag: "users"},
+	"GET /undo":                  {Summary: "List the requesting user's operations which can be undone, newest first", Description: "Only operations requested through the API are recorded, not scheduled jobs.", Tag: "undo", Response: []apiv1.UndoOperation{}},
+	"POST /undo": {
+		Summary:     "Undo the requesting user's most recent route or salvo",
+		Description: "Routes the crosspoints the operation overwrote. Fails with 409 if any of its destinations has changed since or is locked, and 404 if there is nothing to undo.",
+		Tag:         "undo",
+		Response:    apiv1.UndoOperation{},
+	},
+	"GET /salvos":              {Summary: "List salvos", Tag: "salvos", Response: []apiv1.Salvo{}},
+	"GET /salvos/{name}":       {Summary: "Get a salvo", Tag: "salvos", Response: apiv1.Salvo{}},
+	"PUT /salvos/{name}":       {Summary: "Create or replace a salvo", Tag: "salvos", Request: apiv1.Salvo{}},
+	"DELETE /salvos/{name}":    {Summary: "Delete a salvo", Tag: "salvos"},
+	"POST /salvos/{name}/fire": {Summary: "Route every crosspoint of a salvo", Tag: "salvos", Response: apiv1.SalvoFireResult{}},
+	"GET /snapshots":           {Summary: "List snapshots", Tag: "snapshots", Response: []apiv1.Snapshot{}},
+	"GET /snapshots/{name}":    {Summary: "Get a snapshot", Tag: "snapshots", Response: apiv1.Snapshot{}},
+	"PUT /snapshots/{name}": {
+		Summary:     "Save the current crosspoints of routers as a snapshot",
+		Description: "Saves every router unless router_ids is given, replacing any snapshot with the same name. Fails with 409 if a router is not ready.",
+		Tag:         "snapshots",
+		Request:     apiv1.SnapshotRequest{},
+		Response:    apiv1.Snapshot{},
+	},
+	"DELETE /snapshots/{name}":       {Summary: "Delete a snapshot", Tag: "snapshots"},
+	"POST /snapshots/{name}/restore": {Summary: "Route every crosspoint of a snapshot", Tag: "snapshots", Response: apiv1.SalvoFireResult{}},
+	"GET /audit": {
+		Summary:     "List audit records of changes made through BFC",
+		Description: "Routes, locks, salvos, snapshots, undos and config reloads between from and to in time order.",
+		Tag:         "audit",
+		Query: []openapi.Parameter{
+			queryParam("from", "Start as an RFC 3339 time, defaults to 24 hours before to", false),
+			queryParam("to", "End as an RFC 3339 time, defaults to now", false),
+			queryParam("user", "Only records of this user", false),
+			queryParam("action", "Only records of this action", false),
+			queryParam("limit", "Only the newest records up to this number", false),
+		},
+		Response: []apiv1.AuditRecord{},
+	},
+	"GET /schedule/jobs":        {Summary: "List scheduled jobs", Tag: "schedule", Response: []apiv1.Job{}},
+	"GET /schedule/jobs/{name}": {Summary: "Get a scheduled job", Tag: "schedule", Response: apiv1.Job{}},
+	"PUT /schedule/jobs/{name}": {
+		Summary:     "Create or replace a scheduled job",
+		Description: "A job routes a salvo or crosspoints once at a time, or repeatedly following a cron expression read in the job's timezone. Replacing a job restarts its schedule from now.",
+		Tag:         "schedule",
+		Request:     apiv1.Job{},
+	},
+	"DELETE /schedule/jobs/{name}":      {Summary: "Delete a scheduled job and its results", Tag: "schedule"},
+	"GET /schedule/jobs/{name}/results": {Summary: "List the results of a job's runs, newest first", Tag: "schedule", Response: []apiv1.JobResult{}},
+	"GET /schedule/upcoming": {
+		Summary: "Preview the upcoming runs of all enabled jobs",
+		Tag:     "schedule",
+		Query: []openapi.Parameter{
+			queryParam("until", "End of the preview as an RFC 3339 time, defaults to 24 hours from now", false),
+			queryParam("limit", "Maximum number of runs, defaults to 100", false),
+		},
+		Response: []apiv1.ScheduledRun{},
+	},
+	"GET /bookings": {
+		Summary:     "List bookings on a timeline",
+		Description: "Bookings overlapping the time window, in start order.",
+		Tag:         "bookings",
+		Query: []openapi.Parameter{
+			queryParam("from", "Start of the window as an RFC 3339 time, defaults to now", false),
+			queryParam("to", "End of the window as an RFC 3339 time, defaults to 7 days from now", false),
+			queryParam("router", "Only bookings on this router, by ID or short name", false),
+			queryParam("destination", "Only bookings of this destination of the router, by ID or name", false),
+		},
+		Response: []apiv1.Booking{},
+	},
+	"GET /bookings/{name}": {Summary: "Get a booking", Tag: "bookings", Response: apiv1.Booking{}},
+	"PUT /bookings/{name}": {
+		Summary:     "Create or replace a booking",
+		Description: "The requesting user owns the booking. Overlapping bookings of one of its destinations with a lower priority which haven't started are displaced: they are ended and name this booking in displaced_by. Fails with 409 if it overlaps any other booking. Only the owner can replace a booking.",
+		Tag:         "bookings",
+		Request:     apiv1.Booking{},
+		Response:    apiv1.Booking{},
+	},
+	"DELETE /bookings/{name}": {Summary: "Delete a booking", Description: "Only the owner can delete a booking. A running booking is ended instead: its release sources are routed and it is kept with the ended bookings.", Tag: "bookings"},
+	"POST /admin/reload":      {Summary: "Reload the config file", Description: "Changes to the data and history files, HTTP listeners and TLS, and the Ember+ listener are listed in restart_required and only applied on a restart.", Tag: "admin", Response: apiv1.ReloadResult{}},
+	"GET /openapi.json":       {Summary: "Get this OpenAPI document", Tag: "admin", Response: map[string]any{}},
+}
+
+var nameSetParam = queryParam("nameset", "Name set to show names from, defaults to the user's preferred name set", false)
+
+var searchParams = []openapi.Parameter{
+	queryParam("q", "Fuzzy match on the name", false),
+	queryParam("tag", "Only items with this tag, can be repeated", false),
+	queryParam("level", "Only items on this level, by name or ID", false),
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+func queryParam(name string, description string, required bool) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Required: required, Schema: &openapi.Schema{Type: "string"}}
+}
+
+// OpenAPI builds the OpenAPI document for every route registered on the v1 mux
+func (a *APIHandler) OpenAPI() *openapi.Document {
+	doc := openapi.NewDocument(openapi.Info{
+		Title:       "BFC API",
+		Description: "Broadcast router control. Errors are returned as plain text with a 4xx or 5xx status.",
+		Version:     "1",
+	})
+	doc.Servers = []openapi.Server{{URL: "/api/v1"}}
+	errorResponse := openapi.Response{
+		Description: "Error",
+		Content:     map[string]openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}},
+	}
+
+	for _, pattern := range a.patterns {
+		method, path, found := strings.Cut(pattern, " ")
+		if !found {
+			method, path = "GET", pattern
+		}
+		route, ok := apiV1Routes[pattern]
+		if !ok {
+			route = apiV1Route{Summary: pattern}
+		}
+		op := &openapi.Operation{
+			Summary:     route.Summary,
+			Description: route.Description,
+			OperationID: operationID(method, path),
+			Parameters:  make([]openapi.Parameter, 0),
+			Responses:   map[string]openapi.Response{"default": errorResponse},
+		}
+		if route.Tag != "" {
+			op.Tags = []string{route.Tag}
+		}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+			param := openapi.Parameter{Name: match[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}}
+			switch match[1] {
+			case "router_id":
+				param.Description = "Router ID or short name"
+			case "source", "destination":
+				param.Description = "ID or name"
+			}
+			op.Parameters = append(op.Parameters, param)
+		}
+		op.Parameters = append(op.Parameters, route.Query...)
+		if route.Paginated {
+			op.Parameters = append(op.Parameters,
+				openapi.Parameter{Name: "limit", In: "query", Description: "Maximum number of items, all if 0", Schema: &openapi.Schema{Type: "integer"}},
+				openapi.Parameter{Name: "offset", In: "query", Description: "Number of items to skip", Schema: &openapi.Schema{Type: "integer"}},
+			)
+		}
+		if route.Request != nil {
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: doc.JSONContent(route.Request)}
+		}
+		ok200 := openapi.Response{Description: "OK"}
+		if route.Response != nil {
+			ok200.Content = doc.JSONContent(route.Response)
+		}
+		if route.Stale {
+			ok200.Headers = map[string]openapi.Header{
+				"X-BFC-Stale": {Description: "\"true\" when the router isn't ready and the last known state is returned", Schema: &openapi.Schema{Type: "string"}},
+			}
+		}
+		if route.Paginated {
+			if ok200.Headers == nil {
+				ok200.Headers = make(map[string]openapi.Header)
+			}
+			ok200.Headers["X-Total-Count"] = openapi.Header{Description: "Number of matching items before pagination", Schema: &openapi.Schema{Type: "integer"}}
+		}
+		op.Responses["200"] = ok200
+		doc.AddOperation(method, path, op)
+	}
+	return doc
+}
+
+// operationID turns "GET /routers/{router_id}/table" into "getRoutersTable". Parameters ending the
+// path are added with "By", so "GET /salvos/{name}" is "getSalvosByName" and differs from "getSalvos".
+func operationID(method string, path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	by := make([]string, 0)
+	for len(parts) > 0 && strings.HasPrefix(parts[len(parts)-1], "{") {
+		by = append([]string{camelCase(strings.Trim(parts[len(parts)-1], "{}"))}, by...)
+		parts = parts[:len(parts)-1]
+	}
+	id := strings.ToLower(method)
+	for _, part := range parts {
+		if part == "" || strings.HasPrefix(part, "{") {
+			continue
+		}
+		part = strings.TrimSuffix(part, ".json")
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	if len(by) > 0 {
+		id += "By" + strings.Join(by, "And")
+	}
+	return id
+}
+
+// camelCase turns "router_id" into "RouterId"
+func camelCase(name string) string {
+	words := strings.Split(name, "_")
+	for i, word := range words {
+		if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, "")
+}
+
+func (a *APIHandler) APIV1HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	docBody, err := json.MarshalIndent(a.OpenAPI(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(docBody)
+}
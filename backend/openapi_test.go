@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOperationID(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "/routers", "getRouters"},
+		{"GET", "/routers/{router_id}", "getRoutersByRouterId"},
+		{"GET", "/routers/{router_id}/table", "getRoutersTable"},
+		{"PUT", "/routers/{router_id}/sources/{source}/tags", "putRoutersSourcesTags"},
+		{"GET", "/salvos/{name}", "getSalvosByName"},
+		{"GET", "/openapi.json", "getOpenapi"},
+	}
+	for _, tt := range tests {
+		if got := operationID(tt.method, tt.path); got != tt.want {
+			t.Errorf("operationID(%s, %s) = %s, want %s", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestOperationIDsUnique(t *testing.T) {
+	patterns := make(map[string]string)
+	for pattern := range apiV1Routes {
+		method, path, found := strings.Cut(pattern, " ")
+		if !found {
+			method, path = "GET", pattern
+		}
+		id := operationID(method, path)
+		if other, ok := patterns[id]; ok {
+			t.Errorf("%q and %q both have operationId %s", pattern, other, id)
+		}
+		patterns[id] = pattern
+	}
+}
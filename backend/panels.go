@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/router"
+	"github.com/cassaram/bfc/backend/store"
+)
+
+func getPanel(user string, name string) (apiv1.Panel, error) {
+	panel := apiv1.Panel{}
+	err := Store.Get(store.BucketPanels, store.PanelKey(user, name), &panel)
+	return panel, err
+}
+
+// resolvePanelDestination fills in the IDs of a panel row from its names or IDs
+func resolvePanelDestination(pd apiv1.PanelDestination, r *http.Request) (apiv1.PanelDestination, error) {
+	rtrs, err := resolveViews(pd.RouterID, r)
+	if err != nil {
+		return pd, err
+	}
+	if pd.Destination != "" {
+		dest, err := resolveIn(rtrs, pd.Destination, router.ResolveDestination)
+		if err != nil {
+			return pd, err
+		}
+		pd.DestinationID = dest.ID
+	}
+	if pd.DestinationID == 0 {
+		return pd, errors.New("destination is required")
+	}
+	for _, ref := range pd.Sources {
+		src, err := resolveIn(rtrs, ref, router.ResolveSource)
+		if err != nil {
+			return pd, err
+		}
+		pd.SourceIDs = append(pd.SourceIDs, src.ID)
+	}
+	pd.Destination = ""
+	pd.Sources = nil
+	return pd, nil
+}
+
+// panelRow returns a panel destination with its current crosspoints, named with the request's name set
+func panelRow(pd apiv1.PanelDestination, r *http.Request) apiv1.PanelRow {
+	row := apiv1.PanelRow{
+		RouterID:            pd.RouterID,
+		DestinationID:       pd.DestinationID,
+		Crosspoints:         make([]apiv1.RouterTableCrosspoint, 0),
+		CrosspointsAsString: make([]string, 0),
+		Sources:             make([]apiv1.PanelSource, 0, len(pd.SourceIDs)),
+	}
+	rtr, rtr_ok := getRouter(pd.RouterID)
+	if !rtr_ok {
+		row.Error = fmt.Sprintf("Router ID (%d) not found", pd.RouterID)
+		return row
+	}
+	rtr, row.Stale = withLastKnownState(pd.RouterID, rtr)
+	// A name set only applies to the routers which have it
+	rtr, _ = withNameSet(pd.RouterID, rtr, r)
+	row.Name = rtr.GetDestination(pd.DestinationID).Name
+	levels := rtr.GetLevels()
+	row.Crosspoints = make([]apiv1.RouterTableCrosspoint, len(levels))
+	row.CrosspointsAsString = make([]string, len(levels))
+	for _, xpt := range rtr.GetCrosspoints() {
+		if xpt.Destination != pd.DestinationID || xpt.DestinationLevel < 1 || xpt.DestinationLevel > len(levels) {
+			continue
+		}
+		row.Crosspoints[xpt.DestinationLevel-1] = apiv1.RouterTableCrosspoint{
+			DestinationLevelID: xpt.DestinationLevel,
+			SourceID:           xpt.Source,
+			SourceLevelID:      xpt.SourceLevel,
+			Locked:             xpt.Locked,
+		}
+		row.CrosspointsAsString[xpt.DestinationLevel-1] = rtr.GetSource(xpt.Source).Name + "." + rtr.GetLevel(xpt.SourceLevel).Name
+	}
+	for _, srcID := range pd.SourceIDs {
+		row.Sources = append(row.Sources, apiv1.PanelSource{ID: srcID, Name: rtr.GetSource(srcID).Name})
+	}
+	return row
+}
+
+func (a *APIHandler) APIV1HandlePanels(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	if user == "" {
+		http.Error(w, errNoUser.Error(), http.StatusBadRequest)
+		return
+	}
+	keys, err := Store.Keys(store.BucketPanels)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	panels := make([]apiv1.Panel, 0)
+	prefix := store.PanelKey(user, "")
+	for _, key := range keys {
+		escaped, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		name, err := url.PathUnescape(escaped)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		panel, err := getPanel(user, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		panels = append(panels, panel)
+	}
+	panelsBody, err := json.Marshal(panels)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(panelsBody)
+}
+
+func (a *APIHandler) APIV1HandlePanel(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	if user == "" {
+		http.Error(w, errNoUser.Error(), http.StatusBadRequest)
+		return
+	}
+	name := r.PathValue("name")
+	panel, err := getPanel(user, name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Panel (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := apiv1.PanelState{Name: panel.Name, Rows: make([]apiv1.PanelRow, 0, len(panel.Destinations))}
+	for _, pd := range panel.Destinations {
+		row := panelRow(pd, r)
+		if row.Stale {
+			w.Header().Set("X-BFC-Stale", "true")
+		}
+		response.Rows = append(response.Rows, row)
+	}
+	respBody, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(respBody)
+}
+
+func (a *APIHandler) APIV1HandlePanelPut(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	if user == "" {
+		http.Error(w, errNoUser.Error(), http.StatusBadRequest)
+		return
+	}
+	body := apiv1.Panel{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	body.Name = r.PathValue("name")
+	if body.Destinations == nil {
+		body.Destinations = make([]apiv1.PanelDestination, 0)
+	}
+	for i, pd := range body.Destinations {
+		body.Destinations[i], err = resolvePanelDestination(pd, r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Destination %d: %s", i+1, err.Error()), resolveStatus(err))
+			return
+		}
+	}
+	err = Store.Put(store.BucketPanels, store.PanelKey(user, body.Name), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *APIHandler) APIV1HandlePanelDelete(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	if user == "" {
+		http.Error(w, errNoUser.Error(), http.StatusBadRequest)
+		return
+	}
+	name := r.PathValue("name")
+	_, err := getPanel(user, name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Panel (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	err = Store.Delete(store.BucketPanels, store.PanelKey(user, name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
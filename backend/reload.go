@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/config"
+	"github.com/cassaram/bfc/backend/router"
+	log "github.com/sirupsen/logrus"
+)
+
+// RoutersMutex guards Routers, ConfigFile and TagRules, which are swapped on config reload
+var RoutersMutex sync.RWMutex
+
+// ConfigPath is the config file loaded on startup and on reload
+var ConfigPath string
+
+var reloadMutex sync.Mutex
+
+func getRouter(routerID int) (router.Router, bool) {
+	RoutersMutex.RLock()
+	rtr, ok := Routers[routerID]
+	RoutersMutex.RUnlock()
+	return rtr, ok
+}
+
+func getConfig() config.ConfigFile {
+	RoutersMutex.RLock()
+	cfg := ConfigFile
+	RoutersMutex.RUnlock()
+	return cfg
+}
+
+func getRouterConfig(routerID int) (config.RouterConfig, bool) {
+	for _, rtrCfg := range getConfig().Routers {
+		if rtrCfg.ID == routerID {
+			return rtrCfg, true
+		}
+	}
+	return config.RouterConfig{}, false
+}
+
+// newRouter creates and initialises the driver for a router config
+func newRouter(rtrCfg config.RouterConfig) (router.Router, error) {
+	driver, ok := router.LookupDriver(rtrCfg.Type)
+	if !ok {
+		return nil, fmt.Errorf("invalid router type: %s", rtrCfg.Type)
+	}
+	rtr := driver.New()
+	err := rtr.Init(rtrCfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	rtr.SetCrosspointNotifyFunc(crosspointNotifier(rtrCfg.ID))
+	rtr.SetStatusNotifyFunc(statusNotifier(rtrCfg.ID))
+	return rtr, nil
+}
+
+// stopRouter stops a router, giving up waiting after timeout
+func stopRouter(routerID int, rtr router.Router, timeout time.Duration) {
+	stopped := make(chan bool)
+	go func() {
+		rtr.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		log.Warnf("Router %d: Timed out stopping router", routerID)
+	}
+}
+
+// applyLogLevel sets the log level from the config
+func applyLogLevel(level string) {
+	switch strings.ToLower(level) {
+	case "trace":
+		log.SetLevel(log.TraceLevel)
+	case "debug":
+		log.SetLevel(log.DebugLevel)
+	case "info":
+		log.SetLevel(log.InfoLevel)
+	case "warn":
+		log.SetLevel(log.WarnLevel)
+	case "error":
+		log.SetLevel(log.ErrorLevel)
+	case "fatal":
+		log.SetLevel(log.FatalLevel)
+	case "panic":
+		log.SetLevel(log.PanicLevel)
+	}
+}
+
+// reloadConfig loads the config file again and applies the differences.
+// Routers whose type and driver config are unchanged keep their connections.
+func reloadConfig() (apiv1.ReloadResult, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	result := apiv1.ReloadResult{
+		Added:           make([]int, 0),
+		Removed:         make([]int, 0),
+		Restarted:       make([]int, 0),
+		RestartRequired: make([]string, 0),
+	}
+	newCfg, err := loadConfig(ConfigPath)
+	if err != nil {
+		return result, err
+	}
+	oldCfg := getConfig()
+	// The data and history files, HTTP listeners and TLS, and the Ember+ listener can only be changed
+	// with a restart. The running values are kept so the config matches what is running.
+	newHTTP := newCfg.HTTP
+	newCfg.HTTP = oldCfg.HTTP
+	// CORS origins, the frontend's API URL and trusting the user header are read per request
+	newCfg.HTTP.CORSAllowedOrigins = newHTTP.CORSAllowedOrigins
+	newCfg.HTTP.APIURL = newHTTP.APIURL
+	newCfg.HTTP.TrustUserHeader = newHTTP.TrustUserHeader
+	restartOnly := []struct {
+		name    string
+		changed bool
+	}{
+		{"data_file", newCfg.DataFile != oldCfg.DataFile},
+		{"history_file", newCfg.HistoryFile != oldCfg.HistoryFile},
+		{"history_retention_days", newCfg.HistoryRetentionDays != oldCfg.HistoryRetentionDays},
+		{"http", !reflect.DeepEqual(newHTTP, newCfg.HTTP)},
+		{"emberplus.listen_address", newCfg.EmberPlus.ListenAddress != oldCfg.EmberPlus.ListenAddress},
+	}
+	for _, setting := range restartOnly {
+		if setting.changed {
+			result.RestartRequired = append(result.RestartRequired, setting.name)
+		}
+	}
+	newCfg.DataFile = oldCfg.DataFile
+	newCfg.EmberPlus.ListenAddress = oldCfg.EmberPlus.ListenAddress
+	newCfg.HistoryFile = oldCfg.HistoryFile
+	newCfg.HistoryRetentionDays = oldCfg.HistoryRetentionDays
+
+	oldRouters := make(map[int]config.RouterConfig)
+	for _, rtrCfg := range oldCfg.Routers {
+		oldRouters[rtrCfg.ID] = rtrCfg
+	}
+	newRouters := make(map[int]config.RouterConfig)
+	for _, rtrCfg := range newCfg.Routers {
+		newRouters[rtrCfg.ID] = rtrCfg
+	}
+
+	// Create drivers for new and changed routers before touching running ones, so a bad config changes nothing
+	started := make(map[int]router.Router)
+	for id, rtrCfg := range newRouters {
+		oldRtrCfg, exists := oldRouters[id]
+		if exists && strings.EqualFold(oldRtrCfg.Type, rtrCfg.Type) && reflect.DeepEqual(oldRtrCfg.Config, rtrCfg.Config) {
+			continue
+		}
+		rtr, err := newRouter(rtrCfg)
+		if err != nil {
+			return result, fmt.Errorf("router %d: %w", id, err)
+		}
+		started[id] = rtr
+		if exists {
+			result.Restarted = append(result.Restarted, id)
+		} else {
+			result.Added = append(result.Added, id)
+		}
+	}
+
+	// Swap in the new config and routers
+	tagRules := compileTagRules(newCfg)
+	stopped := make(map[int]router.Router)
+	RoutersMutex.Lock()
+	for id := range oldRouters {
+		if _, exists := newRouters[id]; !exists {
+			stopped[id] = Routers[id]
+			delete(Routers, id)
+			result.Removed = append(result.Removed, id)
+		}
+	}
+	for id, rtr := range started {
+		if oldRtr, exists := Routers[id]; exists {
+			stopped[id] = oldRtr
+		}
+		Routers[id] = rtr
+	}
+	ConfigFile = newCfg
+	TagRules = tagRules
+	RoutersMutex.Unlock()
+	applyLogLevel(newCfg.LogLevel)
+
+	for id, rtr := range stopped {
+		log.Infof("Router %d: Stopping", id)
+		stopRouter(id, rtr, 5*time.Second)
+	}
+	for id, rtr := range started {
+		log.Infof("Router %d: Starting", id)
+		rtr.Start()
+	}
+	log.Infof("Config reloaded: %d added, %d removed, %d restarted", len(result.Added), len(result.Removed), len(result.Restarted))
+	if len(result.RestartRequired) > 0 {
+		log.Warn("Config reloaded: Restart BFC to apply changes to ", strings.Join(result.RestartRequired, ", "))
+	}
+	return result, nil
+}
+
+// watchConfig reloads the config when SIGHUP is received or the config file is modified
+func watchConfig(pollInterval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	lastModified := configModTime()
+	for {
+		select {
+		case <-hup:
+			log.Info("Received SIGHUP, reloading config")
+		case <-ticker.C:
+			modified := configModTime()
+			if modified.Equal(lastModified) {
+				continue
+			}
+			lastModified = modified
+			log.Info("Config file changed, reloading config")
+		}
+		_, err := reloadConfig()
+		if err != nil {
+			log.Error("Config reload failed, keeping current config: ", err.Error())
+		}
+	}
+}
+
+func configModTime() time.Time {
+	info, err := os.Stat(ConfigPath)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
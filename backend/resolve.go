@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/router"
+)
+
+// resolveRouterID finds a configured router by ID or short name
+func resolveRouterID(ref string) (int, error) {
+	cfg := getConfig()
+	if id, err := strconv.Atoi(ref); err == nil {
+		for _, rtrCfg := range cfg.Routers {
+			if rtrCfg.ID == id {
+				return id, nil
+			}
+		}
+	}
+	// Short names are unique ignoring case
+	for _, rtrCfg := range cfg.Routers {
+		if strings.EqualFold(rtrCfg.ShortName, ref) {
+			return rtrCfg.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("Router (%s) not found", ref)
+}
+
+// resolveStatus returns the HTTP status for a name resolution error
+func resolveStatus(err error) int {
+	switch {
+	case errors.Is(err, router.ErrUnknownName):
+		return http.StatusNotFound
+	case errors.Is(err, router.ErrAmbiguousName):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// resolveViews returns the views of a router a request's names are looked up in,
+// its name set first and then the router's own names
+func resolveViews(routerID int, r *http.Request) ([]router.Router, error) {
+	rtr, rtr_ok := getRouter(routerID)
+	if !rtr_ok {
+		return nil, fmt.Errorf("Router ID (%d) not found", routerID)
+	}
+	rtr, _ = withLastKnownState(routerID, rtr)
+	named, _ := withNameSet(routerID, rtr, r)
+	return []router.Router{named, rtr}, nil
+}
+
+// resolveIn resolves ref on each router in turn until one knows the name
+func resolveIn[T any](rtrs []router.Router, ref apiv1.Ref, resolve func(router.Router, string) (T, error)) (T, error) {
+	var item T
+	var err error
+	for _, rtr := range rtrs {
+		item, err = resolve(rtr, string(ref))
+		if !errors.Is(err, router.ErrUnknownName) {
+			return item, err
+		}
+	}
+	return item, err
+}
+
+// resolveDestinationID returns the ID of a destination by name or ID
+func resolveDestinationID(ref apiv1.Ref, rtrs ...router.Router) (int, error) {
+	dest, err := resolveIn(rtrs, ref, router.ResolveDestination)
+	return dest.ID, err
+}
+
+// resolveLevelRef returns the ID of a level ref, or id if the ref is empty. Zero means no level was given.
+func resolveLevelRef(rtrs []router.Router, ref apiv1.Ref, id int) (int, error) {
+	if ref != "" {
+		lvl, err := resolveIn(rtrs, ref, router.ResolveLevel)
+		return lvl.ID, err
+	}
+	return id, nil
+}
+
+// resolveCrosspointRequest fills in the IDs of a crosspoint request from its names or IDs.
+// Names are looked up on each router in turn, so a name set view can be given before the router itself.
+func resolveCrosspointRequest(req apiv1.CrosspointRequest, rtrs ...router.Router) (apiv1.CrosspointRequest, error) {
+	if req.Destination != "" {
+		dest, err := resolveIn(rtrs, req.Destination, router.ResolveDestination)
+		if err != nil {
+			return req, err
+		}
+		req.DestinationID = dest.ID
+	}
+	if req.Source != "" {
+		src, err := resolveIn(rtrs, req.Source, router.ResolveSource)
+		if err != nil {
+			return req, err
+		}
+		req.SourceID = src.ID
+	}
+	if req.DestinationID == 0 || req.SourceID == 0 {
+		return req, errors.New("destination and source are required")
+	}
+
+	var err error
+	if req.Level != "" {
+		req.DestinationLevel = req.Level
+		req.SourceLevel = req.Level
+	}
+	req.DestinationLevelID, err = resolveLevelRef(rtrs, req.DestinationLevel, req.DestinationLevelID)
+	if err != nil {
+		return req, err
+	}
+	req.SourceLevelID, err = resolveLevelRef(rtrs, req.SourceLevel, req.SourceLevelID)
+	if err != nil {
+		return req, err
+	}
+	// Only a request without any level routes all levels. A level given on one side
+	// is used on both, rather than following every level from the source.
+	switch {
+	case req.DestinationLevelID == 0 && req.SourceLevelID == 0:
+		req.DestinationLevelID = -1
+		req.SourceLevelID = -1
+	case req.DestinationLevelID == 0:
+		req.DestinationLevelID = req.SourceLevelID
+	case req.SourceLevelID == 0:
+		req.SourceLevelID = req.DestinationLevelID
+	}
+	return req, nil
+}
+
+// resolveMappedCrosspointRequest fills in the IDs of a mapped crosspoint request from its names or IDs
+func resolveMappedCrosspointRequest(req apiv1.MappedCrosspointRequest, rtrs ...router.Router) (apiv1.MappedCrosspointRequest, error) {
+	if req.Destination != "" {
+		dest, err := resolveIn(rtrs, req.Destination, router.ResolveDestination)
+		if err != nil {
+			return req, err
+		}
+		req.DestinationID = dest.ID
+	}
+	if req.Source != "" {
+		src, err := resolveIn(rtrs, req.Source, router.ResolveSource)
+		if err != nil {
+			return req, err
+		}
+		req.SourceID = src.ID
+	}
+	if req.DestinationID == 0 || req.SourceID == 0 {
+		return req, errors.New("destination and source are required")
+	}
+	if req.Mapping == "" {
+		return req, errors.New("mapping is required")
+	}
+	return req, nil
+}
+
+// resolveLockRequest fills in the IDs of a lock request from its names or IDs
+func resolveLockRequest(req apiv1.CrosspointLockRequest, rtrs ...router.Router) (apiv1.CrosspointLockRequest, error) {
+	if req.Destination != "" {
+		dest, err := resolveIn(rtrs, req.Destination, router.ResolveDestination)
+		if err != nil {
+			return req, err
+		}
+		req.DestinationID = dest.ID
+	}
+	if req.DestinationID == 0 {
+		return req, errors.New("destination is required")
+	}
+	var err error
+	req.DestinationLevelID, err = resolveLevelRef(rtrs, req.Level, req.DestinationLevelID)
+	if req.DestinationLevelID == 0 {
+		req.DestinationLevelID = -1
+	}
+	return req, err
+}
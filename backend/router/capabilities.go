@@ -0,0 +1,19 @@
+package router
+
+import "errors"
+
+// ErrNotSupported is returned by drivers for operations their hardware can't perform
+var ErrNotSupported = errors.New("router: operation not supported")
+
+// Capabilities describes what a router driver supports
+type Capabilities struct {
+	Breakaway          bool `json:"breakaway"` // Levels can be routed independently. False means follow only.
+	Lock               bool `json:"lock"`
+	Protect            bool `json:"protect"`
+	RenameSources      bool `json:"rename_sources"`
+	RenameDestinations bool `json:"rename_destinations"`
+	HardwareSalvos     bool `json:"hardware_salvos"`
+	NamedLevels        bool `json:"named_levels"`
+	MaxSources         int  `json:"max_sources"` // 0 if unknown
+	MaxDestinations    int  `json:"max_destinations"`
+}
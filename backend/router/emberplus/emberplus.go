@@ -0,0 +1,557 @@
+// Package emberplus is a router driver for routers which only speak Ember+.
+// It connects as a consumer and treats each configured matrix as a level.
+package emberplus
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+
+	"github.com/cassaram/bfc/backend/config"
+	ember "github.com/cassaram/bfc/backend/emberplus"
+	"github.com/cassaram/bfc/backend/router"
+)
+
+type EmberPlusRouter struct {
+	Hostname             string
+	Port                 uint16
+	MatrixPaths          []string // One matrix per level, by numbers or identifiers
+	IDOffset             int      // Added to target and source numbers to give destination and source IDs
+	conn                 *ember.Conn
+	connMutex            sync.Mutex
+	stopCtx              context.Context // Cancelled by Stop
+	stopCancel           context.CancelFunc
+	started              atomic.Bool
+	done                 chan bool // Closed when the connection loop exits
+	status               router.Status
+	statusMutex          sync.Mutex
+	StatusNotifyFunc     func(router.Status)
+	stats                router.MessageStats
+	statsMutex           sync.Mutex
+	matrices             []*matrix                  // Level ID - 1 -> matrix, each published by walkTree once read
+	destinations         map[int]router.Destination // Built from the matrices, guarded by matricesMutex
+	sources              map[int]router.Source
+	unpublished          map[string][]ember.Connection // Matrix path -> tallies since its directory, until it is published
+	matricesMutex        sync.Mutex
+	requests             map[string]directoryRequest // Path -> GetDirectory waiting for a reply
+	requestsMutex        sync.Mutex
+	CrosspointNotifyFunc func(router.Crosspoint)
+}
+
+const (
+	dialTimeout       = 5 * time.Second
+	reconnectDelay    = 5 * time.Second
+	requestTimeout    = 10 * time.Second
+	keepAliveInterval = 10 * time.Second
+)
+
+var (
+	errNotConnected   = errors.New("Ember+ Router: not connected")
+	errConnectionLost = errors.New("Ember+ Router: connection lost")
+)
+
+var Driver = router.Driver{
+	Type:        "EmberPlus",
+	Description: "Ember+ matrices over TCP, one matrix per level (Lawo, DHD, Riedel and other audio routers)",
+	Config: []router.ConfigKey{
+		{Name: "hostname", Type: router.ConfigString, Required: true, Description: "Ember+ provider address"},
+		{Name: "port", Type: router.ConfigPort, Required: true, Description: "Ember+ TCP port, usually 9000"},
+		{Name: "matrices", Type: router.ConfigString, Required: true, Description: "Comma separated matrix paths, one per level, as numbers (1.3.1) or identifiers (Router/Matrices/Audio)"},
+		{Name: "id_offset", Type: router.ConfigNumber, Description: "Added to target and source numbers to give IDs, default 1"},
+	},
+	New: func() router.Router {
+		return &EmberPlusRouter{}
+	},
+}
+
+func init() {
+	router.Register(Driver)
+}
+
+func (r *EmberPlusRouter) Init(conf map[string]interface{}) error {
+	// Error handling
+	errs := Driver.ValidateConfig(conf)
+	if len(errs) > 0 {
+		return fmt.Errorf("Ember+ Router: Bad config: %w", config.ValidationErrors(errs))
+	}
+	hostname := conf["hostname"].(string)
+	port, _ := config.ParsePort(conf["port"])
+	matrixPaths := make([]string, 0)
+	for _, path := range strings.Split(conf["matrices"].(string), ",") {
+		path = strings.TrimSpace(path)
+		if path != "" {
+			matrixPaths = append(matrixPaths, path)
+		}
+	}
+	if len(matrixPaths) == 0 {
+		return errors.New("Ember+ Router: Bad config: .matrices: no matrix paths")
+	}
+	idOffset := 1
+	if offset, ok := conf["id_offset"].(float64); ok {
+		if offset != float64(int(offset)) || offset < 0 {
+			return fmt.Errorf("Ember+ Router: Bad config: .id_offset: invalid offset %v", offset)
+		}
+		idOffset = int(offset)
+	}
+
+	r.Hostname = hostname
+	r.Port = port
+	r.MatrixPaths = matrixPaths
+	r.IDOffset = idOffset
+	r.conn = nil
+	r.stopCtx, r.stopCancel = context.WithCancel(context.Background())
+	r.done = make(chan bool)
+	r.status = router.Status{State: router.StateDisconnected, Since: time.Now()}
+	r.stats = router.MessageStats{
+		Received: make(map[string]uint64),
+		Sent:     make(map[string]uint64),
+	}
+	r.matrices = make([]*matrix, 0)
+	r.destinations = make(map[int]router.Destination)
+	r.sources = make(map[int]router.Source)
+	r.unpublished = make(map[string][]ember.Connection)
+	r.requests = make(map[string]directoryRequest)
+	return nil
+}
+
+func (r *EmberPlusRouter) Start() {
+	if r.started.Swap(true) {
+		return
+	}
+	go r.connectionLoop()
+}
+
+// connectionLoop connects to the provider and reconnects whenever the connection is lost, until stopped
+func (r *EmberPlusRouter) connectionLoop() {
+	defer close(r.done)
+	address := net.JoinHostPort(r.Hostname, strconv.FormatUint(uint64(r.Port), 10))
+	dialer := net.Dialer{Timeout: dialTimeout}
+	for {
+		r.setState(router.StateConnecting, nil)
+		netConn, err := dialer.DialContext(r.stopCtx, "tcp", address)
+		if err != nil {
+			// Errors from Stop cancelling the dial aren't worth reporting
+			if r.stopCtx.Err() == nil {
+				log.Error("Ember+ Router: ", err.Error())
+				r.setState(router.StateError, err)
+			}
+		} else {
+			log.Info("Ember+ Router: Connected to ", address)
+			conn := ember.NewConn(netConn)
+			connDone := make(chan bool)
+			r.connMutex.Lock()
+			r.conn = conn
+			r.connMutex.Unlock()
+
+			go r.receiver(conn, connDone)
+			go r.keepAlive(conn, connDone)
+
+			err = r.walkTree(conn, connDone)
+			if err != nil && !errors.Is(err, errConnectionLost) {
+				log.Error("Ember+ Router: ", err.Error())
+				r.setState(router.StateError, err)
+				conn.Close()
+			}
+
+			select {
+			case <-connDone:
+			case <-r.stopCtx.Done():
+			}
+			// Closing also ends the receiver when stopping
+			conn.Close()
+			<-connDone
+			r.connMutex.Lock()
+			r.conn = nil
+			r.connMutex.Unlock()
+		}
+
+		select {
+		case <-r.stopCtx.Done():
+			r.setState(router.StateDisconnected, nil)
+			return
+		case <-time.After(reconnectDelay):
+		}
+		r.statusMutex.Lock()
+		r.status.ReconnectCount++
+		r.statusMutex.Unlock()
+	}
+}
+
+// Stop unsubscribes from the matrices, closes the connection and waits for the connection loop to exit.
+// It is safe to call more than once.
+func (r *EmberPlusRouter) Stop() {
+	r.connMutex.Lock()
+	conn := r.conn
+	r.connMutex.Unlock()
+	if conn != nil {
+		r.unsubscribe(conn)
+	}
+	r.stopCancel()
+	if conn != nil {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Error("Ember+ Router: ", err.Error())
+		}
+	}
+	if r.started.Load() {
+		<-r.done
+	}
+}
+
+// unsubscribe stops the provider sending connection changes for every matrix
+func (r *EmberPlusRouter) unsubscribe(conn *ember.Conn) {
+	elements := make([]*ember.Element, 0)
+	r.matricesMutex.Lock()
+	for _, m := range r.matrices {
+		elements = append(elements, matrixCommand(m.path, ember.CommandUnsubscribe)...)
+	}
+	r.matricesMutex.Unlock()
+	if len(elements) == 0 {
+		return
+	}
+	err := r.send(conn, "Unsubscribe", elements)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Warn("Ember+ Router: ", err.Error())
+	}
+}
+
+func (r *EmberPlusRouter) SetCrosspointNotifyFunc(fun func(router.Crosspoint)) {
+	r.CrosspointNotifyFunc = fun
+}
+
+func (r *EmberPlusRouter) SetStatusNotifyFunc(fun func(router.Status)) {
+	r.StatusNotifyFunc = fun
+}
+
+func (r *EmberPlusRouter) GetStatus() router.Status {
+	r.statusMutex.Lock()
+	status := r.status
+	r.statusMutex.Unlock()
+	return status
+}
+
+// setState records a connection state change and reports it
+func (r *EmberPlusRouter) setState(state router.State, err error) {
+	r.statusMutex.Lock()
+	if r.status.State == state && err == nil {
+		r.statusMutex.Unlock()
+		return
+	}
+	r.status.State = state
+	r.status.Since = time.Now()
+	if err != nil {
+		r.status.LastError = err.Error()
+	}
+	status := r.status
+	r.statusMutex.Unlock()
+	if r.StatusNotifyFunc != nil {
+		r.StatusNotifyFunc(status)
+	}
+}
+
+func (r *EmberPlusRouter) GetCapabilities() router.Capabilities {
+	// Levels are separate matrices, so they can be routed independently but not crossed
+	return router.Capabilities{
+		Breakaway:   true,
+		NamedLevels: true,
+	}
+}
+
+func (r *EmberPlusRouter) GetMessageStats() router.MessageStats {
+	r.statsMutex.Lock()
+	defer r.statsMutex.Unlock()
+	return router.MessageStats{
+		Received:    maps.Clone(r.stats.Received),
+		Sent:        maps.Clone(r.stats.Sent),
+		ParseErrors: r.stats.ParseErrors,
+	}
+}
+
+// send writes elements as one Glow message, counted under msgType
+func (r *EmberPlusRouter) send(conn *ember.Conn, msgType string, elements []*ember.Element) error {
+	if conn == nil {
+		return errNotConnected
+	}
+	err := conn.WriteMessage(ember.EncodeRoot(elements))
+	if err != nil {
+		return err
+	}
+	log.Debugln("Ember+ Router: Sent", msgType)
+	r.statsMutex.Lock()
+	r.stats.Sent[msgType]++
+	r.statsMutex.Unlock()
+	return nil
+}
+
+func (r *EmberPlusRouter) keepAlive(conn *ember.Conn, connDone chan bool) {
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-connDone:
+			return
+		case <-ticker.C:
+			err := conn.KeepAlive()
+			if err != nil {
+				// The receiver reports the failure once the connection is closed
+				conn.Close()
+				return
+			}
+			r.statsMutex.Lock()
+			r.stats.Sent["KeepAlive"]++
+			r.statsMutex.Unlock()
+		}
+	}
+}
+
+func (r *EmberPlusRouter) receiver(conn *ember.Conn, connDone chan bool) {
+	defer close(connDone)
+	for {
+		payload, err := conn.ReadMessage()
+		if err != nil {
+			if r.stopCtx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				// Connection closed by Stop or after a failed walk, which has been reported
+				return
+			}
+			if errors.Is(err, io.EOF) {
+				log.Info("Ember+ Router: Connection closed by remote")
+				r.setState(router.StateError, errors.New("connection closed by remote"))
+			} else {
+				log.Error("Ember+ Router: ", err.Error())
+				r.setState(router.StateError, err)
+			}
+			return
+		}
+		r.statusMutex.Lock()
+		r.status.LastMessage = time.Now()
+		r.statusMutex.Unlock()
+		elements, err := ember.DecodeRoot(payload)
+		r.statsMutex.Lock()
+		if err != nil {
+			r.stats.ParseErrors++
+		} else {
+			r.stats.Received["Glow"]++
+		}
+		r.statsMutex.Unlock()
+		if err != nil {
+			log.Debug("Ember+ Router: Bad message ", err.Error())
+			continue
+		}
+		r.answerRequests(elements)
+		r.applyUpdates(elements)
+	}
+}
+
+// applyUpdates records connection tallies and label changes sent by the provider
+func (r *EmberPlusRouter) applyUpdates(elements []*ember.Element) {
+	changed := make([]router.Crosspoint, 0)
+	renamed := false
+	r.matricesMutex.Lock()
+	ember.Walk(elements, func(el *ember.Element) {
+		if el.Type == ember.ElementMatrix {
+			// Kept for a matrix still being read, which replaces any matrix at its path once published
+			key := pathString(el.Path)
+			if conns, ok := r.unpublished[key]; ok {
+				r.unpublished[key] = append(conns, el.Connections...)
+				return
+			}
+		}
+		for i, m := range r.matrices {
+			switch {
+			case el.Type == ember.ElementMatrix && slices.Equal(el.Path, m.path):
+				for _, conn := range el.Connections {
+					if m.apply(conn) {
+						changed = append(changed, r.crosspoint(i+1, m, conn.Target))
+					}
+				}
+			case el.Type == ember.ElementParameter && m.targetLabels != nil && isChild(el.Path, m.targetLabels):
+				if name, ok := el.Value.(string); ok {
+					m.targetNames[el.Number()] = name
+					renamed = true
+				}
+			case el.Type == ember.ElementParameter && m.sourceLabels != nil && isChild(el.Path, m.sourceLabels):
+				if name, ok := el.Value.(string); ok {
+					m.sourceNames[el.Number()] = name
+					renamed = true
+				}
+			}
+		}
+	})
+	if renamed {
+		r.buildSignals()
+	}
+	r.matricesMutex.Unlock()
+	if r.CrosspointNotifyFunc != nil {
+		for _, xpt := range changed {
+			r.CrosspointNotifyFunc(xpt)
+		}
+	}
+}
+
+// crosspoint returns a matrix target's tally as a crosspoint
+func (r *EmberPlusRouter) crosspoint(lvlID int, m *matrix, target int) router.Crosspoint {
+	t := m.tallies[target]
+	xpt := router.Crosspoint{
+		Destination:      target + r.IDOffset,
+		DestinationLevel: lvlID,
+		SourceLevel:      lvlID,
+		Locked:           t.locked,
+	}
+	if t.source >= 0 {
+		xpt.Source = t.source + r.IDOffset
+	}
+	return xpt
+}
+
+func (r *EmberPlusRouter) GetLevels() []router.Level {
+	r.matricesMutex.Lock()
+	defer r.matricesMutex.Unlock()
+	levels := make([]router.Level, 0, len(r.matrices))
+	for i, m := range r.matrices {
+		levels = append(levels, router.Level{ID: i + 1, Name: m.name})
+	}
+	return levels
+}
+
+// buildSignals rebuilds the destinations and sources from every matrix target and source by ID.
+// Names come from the first level with the signal. matricesMutex must be held.
+func (r *EmberPlusRouter) buildSignals() {
+	dests := make(map[int]router.Destination)
+	for i, m := range r.matrices {
+		for _, target := range m.targets {
+			id := target + r.IDOffset
+			dest, ok := dests[id]
+			if !ok {
+				dest = router.Destination{ID: id, Name: m.targetName(target), Levels: make([]int, 0)}
+			}
+			dest.Levels = append(dest.Levels, i+1)
+			dests[id] = dest
+		}
+	}
+	srcs := make(map[int]router.Source)
+	for i, m := range r.matrices {
+		for _, source := range m.sources {
+			id := source + r.IDOffset
+			src, ok := srcs[id]
+			if !ok {
+				src = router.Source{ID: id, Name: m.sourceName(source), Levels: make([]int, 0)}
+			}
+			src.Levels = append(src.Levels, i+1)
+			srcs[id] = src
+		}
+	}
+	r.destinations = dests
+	r.sources = srcs
+}
+
+func (r *EmberPlusRouter) GetDestinations() []router.Destination {
+	r.matricesMutex.Lock()
+	dests := maps.Values(r.destinations)
+	r.matricesMutex.Unlock()
+	slices.SortFunc(dests, func(a router.Destination, b router.Destination) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return dests
+}
+
+func (r *EmberPlusRouter) GetSources() []router.Source {
+	r.matricesMutex.Lock()
+	srcs := maps.Values(r.sources)
+	r.matricesMutex.Unlock()
+	slices.SortFunc(srcs, func(a router.Source, b router.Source) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return srcs
+}
+
+func (r *EmberPlusRouter) GetCrosspoints() []router.Crosspoint {
+	crosspoints := make([]router.Crosspoint, 0)
+	r.matricesMutex.Lock()
+	for i, m := range r.matrices {
+		for _, target := range m.targets {
+			crosspoints = append(crosspoints, r.crosspoint(i+1, m, target))
+		}
+	}
+	r.matricesMutex.Unlock()
+	slices.SortFunc(crosspoints, func(a router.Crosspoint, b router.Crosspoint) int {
+		destCmp := cmp.Compare(a.Destination, b.Destination)
+		if destCmp != 0 {
+			return destCmp
+		}
+		return cmp.Compare(a.DestinationLevel, b.DestinationLevel)
+	})
+	return crosspoints
+}
+
+func (r *EmberPlusRouter) SetCrosspoint(destID int, destLevelID int, srcID int, srcLevelID int) error {
+	target := destID - r.IDOffset
+	source := srcID - r.IDOffset
+	routes := make([]*ember.Element, 0)
+	r.matricesMutex.Lock()
+	// Use -1 level ID to mean a follow source, routed on every level with both
+	if destLevelID == -1 || srcLevelID == -1 {
+		for _, m := range r.matrices {
+			if slices.Contains(m.targets, target) && slices.Contains(m.sources, source) {
+				routes = append(routes, m.connect(target, source))
+			}
+		}
+	} else if destLevelID == srcLevelID && destLevelID >= 1 && destLevelID <= len(r.matrices) {
+		m := r.matrices[destLevelID-1]
+		if slices.Contains(m.targets, target) && slices.Contains(m.sources, source) {
+			routes = append(routes, m.connect(target, source))
+		}
+	}
+	r.matricesMutex.Unlock()
+	if destLevelID != srcLevelID && destLevelID != -1 && srcLevelID != -1 {
+		return fmt.Errorf("Ember+ Router: %w: each level is a separate matrix and can't be crossed", router.ErrNotSupported)
+	}
+	if len(routes) == 0 {
+		return fmt.Errorf("Ember+ Router: no matrix has destination %d and source %d", destID, srcID)
+	}
+	r.connMutex.Lock()
+	conn := r.conn
+	r.connMutex.Unlock()
+	return r.send(conn, "Connection", routes)
+}
+
+func (r *EmberPlusRouter) LockDestination(destID int, destLevelID int) error {
+	// Ember+ reports locked targets but has no way to lock them
+	return router.ErrNotSupported
+}
+
+func (r *EmberPlusRouter) UnlockDestination(destID int, destLevelID int) error {
+	return router.ErrNotSupported
+}
+
+func (r *EmberPlusRouter) GetSource(srcID int) router.Source {
+	r.matricesMutex.Lock()
+	defer r.matricesMutex.Unlock()
+	return r.sources[srcID]
+}
+
+func (r *EmberPlusRouter) GetDestination(destID int) router.Destination {
+	r.matricesMutex.Lock()
+	defer r.matricesMutex.Unlock()
+	return r.destinations[destID]
+}
+
+func (r *EmberPlusRouter) GetLevel(lvlID int) router.Level {
+	r.matricesMutex.Lock()
+	defer r.matricesMutex.Unlock()
+	if lvlID < 1 || lvlID > len(r.matrices) {
+		return router.Level{}
+	}
+	return router.Level{ID: lvlID, Name: r.matrices[lvlID-1].name}
+}
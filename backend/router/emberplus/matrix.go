@@ -0,0 +1,383 @@
+package emberplus
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	ember "github.com/cassaram/bfc/backend/emberplus"
+	"github.com/cassaram/bfc/backend/router"
+)
+
+// matrix is a provider matrix used as one level
+type matrix struct {
+	path         []int
+	name         string
+	targets      []int // Target numbers
+	sources      []int // Source numbers
+	targetNames  map[int]string
+	sourceNames  map[int]string
+	targetLabels []int // Path of the node holding target labels, nil without labels
+	sourceLabels []int
+	tallies      map[int]tally // Target number -> tally
+}
+
+type tally struct {
+	source int // -1 if nothing is connected
+	locked bool
+}
+
+// directoryRequest is a GetDirectory waiting for its reply
+type directoryRequest struct {
+	path  []int
+	reply chan *ember.Element
+}
+
+// newMatrix reads a matrix's signals and connections from its directory reply
+func newMatrix(el *ember.Element) *matrix {
+	m := &matrix{
+		path:        el.Path,
+		name:        el.Description,
+		targets:     el.Targets,
+		sources:     el.Sources,
+		targetNames: make(map[int]string),
+		sourceNames: make(map[int]string),
+		tallies:     make(map[int]tally),
+	}
+	if m.name == "" {
+		m.name = el.Identifier
+	}
+	// Linear matrices may leave out their signals, which are numbered from 0
+	if m.targets == nil || el.AddressingMode == ember.AddressingLinear && len(m.targets) == 0 {
+		m.targets = make([]int, 0, el.TargetCount)
+		for i := 0; i < el.TargetCount; i++ {
+			m.targets = append(m.targets, i)
+		}
+	}
+	if m.sources == nil || el.AddressingMode == ember.AddressingLinear && len(m.sources) == 0 {
+		m.sources = make([]int, 0, el.SourceCount)
+		for i := 0; i < el.SourceCount; i++ {
+			m.sources = append(m.sources, i)
+		}
+	}
+	slices.Sort(m.targets)
+	slices.Sort(m.sources)
+	for _, target := range m.targets {
+		m.tallies[target] = tally{source: -1}
+	}
+	for _, conn := range el.Connections {
+		m.apply(conn)
+	}
+	return m
+}
+
+// apply records a connection tally and returns whether it changed the target
+func (m *matrix) apply(conn ember.Connection) bool {
+	// A pending request is followed by a tally once the matrix has switched
+	if conn.Disposition == ember.DispositionPending {
+		return false
+	}
+	t, ok := m.tallies[conn.Target]
+	if !ok {
+		return false
+	}
+	prev := t
+	switch conn.Operation {
+	case ember.OperationAbsolute:
+		t.source = -1
+		if len(conn.Sources) > 0 {
+			t.source = conn.Sources[len(conn.Sources)-1]
+		}
+	case ember.OperationConnect:
+		if len(conn.Sources) > 0 {
+			t.source = conn.Sources[len(conn.Sources)-1]
+		}
+	case ember.OperationDisconnect:
+		if slices.Contains(conn.Sources, t.source) {
+			t.source = -1
+		}
+	}
+	t.locked = conn.Disposition == ember.DispositionLocked
+	m.tallies[conn.Target] = t
+	return t != prev
+}
+
+// connect returns the request connecting a source to a target
+func (m *matrix) connect(target int, source int) *ember.Element {
+	return &ember.Element{
+		Type: ember.ElementMatrix,
+		Path: m.path,
+		Connections: []ember.Connection{{
+			Target:    target,
+			Sources:   []int{source},
+			Operation: ember.OperationAbsolute,
+		}},
+	}
+}
+
+func (m *matrix) targetName(target int) string {
+	if name, ok := m.targetNames[target]; ok && name != "" {
+		return name
+	}
+	return fmt.Sprintf("Target %d", target)
+}
+
+func (m *matrix) sourceName(source int) string {
+	if name, ok := m.sourceNames[source]; ok && name != "" {
+		return name
+	}
+	return fmt.Sprintf("Source %d", source)
+}
+
+// matrixCommand returns a command applied to the matrix at path
+func matrixCommand(path []int, command int) []*ember.Element {
+	return []*ember.Element{{
+		Type:     ember.ElementMatrix,
+		Path:     path,
+		Children: []*ember.Element{{Type: ember.ElementCommand, Command: command}},
+	}}
+}
+
+// walkTree subscribes to the configured matrices and reads their signals, labels and connections.
+// Each matrix is published as its level once read, with the tallies received while reading its labels.
+func (r *EmberPlusRouter) walkTree(conn *ember.Conn, connDone chan bool) error {
+	log.Infoln("Ember+ Router: Walking the provider's tree")
+	r.setState(router.StateSyncing, nil)
+	r.matricesMutex.Lock()
+	clear(r.unpublished)
+	r.matricesMutex.Unlock()
+	for i, matrixPath := range r.MatrixPaths {
+		path, err := r.resolvePath(conn, connDone, matrixPath)
+		if err != nil {
+			return fmt.Errorf("Matrix %s: %w", matrixPath, err)
+		}
+		// Subscribing first means no change is missed between the directory and the subscription
+		err = r.send(conn, "Subscribe", matrixCommand(path, ember.CommandSubscribe))
+		if err != nil {
+			return fmt.Errorf("Matrix %s: %w", matrixPath, err)
+		}
+		el, err := r.getDirectory(conn, connDone, path, ember.ElementMatrix)
+		if err != nil {
+			return fmt.Errorf("Matrix %s: %w", matrixPath, err)
+		}
+		if el.Type != ember.ElementMatrix {
+			return fmt.Errorf("Matrix %s: %s is not a matrix", matrixPath, pathString(path))
+		}
+		m := newMatrix(el)
+		m.targets = r.dropInvalid(matrixPath, "target", m.targets)
+		m.sources = r.dropInvalid(matrixPath, "source", m.sources)
+		if len(el.Labels) > 0 {
+			err = r.readLabels(conn, connDone, m, el.Labels[0].BasePath)
+			if errors.Is(err, errConnectionLost) {
+				return err
+			}
+			if err != nil {
+				// Routing still works without names
+				log.Warn("Ember+ Router: Matrix ", matrixPath, ": Labels not read: ", err.Error())
+			}
+		}
+		r.publish(i, m)
+	}
+
+	r.matricesMutex.Lock()
+	levelCount, sourceCount, destCount := len(r.matrices), len(r.sources), len(r.destinations)
+	r.matricesMutex.Unlock()
+	log.Infof("Ember+ Router: Found %d levels, %d sources, %d destinations", levelCount, sourceCount, destCount)
+	if r.CrosspointNotifyFunc != nil {
+		for _, xpt := range r.GetCrosspoints() {
+			r.CrosspointNotifyFunc(xpt)
+		}
+	}
+	r.setState(router.StateReady, nil)
+	return nil
+}
+
+// publish makes a matrix level idx + 1, applying the tallies received since its directory
+func (r *EmberPlusRouter) publish(idx int, m *matrix) {
+	r.matricesMutex.Lock()
+	defer r.matricesMutex.Unlock()
+	key := pathString(m.path)
+	for _, conn := range r.unpublished[key] {
+		m.apply(conn)
+	}
+	delete(r.unpublished, key)
+	if idx < len(r.matrices) {
+		r.matrices[idx] = m
+	} else {
+		r.matrices = append(r.matrices, m)
+	}
+	r.buildSignals()
+}
+
+// dropInvalid removes signals whose numbers wouldn't give a usable ID
+func (r *EmberPlusRouter) dropInvalid(matrixPath string, kind string, numbers []int) []int {
+	return slices.DeleteFunc(numbers, func(n int) bool {
+		if n+r.IDOffset < 1 {
+			log.Warnf("Ember+ Router: Matrix %s: Ignoring %s %d, raise id_offset to use it", matrixPath, kind, n)
+			return true
+		}
+		return false
+	})
+}
+
+// readLabels reads target and source names from the label nodes under basePath
+func (r *EmberPlusRouter) readLabels(conn *ember.Conn, connDone chan bool, m *matrix, basePath []int) error {
+	labels, err := r.getDirectory(conn, connDone, basePath, ember.ElementNode)
+	if err != nil {
+		return err
+	}
+	for _, child := range labels.Children {
+		if child.Type != ember.ElementNode {
+			continue
+		}
+		// Label nodes are conventionally targets (1) and sources (2)
+		names := m.targetNames
+		switch {
+		case child.Identifier == "targets" || child.Identifier == "" && child.Number() == 1:
+			m.targetLabels = child.Path
+		case child.Identifier == "sources" || child.Identifier == "" && child.Number() == 2:
+			m.sourceLabels = child.Path
+			names = m.sourceNames
+		default:
+			continue
+		}
+		params, err := r.getDirectory(conn, connDone, child.Path, ember.ElementNode)
+		if err != nil {
+			return err
+		}
+		for _, param := range params.Children {
+			if name, ok := param.Value.(string); ok && param.Type == ember.ElementParameter {
+				names[param.Number()] = name
+			}
+		}
+	}
+	return nil
+}
+
+// resolvePath turns a configured path into numbers, walking the tree for identifiers
+func (r *EmberPlusRouter) resolvePath(conn *ember.Conn, connDone chan bool, matrixPath string) ([]int, error) {
+	numbers := make([]int, 0)
+	for _, part := range strings.Split(matrixPath, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			numbers = nil
+			break
+		}
+		numbers = append(numbers, n)
+	}
+	if numbers != nil {
+		return numbers, nil
+	}
+	var path []int // The root
+	for _, ident := range strings.Split(strings.Trim(matrixPath, "/"), "/") {
+		dir, err := r.getDirectory(conn, connDone, path, ember.ElementNode)
+		if err != nil {
+			return nil, err
+		}
+		idx := slices.IndexFunc(dir.Children, func(child *ember.Element) bool {
+			return child.Identifier == ident
+		})
+		if idx == -1 {
+			return nil, fmt.Errorf("no element %s in %s", ident, pathString(path))
+		}
+		path = dir.Children[idx].Path
+	}
+	return path, nil
+}
+
+// getDirectory asks for an element's directory and waits for the reply. The root has a nil path.
+func (r *EmberPlusRouter) getDirectory(conn *ember.Conn, connDone chan bool, path []int, elType ember.ElementType) (*ember.Element, error) {
+	key := pathString(path)
+	req := directoryRequest{path: path, reply: make(chan *ember.Element, 1)}
+	r.requestsMutex.Lock()
+	r.requests[key] = req
+	r.requestsMutex.Unlock()
+	defer func() {
+		r.requestsMutex.Lock()
+		if r.requests[key].reply == req.reply {
+			delete(r.requests, key)
+		}
+		r.requestsMutex.Unlock()
+	}()
+
+	command := &ember.Element{Type: ember.ElementCommand, Command: ember.CommandGetDirectory}
+	elements := []*ember.Element{command}
+	if len(path) > 0 {
+		elements = []*ember.Element{{Type: elType, Path: path, Children: []*ember.Element{command}}}
+	}
+	err := r.send(conn, "GetDirectory", elements)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case el := <-req.reply:
+		return el, nil
+	case <-connDone:
+		return nil, errConnectionLost
+	case <-r.stopCtx.Done():
+		return nil, errConnectionLost
+	case <-time.After(requestTimeout):
+		return nil, fmt.Errorf("no reply to GetDirectory on %s", pathString(path))
+	}
+}
+
+// answerRequests passes directory replies to waiting requests. Providers either send the
+// element with its children or just the children, so both are accepted.
+func (r *EmberPlusRouter) answerRequests(elements []*ember.Element) {
+	r.requestsMutex.Lock()
+	defer r.requestsMutex.Unlock()
+	for key, req := range r.requests {
+		var found *ember.Element
+		children := make([]*ember.Element, 0)
+		ember.Walk(elements, func(el *ember.Element) {
+			// Tallies and other updates can arrive while waiting, but only carry what changed
+			if el.Type == ember.ElementCommand || !el.Contents && len(el.Children) == 0 && el.Targets == nil {
+				return
+			}
+			if slices.Equal(el.Path, req.path) && len(req.path) > 0 {
+				found = el
+			} else if isChild(el.Path, req.path) {
+				children = append(children, el)
+			}
+		})
+		if found == nil && len(children) == 0 {
+			continue
+		}
+		if found == nil {
+			found = &ember.Element{Path: req.path}
+		}
+		if len(found.Children) == 0 {
+			found.Children = children
+		}
+		if found.Type == ember.ElementMatrix {
+			// Later tallies are kept until walkTree publishes the matrix
+			r.matricesMutex.Lock()
+			r.unpublished[key] = make([]ember.Connection, 0)
+			r.matricesMutex.Unlock()
+		}
+		req.reply <- found
+		delete(r.requests, key)
+	}
+}
+
+// isChild returns whether path is directly inside parent
+func isChild(path []int, parent []int) bool {
+	return len(path) == len(parent)+1 && slices.Equal(path[:len(parent)], parent)
+}
+
+// pathString formats a path as dotted numbers
+func pathString(path []int) string {
+	if len(path) == 0 {
+		return "root"
+	}
+	parts := make([]string, 0, len(path))
+	for _, n := range path {
+		parts = append(parts, strconv.Itoa(n))
+	}
+	return strings.Join(parts, ".")
+}
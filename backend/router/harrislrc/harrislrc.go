@@ -2,17 +2,22 @@ package harrislrc
 
 import (
 	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/exp/maps"
 
+	"github.com/cassaram/bfc/backend/config"
 	"github.com/cassaram/bfc/backend/router"
 )
 
@@ -20,9 +25,18 @@ type HarrisLRCRouter struct {
 	Hostname              string
 	Port                  uint16
 	conn                  net.Conn
-	stop                  chan bool
+	connMutex             sync.Mutex
+	stopCtx               context.Context // Cancelled by Stop
+	stopCancel            context.CancelFunc
+	started               atomic.Bool
+	done                  chan bool // Closed when the connection loop exits
 	replyMessages         chan lrcMessage
-	receiverReady         int
+	receiverReady         atomic.Int32
+	status                router.Status
+	statusMutex           sync.Mutex
+	StatusNotifyFunc      func(router.Status)
+	stats                 router.MessageStats
+	statsMutex            sync.Mutex
 	Levels                map[int]router.Level
 	LevelsMutex           sync.Mutex
 	LevelsName            map[string]int // Stores Name -> ID mapping
@@ -40,30 +54,50 @@ type HarrisLRCRouter struct {
 	CrosspointNotifyFunc  func(router.Crosspoint)
 }
 
-func (r *HarrisLRCRouter) Init(conf map[string]interface{}) {
+const (
+	dialTimeout    = 5 * time.Second
+	reconnectDelay = 5 * time.Second
+)
+
+var errNotConnected = errors.New("Harris LRC Router: not connected")
+
+var Driver = router.Driver{
+	Type:        "HarrisLRC",
+	Description: "Harris/Imagine LRC protocol over TCP (Platinum, Cerebrum)",
+	Config: []router.ConfigKey{
+		{Name: "hostname", Type: router.ConfigString, Required: true, Description: "Router or Cerebrum server address"},
+		{Name: "port", Type: router.ConfigPort, Required: true, Description: "LRC TCP port"},
+	},
+	New: func() router.Router {
+		return &HarrisLRCRouter{}
+	},
+}
+
+func init() {
+	router.Register(Driver)
+}
+
+func (r *HarrisLRCRouter) Init(conf map[string]interface{}) error {
 	// Error handling
-	hostname, hostname_ok := conf["hostname"].(string)
-	portstr, portstr_ok := conf["port"].(string)
-	if !hostname_ok || !portstr_ok {
-		log.Errorln("Harris LRC Router: Bad config given: ", conf)
-		return
-	}
-	port, err := strconv.Atoi(portstr)
-	if err != nil {
-		log.Errorln("Harris LRC Router: Bad port given ", portstr, err)
-		return
-	}
-	if port < 0 || port > 0xFFFF {
-		log.Error(fmt.Sprintf("Harris LRC Router: Port (%v) out of range", port))
-		return
+	errs := Driver.ValidateConfig(conf)
+	if len(errs) > 0 {
+		return fmt.Errorf("Harris LRC Router: Bad config: %w", config.ValidationErrors(errs))
 	}
+	hostname := conf["hostname"].(string)
+	port, _ := config.ParsePort(conf["port"])
 
 	r.Hostname = hostname
-	r.Port = uint16(port)
+	r.Port = port
 	r.conn = nil
-	r.stop = make(chan bool)
+	r.stopCtx, r.stopCancel = context.WithCancel(context.Background())
+	r.done = make(chan bool)
 	r.replyMessages = make(chan lrcMessage, 100) // Buffered to add some level of async capabilitiy between listener and handler
-	r.receiverReady = 0
+	r.receiverReady.Store(0)
+	r.status = router.Status{State: router.StateDisconnected, Since: time.Now()}
+	r.stats = router.MessageStats{
+		Received: make(map[string]uint64),
+		Sent:     make(map[string]uint64),
+	}
 	r.Levels = make(map[int]router.Level)
 	r.LevelsName = make(map[string]int)
 	r.Destinations = make(map[int]router.Destination)
@@ -71,28 +105,74 @@ func (r *HarrisLRCRouter) Init(conf map[string]interface{}) {
 	r.Sources = make(map[int]router.Source)
 	r.SourcesName = make(map[string]int)
 	r.Crosspoints = make(map[int]map[int]router.Crosspoint)
+	return nil
 }
 
 func (r *HarrisLRCRouter) Start() {
-	portStr := strconv.FormatUint(uint64(r.Port), 10)
-	conn, err := net.Dial("tcp", r.Hostname+":"+portStr)
-	if err != nil {
-		log.Error("Harris LRC Router:", err.Error())
-		conn.Close()
+	if r.started.Swap(true) {
 		return
 	}
-	log.Info("Harris LRC Router: Connected to ", r.Hostname+":"+portStr)
-	r.conn = conn
+	go r.connectionLoop()
+}
 
-	go r.replyHandler()
-	go r.replyListener()
+// connectionLoop connects to the router and reconnects whenever the connection is lost, until stopped
+func (r *HarrisLRCRouter) connectionLoop() {
+	defer close(r.done)
+	address := net.JoinHostPort(r.Hostname, strconv.FormatUint(uint64(r.Port), 10))
+	dialer := net.Dialer{Timeout: dialTimeout}
+	for {
+		r.setState(router.StateConnecting, nil)
+		conn, err := dialer.DialContext(r.stopCtx, "tcp", address)
+		if err != nil {
+			// Errors from Stop cancelling the dial aren't worth reporting
+			if r.stopCtx.Err() == nil {
+				log.Error("Harris LRC Router: ", err.Error())
+				r.setState(router.StateError, err)
+			}
+		} else {
+			log.Info("Harris LRC Router: Connected to ", address)
+			connDone := make(chan bool)
+			r.connMutex.Lock()
+			r.conn = conn
+			r.connMutex.Unlock()
+			r.receiverReady.Store(0)
+
+			go r.replyHandler(connDone)
+			go r.replyListener(conn, connDone)
+
+			// Get initial configs
+			r.getConfig()
+
+			select {
+			case <-connDone:
+			case <-r.stopCtx.Done():
+			}
+			// Closing also ends the listener when stopping
+			conn.Close()
+			<-connDone
+			r.connMutex.Lock()
+			r.conn = nil
+			r.connMutex.Unlock()
+		}
 
-	// Get initial configs
-	r.getConfig()
+		select {
+		case <-r.stopCtx.Done():
+			r.setState(router.StateDisconnected, nil)
+			return
+		case <-time.After(reconnectDelay):
+		}
+		r.statusMutex.Lock()
+		r.status.ReconnectCount++
+		r.statusMutex.Unlock()
+	}
 }
 
 func (r *HarrisLRCRouter) getConfig() {
 	log.Infoln("Harris LRC Router: Fetching full configuration")
+	r.setState(router.StateSyncing, nil)
+	r.connMutex.Lock()
+	conn := r.conn
+	r.connMutex.Unlock()
 	go func() {
 		r.sendCommand("~CHANNELS?\\")
 		time.Sleep(10 * time.Millisecond)
@@ -105,14 +185,30 @@ func (r *HarrisLRCRouter) getConfig() {
 		r.sendCommand("~LOCK?\\")
 		time.Sleep(10 * time.Second)
 		log.Infof("Harris LRC Router: Found %d levels, %d sources, %d destinations, %d crosspoints", len(r.Levels), len(r.Sources), len(r.Destinations), len(r.Crosspoints))
+		// Only report ready if the connection the sync ran on is still up
+		r.connMutex.Lock()
+		sameConn := conn != nil && r.conn == conn
+		r.connMutex.Unlock()
+		if sameConn {
+			r.setState(router.StateReady, nil)
+		}
 	}()
 }
 
+// Stop closes the connection and waits for the connection loop to exit. It is safe to call more than once.
 func (r *HarrisLRCRouter) Stop() {
-	r.stop <- true
-	err := r.conn.Close()
-	if err != nil {
-		log.Error("Harris LRC Router: ", err.Error())
+	r.stopCancel()
+	r.connMutex.Lock()
+	conn := r.conn
+	r.connMutex.Unlock()
+	if conn != nil {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Error("Harris LRC Router: ", err.Error())
+		}
+	}
+	if r.started.Load() {
+		<-r.done
 	}
 }
 
@@ -120,43 +216,114 @@ func (r *HarrisLRCRouter) SetCrosspointNotifyFunc(fun func(router.Crosspoint)) {
 	r.CrosspointNotifyFunc = fun
 }
 
+func (r *HarrisLRCRouter) SetStatusNotifyFunc(fun func(router.Status)) {
+	r.StatusNotifyFunc = fun
+}
+
+func (r *HarrisLRCRouter) GetStatus() router.Status {
+	r.statusMutex.Lock()
+	status := r.status
+	r.statusMutex.Unlock()
+	return status
+}
+
+// setState records a connection state change and reports it
+func (r *HarrisLRCRouter) setState(state router.State, err error) {
+	r.statusMutex.Lock()
+	if r.status.State == state && err == nil {
+		r.statusMutex.Unlock()
+		return
+	}
+	r.status.State = state
+	r.status.Since = time.Now()
+	if err != nil {
+		r.status.LastError = err.Error()
+	}
+	status := r.status
+	r.statusMutex.Unlock()
+	if r.StatusNotifyFunc != nil {
+		r.StatusNotifyFunc(status)
+	}
+}
+
+func (r *HarrisLRCRouter) GetCapabilities() router.Capabilities {
+	return router.Capabilities{
+		Breakaway:   true,
+		Lock:        true,
+		NamedLevels: true,
+	}
+}
+
 func (r *HarrisLRCRouter) sendCommand(cmd string) error {
-	for r.receiverReady < 2 {
-		time.Sleep(1000)
+	for r.receiverReady.Load() < 2 {
+		r.connMutex.Lock()
+		connected := r.conn != nil
+		r.connMutex.Unlock()
+		if !connected {
+			return errNotConnected
+		}
+		time.Sleep(time.Millisecond)
+	}
+	r.connMutex.Lock()
+	conn := r.conn
+	r.connMutex.Unlock()
+	if conn == nil {
+		return errNotConnected
 	}
 	log.Debugln("Harris LRC Router: Sent ", cmd)
 	cmdBytes := []byte(cmd)
-	_, err := r.conn.Write(cmdBytes)
+	_, err := conn.Write(cmdBytes)
 	if err != nil {
 		return err
 	}
+	msgType := strings.TrimLeft(cmd, "~")
+	if opIdx := strings.IndexAny(msgType, ":!?%"); opIdx >= 0 {
+		msgType = msgType[:opIdx]
+	}
+	r.statsMutex.Lock()
+	r.stats.Sent[msgType]++
+	r.statsMutex.Unlock()
 	return nil
 }
 
-func (r *HarrisLRCRouter) replyListener() {
+func (r *HarrisLRCRouter) GetMessageStats() router.MessageStats {
+	r.statsMutex.Lock()
+	defer r.statsMutex.Unlock()
+	return router.MessageStats{
+		Received:    maps.Clone(r.stats.Received),
+		Sent:        maps.Clone(r.stats.Sent),
+		ParseErrors: r.stats.ParseErrors,
+	}
+}
+
+func (r *HarrisLRCRouter) replyListener(conn net.Conn, connDone chan bool) {
+	defer close(connDone)
 	shortBuffer := make([]byte, 1500)
 	largeBuffer := ""
 
-	r.receiverReady++
+	r.receiverReady.Add(1)
 	for {
 		select {
-		case <-r.stop:
+		case <-r.stopCtx.Done():
 			return
 		default:
-			n, err := r.conn.Read(shortBuffer)
-			if err != nil && err.Error() == "EOF" {
+			n, err := conn.Read(shortBuffer)
+			if err != nil && errors.Is(err, io.EOF) {
 				log.Info("Harris LRC Router: Connection closed by remote")
-				r.stop <- true
+				r.setState(router.StateError, errors.New("connection closed by remote"))
 				return
 			} else if err != nil {
-				log.Error("Harris LRC Router:", err.Error())
-				r.stop <- true
-				err := r.conn.Close()
-				if err != nil {
-					log.Error("Harris LRC Router:", err.Error())
+				if r.stopCtx.Err() != nil {
+					// Connection closed by Stop
+					return
 				}
+				log.Error("Harris LRC Router:", err.Error())
+				r.setState(router.StateError, err)
 				return
 			}
+			r.statusMutex.Lock()
+			r.status.LastMessage = time.Now()
+			r.statusMutex.Unlock()
 			// Insert into large buffer
 			largeBuffer += string(shortBuffer[:n])
 			largeBuffer = strings.ReplaceAll(largeBuffer, "\r", "")
@@ -180,17 +347,24 @@ func (r *HarrisLRCRouter) replyListener() {
 				}
 				log.Debug("Harris LRC Router: Received", msgStr)
 				msg := lrcMessageFromString(msgStr)
+				r.statsMutex.Lock()
+				if msg.msgType == "" || msg.args == nil {
+					r.stats.ParseErrors++
+				} else {
+					r.stats.Received[msg.msgType]++
+				}
+				r.statsMutex.Unlock()
 				r.replyMessages <- msg
 			}
 		}
 	}
 }
 
-func (r *HarrisLRCRouter) replyHandler() {
-	r.receiverReady++
+func (r *HarrisLRCRouter) replyHandler(connDone chan bool) {
+	r.receiverReady.Add(1)
 	for {
 		select {
-		case <-r.stop:
+		case <-connDone:
 			return
 		case msg := <-r.replyMessages:
 			log.Debug("Harris LRC Router: Parsed ", msg)
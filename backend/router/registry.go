@@ -0,0 +1,115 @@
+package router
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cassaram/bfc/backend/config"
+	"golang.org/x/exp/maps"
+)
+
+// Config key types understood by Driver.ValidateConfig
+const (
+	ConfigString = "string"
+	ConfigPort   = "port"
+	ConfigNumber = "number"
+	ConfigBool   = "bool"
+)
+
+// ConfigKey describes one key of a driver's "config" object
+type ConfigKey struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+}
+
+// Driver describes a router type. Driver packages call Register from an init function.
+type Driver struct {
+	Type        string      `json:"type"`
+	Description string      `json:"description"`
+	Config      []ConfigKey `json:"config"`
+	// New returns an uninitialised router
+	New func() Router `json:"-"`
+}
+
+var drivers = make(map[string]Driver)
+var driversMutex sync.Mutex
+
+// Register adds a driver to the registry. Router types are case insensitive.
+func Register(d Driver) {
+	driversMutex.Lock()
+	defer driversMutex.Unlock()
+	key := strings.ToLower(d.Type)
+	if _, exists := drivers[key]; exists {
+		panic("router: driver registered twice: " + d.Type)
+	}
+	drivers[key] = d
+}
+
+// LookupDriver returns the driver for a router type
+func LookupDriver(routerType string) (Driver, bool) {
+	driversMutex.Lock()
+	d, ok := drivers[strings.ToLower(routerType)]
+	driversMutex.Unlock()
+	return d, ok
+}
+
+// Drivers returns all registered drivers sorted by type
+func Drivers() []Driver {
+	driversMutex.Lock()
+	list := maps.Values(drivers)
+	driversMutex.Unlock()
+	slices.SortFunc(list, func(a Driver, b Driver) int {
+		return cmp.Compare(strings.ToLower(a.Type), strings.ToLower(b.Type))
+	})
+	return list
+}
+
+// ValidateConfig checks a router's "config" object against the driver's config keys
+func (d Driver) ValidateConfig(conf map[string]interface{}) []config.ValidationError {
+	errs := make([]config.ValidationError, 0)
+	known := make(map[string]bool)
+	for _, key := range d.Config {
+		known[key.Name] = true
+		val, ok := conf[key.Name]
+		if !ok {
+			if key.Required {
+				errs = append(errs, config.ValidationError{Path: "." + key.Name, Message: "required key missing"})
+			}
+			continue
+		}
+		valid := true
+		switch key.Type {
+		case ConfigString:
+			str, ok := val.(string)
+			valid = ok && (str != "" || !key.Required)
+		case ConfigPort:
+			_, err := config.ParsePort(val)
+			if err != nil {
+				errs = append(errs, config.ValidationError{Path: "." + key.Name, Message: err.Error()})
+			}
+		case ConfigNumber:
+			_, valid = val.(float64)
+		case ConfigBool:
+			_, valid = val.(bool)
+		}
+		if !valid {
+			errs = append(errs, config.ValidationError{Path: "." + key.Name, Message: fmt.Sprintf("invalid %s %v", key.Type, val)})
+		}
+	}
+	unknown := make([]string, 0)
+	for name := range conf {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	for _, name := range unknown {
+		errs = append(errs, config.ValidationError{Path: "." + name, Message: "unknown key for router type " + d.Type})
+	}
+	return errs
+}
@@ -0,0 +1,60 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Errors returned when resolving a name or ID
+var (
+	ErrUnknownName   = errors.New("router: not found")
+	ErrAmbiguousName = errors.New("router: ambiguous name")
+)
+
+// ResolveSource finds a source by ID or name
+func ResolveSource(rtr Router, ref string) (Source, error) {
+	return resolve("source", ref, rtr.GetSources(), func(s Source) (int, string) { return s.ID, s.Name })
+}
+
+// ResolveDestination finds a destination by ID or name
+func ResolveDestination(rtr Router, ref string) (Destination, error) {
+	return resolve("destination", ref, rtr.GetDestinations(), func(d Destination) (int, string) { return d.ID, d.Name })
+}
+
+// ResolveLevel finds a level by ID or name
+func ResolveLevel(rtr Router, ref string) (Level, error) {
+	return resolve("level", ref, rtr.GetLevels(), func(l Level) (int, string) { return l.ID, l.Name })
+}
+
+// resolve matches ref against IDs first, then exact names, then names ignoring case.
+// More than one match at the same step is ambiguous.
+func resolve[T any](kind string, ref string, items []T, key func(T) (int, string)) (T, error) {
+	var zero T
+	if id, err := strconv.Atoi(ref); err == nil {
+		for _, item := range items {
+			if itemID, _ := key(item); itemID == id {
+				return item, nil
+			}
+		}
+	}
+	for _, exact := range []bool{true, false} {
+		matches := make([]T, 0)
+		ids := make([]int, 0)
+		for _, item := range items {
+			itemID, name := key(item)
+			if (exact && name == ref) || (!exact && strings.EqualFold(name, ref)) {
+				matches = append(matches, item)
+				ids = append(ids, itemID)
+			}
+		}
+		switch {
+		case len(matches) == 1:
+			return matches[0], nil
+		case len(matches) > 1:
+			return zero, fmt.Errorf("%w: %s %q matches IDs %v", ErrAmbiguousName, kind, ref, ids)
+		}
+	}
+	return zero, fmt.Errorf("%w: %s %q", ErrUnknownName, kind, ref)
+}
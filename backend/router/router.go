@@ -1,12 +1,16 @@
 package router
 
 type Router interface {
-	Init(map[string]interface{})
+	Init(map[string]interface{}) error
 	Start()
 	Stop()
 	// Channel that passes any crosspoint changes reported by the router
 	// If implemented, should be buffered to not halt internal processing of the router module
 	SetCrosspointNotifyFunc(func(Crosspoint))
+	// Called on every change of the router's connection state
+	SetStatusNotifyFunc(func(Status))
+	GetStatus() Status
+	GetCapabilities() Capabilities
 	GetLevels() []Level
 	GetSources() []Source
 	GetSource(srcID int) Source
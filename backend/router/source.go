@@ -1,7 +1,8 @@
 package router
 
 type Source struct {
-	ID     int    `json:"id"`
-	Name   string `json:"name"`
-	Levels []int  `json:"levels"`
+	ID     int      `json:"id"`
+	Name   string   `json:"name"`
+	Levels []int    `json:"levels"`
+	Tags   []string `json:"tags,omitempty"` // Added by BFC from tag rules and API edits, not by drivers
 }
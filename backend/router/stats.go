@@ -0,0 +1,13 @@
+package router
+
+// MessageStats are protocol message counters, keyed by message type
+type MessageStats struct {
+	Received    map[string]uint64 `json:"received"`
+	Sent        map[string]uint64 `json:"sent"`
+	ParseErrors uint64            `json:"parse_errors"`
+}
+
+// StatsReporter is implemented by drivers that count protocol messages
+type StatsReporter interface {
+	GetMessageStats() MessageStats
+}
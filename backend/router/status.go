@@ -0,0 +1,22 @@
+package router
+
+import "time"
+
+type State string
+
+const (
+	StateDisconnected State = "disconnected"
+	StateConnecting   State = "connecting"
+	StateSyncing      State = "syncing" // Connected and fetching configuration and crosspoints
+	StateReady        State = "ready"
+	StateError        State = "error"
+)
+
+// Status is the connection status reported by a router driver
+type Status struct {
+	State          State     `json:"state"`
+	Since          time.Time `json:"since"`        // Time of the last state change
+	LastMessage    time.Time `json:"last_message"` // Time the last message was received from the router
+	ReconnectCount int       `json:"reconnect_count"`
+	LastError      string    `json:"last_error"`
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// getSalvo loads a stored salvo
+func getSalvo(name string) (apiv1.Salvo, error) {
+	salvo := apiv1.Salvo{}
+	err := Store.Get(store.BucketSalvos, name, &salvo)
+	return salvo, err
+}
+
+// fireSalvo routes every crosspoint of a salvo as a user, continuing past failures
+func fireSalvo(salvo apiv1.Salvo, user string, undoable bool) apiv1.SalvoFireResult {
+	return routeCrosspoints(apiv1.AuditSalvo, "Salvo "+salvo.Name, salvo.Crosspoints, user, undoable)
+}
+
+// routeCrosspoints routes crosspoints on any router as a user, continuing past failures.
+// The description names the operation in the audit records, log and, if undoable, the user's undo stack.
+// Scheduled routes aren't undoable, so undo reverts the user's own last take.
+func routeCrosspoints(action string, description string, crosspoints []apiv1.SalvoCrosspoint, user string, undoable bool) apiv1.SalvoFireResult {
+	result := apiv1.SalvoFireResult{Errors: make([]string, 0)}
+	previous := make([]apiv1.UndoCrosspoint, 0)
+	for _, xpt := range crosspoints {
+		rtr, rtr_ok := getRouter(xpt.RouterID)
+		if !rtr_ok {
+			result.Errors = append(result.Errors, fmt.Sprintf("Router ID (%d) not found", xpt.RouterID))
+			continue
+		}
+		req, err := resolveCrosspointRequest(xpt.CrosspointRequest, rtr)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Router %d: %s", xpt.RouterID, err.Error()))
+			continue
+		}
+		if !rtr.GetCapabilities().Breakaway && (req.DestinationLevelID != -1 || req.SourceLevelID != -1) {
+			result.Errors = append(result.Errors, fmt.Sprintf("Router %d: Router is follow only, destination %d not routed", xpt.RouterID, req.DestinationID))
+			continue
+		}
+		err = checkBooking(xpt.RouterID, req.DestinationID, user)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Router %d: %s", xpt.RouterID, err.Error()))
+			continue
+		}
+		changes := capturePrevious(xpt.RouterID, rtr, req.DestinationID, req.DestinationLevelID, req.SourceID, req.SourceLevelID)
+		err = setCrosspoint(xpt.RouterID, rtr, req.DestinationID, req.DestinationLevelID, req.SourceID, req.SourceLevelID)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Router %d: destination %d: %s", xpt.RouterID, req.DestinationID, err.Error()))
+			continue
+		}
+		previous = append(previous, changes...)
+		result.Routed++
+	}
+	if undoable {
+		recordUndo(user, description, previous)
+	}
+	recordAudit(user, action, description, result.Errors)
+	log.Infof("%s: %d routed, %d failed", description, result.Routed, len(result.Errors))
+	return result
+}
+
+func (a *APIHandler) APIV1HandleSalvos(w http.ResponseWriter, r *http.Request) {
+	names, err := Store.Keys(store.BucketSalvos)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	salvos := make([]apiv1.Salvo, 0)
+	for _, name := range names {
+		salvo, err := getSalvo(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		salvos = append(salvos, salvo)
+	}
+	salvosBody, err := json.Marshal(salvos)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(salvosBody)
+}
+
+func (a *APIHandler) APIV1HandleSalvo(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	salvo, err := getSalvo(name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Salvo (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	salvoBody, err := json.Marshal(salvo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(salvoBody)
+}
+
+func (a *APIHandler) APIV1HandleSalvoPut(w http.ResponseWriter, r *http.Request) {
+	body := apiv1.Salvo{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	body.Name = r.PathValue("name")
+	if len(body.Crosspoints) == 0 {
+		http.Error(w, "Salvo has no crosspoints", http.StatusBadRequest)
+		return
+	}
+	for _, xpt := range body.Crosspoints {
+		if _, ok := getRouterConfig(xpt.RouterID); !ok {
+			http.Error(w, fmt.Sprintf("Router ID (%d) not found", xpt.RouterID), http.StatusBadRequest)
+			return
+		}
+	}
+	err = Store.Put(store.BucketSalvos, body.Name, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *APIHandler) APIV1HandleSalvoDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	_, err := getSalvo(name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Salvo (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	err = Store.Delete(store.BucketSalvos, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *APIHandler) APIV1HandleSalvoFirePost(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	salvo, err := getSalvo(name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Salvo (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result := fireSalvo(salvo, requestUser(r), true)
+	respBody, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(respBody)
+}
@@ -0,0 +1,204 @@
+// Package schedule parses cron expressions and finds the times they match.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression
+type Cron struct {
+	seconds  uint64
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// Like cron, when both days and weekdays are restricted either may match
+	anyDay     bool
+	anyWeekday bool
+}
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var (
+	secondField  = field{name: "second", min: 0, max: 59}
+	minuteField  = field{name: "minute", min: 0, max: 59}
+	hourField    = field{name: "hour", min: 0, max: 23}
+	dayField     = field{name: "day of month", min: 1, max: 31}
+	monthField   = field{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	weekdayField = field{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// Give up looking for a match this far ahead, e.g. for "0 0 30 2 *"
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// ParseCron parses a cron expression of 5 fields (minute hour day month weekday),
+// or 6 fields with seconds first. Fields take *, numbers, ranges (1-5), steps (*/15, 1-30/5),
+// lists (1,15) and three letter month and weekday names. Sunday is 0 or 7.
+func ParseCron(spec string) (Cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 5 {
+		fields = append([]string{"0"}, fields...)
+	}
+	if len(fields) != 6 {
+		return Cron{}, fmt.Errorf("cron: expected 5 or 6 fields, got %d", len(fields))
+	}
+	c := Cron{
+		anyDay:     fields[3] == "*" || fields[3] == "?",
+		anyWeekday: fields[5] == "*" || fields[5] == "?",
+	}
+	var err error
+	for i, dst := range []*uint64{&c.seconds, &c.minutes, &c.hours, &c.days, &c.months, &c.weekdays} {
+		f := []field{secondField, minuteField, hourField, dayField, monthField, weekdayField}[i]
+		*dst, err = f.parse(fields[i])
+		if err != nil {
+			return Cron{}, err
+		}
+	}
+	// 7 is also Sunday
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+	return c, nil
+}
+
+// parse returns the bits set by a field's comma separated list
+func (f field) parse(spec string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(spec, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepSpec)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("cron: invalid %s step %q", f.name, stepSpec)
+			}
+		}
+		start, end := f.min, f.max
+		if rangeSpec != "*" && rangeSpec != "?" {
+			lowSpec, highSpec, isRange := strings.Cut(rangeSpec, "-")
+			var err error
+			start, err = f.value(lowSpec)
+			if err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				end, err = f.value(highSpec)
+				if err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = f.max
+			}
+			if end < start {
+				return 0, fmt.Errorf("cron: invalid %s range %q", f.name, rangeSpec)
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(spec string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(spec, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(spec)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("cron: invalid %s %q", f.name, spec)
+	}
+	return v, nil
+}
+
+func (c Cron) dayMatches(t time.Time) bool {
+	day := c.days&(1<<t.Day()) != 0
+	weekday := c.weekdays&(1<<int(t.Weekday())) != 0
+	if c.anyDay || c.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// Next returns the first time after t matching the expression, in t's location.
+// Times skipped when daylight saving starts run as the clock jumps. Expressions with
+// set hours run once in the hour repeated when daylight saving ends, the first time round.
+// Returns the zero time if there is no match within five years.
+func (c Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Add(maxSearch)
+	next := t.Truncate(time.Second).Add(time.Second)
+	for next.Before(limit) {
+		var candidate time.Time
+		switch {
+		case c.months&(1<<int(next.Month())) == 0:
+			candidate = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(next):
+			candidate = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, loc)
+		case c.hours&(1<<next.Hour()) == 0:
+			candidate = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, loc)
+		case c.minutes&(1<<next.Minute()) == 0:
+			candidate = next.Truncate(time.Minute).Add(time.Minute)
+		case c.seconds&(1<<next.Second()) == 0:
+			candidate = next.Add(time.Second)
+		default:
+			end, repeat := repeatEnd(next)
+			if !repeat || c.hours == everyHour {
+				return next
+			}
+			candidate = end
+		}
+		// Daylight saving changes can move a wall clock date backwards
+		if !candidate.After(next) {
+			candidate = next.Add(time.Second)
+		}
+		// The wall clock moving further than real time means times were skipped. The
+		// skipped wall clock times are matched in UTC, which has no daylight saving.
+		skipped := wallClock(candidate).Sub(wallClock(next)) - candidate.Sub(next)
+		if skipped > 0 {
+			gapEnd := wallClock(candidate)
+			if match := c.Next(gapEnd.Add(-skipped - time.Second)); !match.IsZero() && match.Before(gapEnd) {
+				return candidate
+			}
+		}
+		next = candidate
+	}
+	return time.Time{}
+}
+
+// everyHour is the hours of an expression which runs in every hour
+const everyHour = 1<<24 - 1
+
+// wallClock returns t's date and time of day in UTC
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// repeatEnd returns whether t's wall clock time already happened before the clocks went back,
+// and when the repeated times end
+func repeatEnd(t time.Time) (time.Time, bool) {
+	start, _ := t.ZoneBounds()
+	if start.IsZero() {
+		return time.Time{}, false
+	}
+	_, before := start.Add(-time.Nanosecond).Zone()
+	_, after := t.Zone()
+	back := time.Duration(before-after) * time.Second
+	if back <= 0 || t.Sub(start) >= back {
+		return time.Time{}, false
+	}
+	return start.Add(back), true
+}
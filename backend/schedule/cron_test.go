@@ -0,0 +1,167 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{"* * * *", "expected 5 or 6 fields, got 4"},
+		{"* * * * * * *", "expected 5 or 6 fields, got 7"},
+		{"60 * * * *", `invalid minute "60"`},
+		{"* 24 * * *", `invalid hour "24"`},
+		{"* * 0 * *", `invalid day of month "0"`},
+		{"* * * 13 *", `invalid month "13"`},
+		{"* * * foo *", `invalid month "foo"`},
+		{"* * * * 8", `invalid day of week "8"`},
+		{"60 * * * * *", `invalid second "60"`},
+		{"*/0 * * * *", `invalid minute step "0"`},
+		{"*/x * * * *", `invalid minute step "x"`},
+		{"30-10 * * * *", `invalid minute range "30-10"`},
+		{"1,,2 * * * *", `invalid minute ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := ParseCron(tt.spec)
+			if err == nil {
+				t.Fatal("ParseCron succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseCron error %q, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// A Monday
+	from := time.Date(2026, 10, 19, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"step", "*/15 * * * *", from, time.Date(2026, 10, 19, 10, 15, 0, 0, time.UTC)},
+		{"seconds", "45 * * * * *", from, time.Date(2026, 10, 19, 10, 7, 45, 0, time.UTC)},
+		{"after a match", "*/15 * * * *", time.Date(2026, 10, 19, 10, 15, 0, 0, time.UTC), time.Date(2026, 10, 19, 10, 30, 0, 0, time.UTC)},
+		{"list and range", "0 8-9,17 * * *", from, time.Date(2026, 10, 19, 17, 0, 0, 0, time.UTC)},
+		{"range step", "0 1-12/5 * * *", from, time.Date(2026, 10, 19, 11, 0, 0, 0, time.UTC)},
+		{"names", "0 9 * nov mon-fri", from, time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC)},
+		{"weekday 0", "0 0 * * 0", from, time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"weekday 7", "0 0 * * 7", from, time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"weekday range to 7", "0 0 * * 6-7", time.Date(2026, 10, 24, 12, 0, 0, 0, time.UTC), time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"sun name", "0 0 * * sun", from, time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"day only", "0 0 20 * *", from, time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		{"day and any weekday", "0 0 20 * ?", from, time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		// With both restricted either matches: the 20th is a Tuesday, before the next Friday
+		{"day or weekday by day", "0 0 20 * fri", from, time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		{"day or weekday by weekday", "0 0 28 * fri", from, time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC)},
+		{"month end", "0 0 31 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"never", "0 0 30 2 *", from, time.Time{}},
+		{"location kept", "0 9 * * *", time.Date(2026, 10, 19, 10, 0, 0, 0, time.FixedZone("X", 3600)), time.Date(2026, 10, 20, 9, 0, 0, 0, time.FixedZone("X", 3600))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := c.Next(tt.from)
+			if !got.Equal(tt.want) || got.Location().String() != tt.from.Location().String() && !got.IsZero() {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+// checkRuns checks the runs of an expression from a start time
+func checkRuns(t *testing.T, spec string, from time.Time, want ...time.Time) {
+	t.Helper()
+	c, err := ParseCron(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := from
+	for i, w := range want {
+		next = c.Next(next)
+		if !next.Equal(w) {
+			t.Fatalf("%q run %d = %s, want %s", spec, i+1, next, w.In(from.Location()))
+		}
+	}
+}
+
+func TestNextSpringForward(t *testing.T) {
+	// New York skips from 02:00 EST to 03:00 EDT on 2026-03-08
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := func(d int, hour int, min int) time.Time { return time.Date(2026, 3, d, hour, min, 0, 0, ny) }
+	jump := time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC) // 03:00 EDT
+
+	t.Run("skipped time runs at the jump", func(t *testing.T) {
+		checkRuns(t, "30 2 * * *", day(7, 2, 30), jump, day(9, 2, 30))
+	})
+	t.Run("hourly", func(t *testing.T) {
+		checkRuns(t, "0 * * * *", day(8, 1, 0), jump, day(8, 4, 0))
+	})
+	t.Run("every 15 minutes", func(t *testing.T) {
+		checkRuns(t, "*/15 * * * *", day(8, 1, 30), day(8, 1, 45), jump, day(8, 3, 15))
+	})
+	t.Run("skipped day", func(t *testing.T) {
+		// Only the skipped time matches on the 8th
+		checkRuns(t, "30 2 8 3 *", day(1, 0, 0), jump, time.Date(2027, 3, 8, 2, 30, 0, 0, ny))
+	})
+	t.Run("other times unaffected", func(t *testing.T) {
+		checkRuns(t, "0 9 * * *", day(7, 9, 0), day(8, 9, 0))
+		checkRuns(t, "30 1 * * *", day(7, 1, 30), day(8, 1, 30), day(9, 1, 30))
+	})
+
+	// London skips from 01:00 GMT to 02:00 BST on 2026-03-29
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("london", func(t *testing.T) {
+		checkRuns(t, "30 1 * * *", time.Date(2026, 3, 28, 12, 0, 0, 0, london),
+			time.Date(2026, 3, 29, 1, 0, 0, 0, time.UTC), time.Date(2026, 3, 30, 1, 30, 0, 0, london))
+	})
+}
+
+func TestNextFallBack(t *testing.T) {
+	// New York repeats 01:00 to 02:00, first EDT then EST, on 2026-11-01
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(hour int, min int) time.Time { return time.Date(2026, 11, 1, hour, min, 0, 0, time.UTC) }
+	edt := func(hour int, min int) time.Time { return utc(hour+4, min).In(ny) }
+	est := func(hour int, min int) time.Time { return utc(hour+5, min).In(ny) }
+
+	t.Run("set time runs once", func(t *testing.T) {
+		checkRuns(t, "30 1 * * *", edt(0, 30), edt(1, 30), time.Date(2026, 11, 2, 1, 30, 0, 0, ny))
+	})
+	t.Run("set hour runs once", func(t *testing.T) {
+		checkRuns(t, "*/30 1 * * *", edt(0, 30), edt(1, 0), edt(1, 30), time.Date(2026, 11, 2, 1, 0, 0, 0, ny))
+	})
+	t.Run("started in the repeat", func(t *testing.T) {
+		checkRuns(t, "30 1 * * *", est(1, 10), time.Date(2026, 11, 2, 1, 30, 0, 0, ny))
+	})
+	t.Run("hourly runs in both", func(t *testing.T) {
+		checkRuns(t, "0 * * * *", edt(0, 30), edt(1, 0), est(1, 0), est(2, 0))
+	})
+	t.Run("every 30 minutes runs in both", func(t *testing.T) {
+		checkRuns(t, "*/30 * * * *", edt(1, 15), edt(1, 30), est(1, 0), est(1, 30), est(2, 0))
+	})
+	t.Run("other times unaffected", func(t *testing.T) {
+		checkRuns(t, "0 9 * * *", time.Date(2026, 10, 31, 9, 0, 0, 0, ny), time.Date(2026, 11, 1, 9, 0, 0, 0, ny))
+	})
+}
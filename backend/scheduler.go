@@ -0,0 +1,447 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	_ "time/tzdata" // Job timezones must work on hosts without a zoneinfo database
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/router"
+	"github.com/cassaram/bfc/backend/schedule"
+	"github.com/cassaram/bfc/backend/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// scheduleMutex guards reading and writing jobs, so the scheduler and API don't overwrite each other
+var scheduleMutex sync.Mutex
+
+var schedulerStarted time.Time
+
+const (
+	// Runs found later than this were missed, BFC wasn't running at the time
+	missedRunGrace = time.Minute
+	// How long after starting a missed run waits for its routers to be ready
+	missedRunReadyWait = 2 * time.Minute
+	// Results kept per job
+	jobResultsKept = 100
+)
+
+func getJob(name string) (apiv1.Job, error) {
+	job := apiv1.Job{}
+	err := Store.Get(store.BucketJobs, name, &job)
+	return job, err
+}
+
+func getJobs() ([]apiv1.Job, error) {
+	names, err := Store.Keys(store.BucketJobs)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]apiv1.Job, 0, len(names))
+	for _, name := range names {
+		job, err := getJob(name)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func jobLocation(job apiv1.Job) (*time.Location, error) {
+	if job.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(job.Timezone)
+}
+
+// jobNextRun returns the first run of a job after a time, or the zero time if there is none
+func jobNextRun(job apiv1.Job, after time.Time) time.Time {
+	if job.At != nil {
+		if job.At.After(after) {
+			return *job.At
+		}
+		return time.Time{}
+	}
+	loc, err := jobLocation(job)
+	if err != nil {
+		return time.Time{}
+	}
+	cron, err := schedule.ParseCron(job.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	return cron.Next(after.In(loc))
+}
+
+// jobLastRun is the time runs of a job are counted from
+func jobLastRun(job apiv1.Job) time.Time {
+	if job.LastRun != nil {
+		return *job.LastRun
+	}
+	return job.Created
+}
+
+// validateJob checks a job can be scheduled
+func validateJob(job apiv1.Job) error {
+	if (job.At == nil) == (job.Cron == "") {
+		return errors.New("Job needs one of at or cron")
+	}
+	if job.Cron != "" {
+		_, err := schedule.ParseCron(job.Cron)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := jobLocation(job)
+	if err != nil {
+		return fmt.Errorf("Invalid timezone %s", job.Timezone)
+	}
+	switch job.MissedRuns {
+	case "", apiv1.MissedRunSkip, apiv1.MissedRunRunOnce:
+	default:
+		return fmt.Errorf("Invalid missed_runs %s, expected %s or %s", job.MissedRuns, apiv1.MissedRunSkip, apiv1.MissedRunRunOnce)
+	}
+	if (job.Salvo == "") == (len(job.Crosspoints) == 0) {
+		return errors.New("Job needs one of salvo or crosspoints")
+	}
+	if job.Salvo != "" {
+		if _, err := getSalvo(job.Salvo); err != nil {
+			return fmt.Errorf("Salvo (%s) not found", job.Salvo)
+		}
+	}
+	for _, xpt := range job.Crosspoints {
+		if _, ok := getRouterConfig(xpt.RouterID); !ok {
+			return fmt.Errorf("Router ID (%d) not found", xpt.RouterID)
+		}
+	}
+	return nil
+}
+
+// jobSalvo returns the crosspoints a job routes
+func jobSalvo(job apiv1.Job) (apiv1.Salvo, error) {
+	if job.Salvo != "" {
+		return getSalvo(job.Salvo)
+	}
+	return apiv1.Salvo{Name: job.Name, Crosspoints: job.Crosspoints}, nil
+}
+
+// jobRoutersReady reports whether every router a job routes on is ready
+func jobRoutersReady(job apiv1.Job) bool {
+	salvo, err := jobSalvo(job)
+	if err != nil {
+		return true
+	}
+	for _, xpt := range salvo.Crosspoints {
+		rtr, rtr_ok := getRouter(xpt.RouterID)
+		if rtr_ok && rtr.GetStatus().State != router.StateReady {
+			return false
+		}
+	}
+	return true
+}
+
+// runJob routes a job and records the result
+func runJob(job apiv1.Job, scheduled time.Time, missed bool) {
+	result := apiv1.JobResult{Job: job.Name, Scheduled: scheduled, Ran: time.Now(), Missed: missed, Errors: make([]string, 0)}
+	salvo, err := jobSalvo(job)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Salvo (%s) not found", job.Salvo))
+	} else {
+		// Routing as the creator lets jobs switch their creator's booked destinations
+		fired := fireSalvo(salvo, job.CreatedBy, false)
+		result.Routed = fired.Routed
+		result.Errors = fired.Errors
+	}
+	log.Infof("Job %s: %d routed, %d failed", job.Name, result.Routed, len(result.Errors))
+	recordJobResult(result)
+}
+
+func getJobResults(name string) []apiv1.JobResult {
+	results := make([]apiv1.JobResult, 0)
+	Store.Get(store.BucketJobResults, name, &results)
+	return results
+}
+
+func recordJobResult(result apiv1.JobResult) {
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+	results := append(getJobResults(result.Job), result)
+	if len(results) > jobResultsKept {
+		results = results[len(results)-jobResultsKept:]
+	}
+	err := Store.Put(store.BucketJobResults, result.Job, results)
+	if err != nil {
+		log.Error("Job results: ", err.Error())
+	}
+}
+
+// dueRun is a job run found by runDueJobs
+type dueRun struct {
+	job       apiv1.Job
+	scheduled time.Time
+	missed    bool
+}
+
+// runDueJobs runs every job which is due. Each job runs at most once per call, with runs
+// missed while BFC wasn't running handled by the job's missed run policy.
+func runDueJobs(now time.Time) {
+	scheduleMutex.Lock()
+	jobs, err := getJobs()
+	if err != nil {
+		scheduleMutex.Unlock()
+		log.Error("Scheduler: ", err.Error())
+		return
+	}
+	due := make([]dueRun, 0)
+	for _, job := range jobs {
+		if job.Disabled {
+			continue
+		}
+		first := jobNextRun(job, jobLastRun(job))
+		if first.IsZero() || first.After(now) {
+			continue
+		}
+		// Only the latest of several missed runs is recorded. Long gaps are caught up over several calls.
+		last := first
+		for i := 0; i < 10000; i++ {
+			next := jobNextRun(job, last)
+			if next.IsZero() || next.After(now) {
+				break
+			}
+			last = next
+		}
+		missed := now.Sub(last) > missedRunGrace
+		if missed && job.MissedRuns == apiv1.MissedRunRunOnce && !jobRoutersReady(job) && now.Sub(schedulerStarted) < missedRunReadyWait {
+			continue
+		}
+		job.LastRun = &last
+		err = Store.Put(store.BucketJobs, job.Name, job)
+		if err != nil {
+			log.Errorf("Job %s: %s", job.Name, err.Error())
+			continue
+		}
+		due = append(due, dueRun{job: job, scheduled: last, missed: missed})
+	}
+	scheduleMutex.Unlock()
+
+	for _, run := range due {
+		if run.missed && run.job.MissedRuns != apiv1.MissedRunRunOnce {
+			log.Warnf("Job %s: Skipping run missed at %s", run.job.Name, run.scheduled.Format(time.RFC3339))
+			recordJobResult(apiv1.JobResult{Job: run.job.Name, Scheduled: run.scheduled, Ran: now, Missed: true, Skipped: true, Errors: make([]string, 0)})
+			continue
+		}
+		runJob(run.job, run.scheduled, run.missed)
+	}
+}
+
+// runScheduler checks for due jobs every interval until ctx is done
+func runScheduler(ctx context.Context, interval time.Duration) {
+	schedulerStarted = time.Now()
+	for {
+		runDueJobs(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// upcomingRuns returns the runs of enabled jobs between from and until, in time order
+func upcomingRuns(from time.Time, until time.Time, limit int) ([]apiv1.ScheduledRun, error) {
+	jobs, err := getJobs()
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]apiv1.ScheduledRun, 0)
+	for _, job := range jobs {
+		if job.Disabled {
+			continue
+		}
+		after := later(from, jobLastRun(job))
+		for i := 0; i < limit; i++ {
+			next := jobNextRun(job, after)
+			if next.IsZero() || next.After(until) {
+				break
+			}
+			runs = append(runs, apiv1.ScheduledRun{Job: job.Name, At: next})
+			after = next
+		}
+	}
+	slices.SortFunc(runs, func(a apiv1.ScheduledRun, b apiv1.ScheduledRun) int {
+		return cmp.Or(a.At.Compare(b.At), cmp.Compare(a.Job, b.Job))
+	})
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+func later(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// withNextRun fills in a job's next run
+func withNextRun(job apiv1.Job) apiv1.Job {
+	if job.Disabled {
+		return job
+	}
+	next := jobNextRun(job, later(time.Now(), jobLastRun(job)))
+	if !next.IsZero() {
+		job.NextRun = &next
+	}
+	return job
+}
+
+func (a *APIHandler) APIV1HandleJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := getJobs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range jobs {
+		jobs[i] = withNextRun(jobs[i])
+	}
+	jobsBody, err := json.Marshal(jobs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jobsBody)
+}
+
+func (a *APIHandler) APIV1HandleJob(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	job, err := getJob(name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Job (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jobBody, err := json.Marshal(withNextRun(job))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jobBody)
+}
+
+func (a *APIHandler) APIV1HandleJobPut(w http.ResponseWriter, r *http.Request) {
+	body := apiv1.Job{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	body.Name = r.PathValue("name")
+	body.Created = time.Now()
+	body.CreatedBy = requestUser(r)
+	body.LastRun = nil
+	body.NextRun = nil
+	err = validateJob(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.At != nil && !body.At.After(body.Created) {
+		http.Error(w, "Job at is in the past", http.StatusBadRequest)
+		return
+	}
+	scheduleMutex.Lock()
+	err = Store.Put(store.BucketJobs, body.Name, body)
+	scheduleMutex.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *APIHandler) APIV1HandleJobDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+	_, err := getJob(name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Job (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	err = Store.Delete(store.BucketJobs, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = Store.Delete(store.BucketJobResults, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *APIHandler) APIV1HandleJobResults(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	_, err := getJob(name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Job (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	results := getJobResults(name)
+	slices.Reverse(results)
+	resultsBody, err := json.Marshal(results)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resultsBody)
+}
+
+func (a *APIHandler) APIV1HandleScheduleUpcoming(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	until := now.Add(24 * time.Hour)
+	if untilStr := r.URL.Query().Get("until"); untilStr != "" {
+		var err error
+		until, err = time.Parse(time.RFC3339, untilStr)
+		if err != nil {
+			http.Error(w, "Invalid until, expected an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit "+limitStr, http.StatusBadRequest)
+			return
+		}
+	}
+	runs, err := upcomingRuns(now, until, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	runsBody, err := json.Marshal(runs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(runsBody)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cassaram/bfc/backend/router"
+)
+
+// fuzzyScore rates how well a name matches a search query, ignoring case. 0 means no match.
+func fuzzyScore(query string, name string) int {
+	query = strings.ToLower(strings.TrimSpace(query))
+	name = strings.ToLower(name)
+	switch {
+	case query == "":
+		return 1
+	case name == query:
+		return 1000
+	case strings.HasPrefix(name, query):
+		return 800
+	}
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if strings.HasPrefix(word, query) {
+			return 600
+		}
+	}
+	if strings.Contains(name, query) {
+		return 400
+	}
+
+	// Every query character in order, so "cam3" finds "CAM03_V". Fewer skipped characters score higher.
+	query = strings.Join(strings.Fields(query), "")
+	skipped := 0
+	pos := 0
+	for _, qr := range query {
+		idx := strings.IndexRune(name[pos:], qr)
+		if idx < 0 {
+			return 0
+		}
+		skipped += idx
+		pos += idx + len(string(qr))
+	}
+	return max(1, 200-skipped)
+}
+
+// searchQuery holds the search and pagination parameters of a sources or destinations request
+type searchQuery struct {
+	query  string
+	tags   []string
+	level  string
+	limit  int
+	offset int
+}
+
+func parseSearchQuery(values url.Values) (searchQuery, error) {
+	search := searchQuery{
+		query: values.Get("q"),
+		tags:  values["tag"],
+		level: values.Get("level"),
+	}
+	for _, param := range []struct {
+		name string
+		val  *int
+	}{{"limit", &search.limit}, {"offset", &search.offset}} {
+		str := values.Get(param.name)
+		if str == "" {
+			continue
+		}
+		num, err := strconv.Atoi(str)
+		if err != nil || num < 0 {
+			return search, fmt.Errorf("%s must be a positive number, got %q", param.name, str)
+		}
+		*param.val = num
+	}
+	return search, nil
+}
+
+// searchItems filters items by name, tags and level, best matches first when there is a query.
+// Returns the requested page and the total number of matches.
+func searchItems[T any](rtr router.Router, search searchQuery, items []T, key func(T) (int, string, []int, []string)) ([]T, int, error) {
+	levelID := 0
+	if search.level != "" {
+		lvl, err := router.ResolveLevel(rtr, search.level)
+		if err != nil {
+			return nil, 0, err
+		}
+		levelID = lvl.ID
+	}
+
+	type match struct {
+		item  T
+		id    int
+		score int
+	}
+	matches := make([]match, 0)
+	for _, item := range items {
+		id, name, levels, tags := key(item)
+		if levelID != 0 && !slices.Contains(levels, levelID) {
+			continue
+		}
+		hasTags := true
+		for _, want := range search.tags {
+			if !slices.ContainsFunc(tags, func(tag string) bool { return strings.EqualFold(tag, want) }) {
+				hasTags = false
+				break
+			}
+		}
+		if !hasTags {
+			continue
+		}
+		score := fuzzyScore(search.query, name)
+		if score == 0 {
+			continue
+		}
+		matches = append(matches, match{item: item, id: id, score: score})
+	}
+	slices.SortStableFunc(matches, func(a match, b match) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), cmp.Compare(a.id, b.id))
+	})
+
+	total := len(matches)
+	start := min(search.offset, total)
+	end := total
+	if search.limit > 0 {
+		end = min(start+search.limit, total)
+	}
+	page := make([]T, 0, end-start)
+	for _, m := range matches[start:end] {
+		page = append(page, m.item)
+	}
+	return page, total, nil
+}
+
+func searchSources(rtr router.Router, search searchQuery) ([]router.Source, int, error) {
+	return searchItems(rtr, search, rtr.GetSources(), func(s router.Source) (int, string, []int, []string) {
+		return s.ID, s.Name, s.Levels, s.Tags
+	})
+}
+
+func searchDestinations(rtr router.Router, search searchQuery) ([]router.Destination, int, error) {
+	return searchItems(rtr, search, rtr.GetDestinations(), func(d router.Destination) (int, string, []int, []string) {
+		return d.ID, d.Name, d.Levels, d.Tags
+	})
+}
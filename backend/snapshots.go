@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/router"
+	"github.com/cassaram/bfc/backend/store"
+)
+
+// getSnapshot loads a stored snapshot
+func getSnapshot(name string) (apiv1.Snapshot, error) {
+	snapshot := apiv1.Snapshot{}
+	err := Store.Get(store.BucketSnapshots, name, &snapshot)
+	return snapshot, err
+}
+
+// snapshotCrosspoints returns the crosspoints of a router as salvo crosspoints which route them again.
+// Follow only routers get one follow route per destination.
+func snapshotCrosspoints(routerID int, rtr router.Router) []apiv1.SalvoCrosspoint {
+	breakaway := rtr.GetCapabilities().Breakaway
+	crosspoints := make([]apiv1.SalvoCrosspoint, 0)
+	followed := make(map[int]bool)
+	for _, xpt := range rtr.GetCrosspoints() {
+		// Nothing to route back for levels without a known source
+		if xpt.Source == 0 {
+			continue
+		}
+		req := apiv1.CrosspointRequest{
+			DestinationID:      xpt.Destination,
+			DestinationLevelID: xpt.DestinationLevel,
+			SourceID:           xpt.Source,
+			SourceLevelID:      xpt.SourceLevel,
+		}
+		if !breakaway {
+			if followed[xpt.Destination] {
+				continue
+			}
+			followed[xpt.Destination] = true
+			req.DestinationLevelID = -1
+			req.SourceLevelID = -1
+		}
+		crosspoints = append(crosspoints, apiv1.SalvoCrosspoint{RouterID: routerID, CrosspointRequest: req})
+	}
+	return crosspoints
+}
+
+func (a *APIHandler) APIV1HandleSnapshots(w http.ResponseWriter, r *http.Request) {
+	names, err := Store.Keys(store.BucketSnapshots)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	snapshots := make([]apiv1.Snapshot, 0)
+	for _, name := range names {
+		snapshot, err := getSnapshot(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	snapshotsBody, err := json.Marshal(snapshots)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(snapshotsBody)
+}
+
+func (a *APIHandler) APIV1HandleSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	snapshot, err := getSnapshot(name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Snapshot (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	snapshotBody, err := json.Marshal(snapshot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(snapshotBody)
+}
+
+func (a *APIHandler) APIV1HandleSnapshotPut(w http.ResponseWriter, r *http.Request) {
+	body := apiv1.SnapshotRequest{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	// The body is optional
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	routerIDs := body.RouterIDs
+	if len(routerIDs) == 0 {
+		for _, routerConfig := range getConfig().Routers {
+			routerIDs = append(routerIDs, routerConfig.ID)
+		}
+	}
+	slices.Sort(routerIDs)
+	snapshot := apiv1.Snapshot{
+		Name:        r.PathValue("name"),
+		Created:     time.Now(),
+		CreatedBy:   requestUser(r),
+		Crosspoints: make([]apiv1.SalvoCrosspoint, 0),
+	}
+	for _, routerID := range slices.Compact(routerIDs) {
+		rtr, rtr_ok := getRouter(routerID)
+		if !rtr_ok {
+			http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusBadRequest)
+			return
+		}
+		// Saving a router before it has synced would save nothing, or crosspoints it no longer has
+		if rtr.GetStatus().State != router.StateReady {
+			http.Error(w, fmt.Sprintf("Router ID (%d) is not ready", routerID), http.StatusConflict)
+			return
+		}
+		snapshot.Crosspoints = append(snapshot.Crosspoints, snapshotCrosspoints(routerID, rtr)...)
+	}
+	err = Store.Put(store.BucketSnapshots, snapshot.Name, snapshot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordAudit(snapshot.CreatedBy, apiv1.AuditSnapshot, "Save snapshot "+snapshot.Name, nil)
+	snapshotBody, err := json.Marshal(snapshot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(snapshotBody)
+}
+
+func (a *APIHandler) APIV1HandleSnapshotDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	_, err := getSnapshot(name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Snapshot (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	err = Store.Delete(store.BucketSnapshots, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordAudit(requestUser(r), apiv1.AuditSnapshot, "Delete snapshot "+name, nil)
+}
+
+func (a *APIHandler) APIV1HandleSnapshotRestorePost(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	snapshot, err := getSnapshot(name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Snapshot (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result := routeCrosspoints(apiv1.AuditSnapshot, "Restore snapshot "+snapshot.Name, snapshot.Crosspoints, requestUser(r), true)
+	respBody, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(respBody)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cassaram/bfc/backend/router"
+	"github.com/cassaram/bfc/backend/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// RouterState is the last known state of a router, persisted so it can be served before the router reconnects
+type RouterState struct {
+	Levels       []router.Level       `json:"levels"`
+	Sources      []router.Source      `json:"sources"`
+	Destinations []router.Destination `json:"destinations"`
+	Crosspoints  []router.Crosspoint  `json:"crosspoints"`
+	Updated      time.Time            `json:"updated"`
+}
+
+var routerStateDirty = make(map[int]bool)
+var routerStateDirtyMutex sync.Mutex
+
+// crosspointNotifier returns the crosspoint notify function for a router
+func crosspointNotifier(routerID int) func(router.Crosspoint) {
+	return func(crosspoint router.Crosspoint) {
+		API.APIV1SendCrosspoint(routerID, crosspoint)
+		err := History.Record(routerID, crosspoint, time.Now())
+		if err != nil {
+			log.Error("History: ", err.Error())
+		}
+		if EmberPlus != nil && emberPlusPublished(routerID) {
+			EmberPlus.NotifyCrosspoint(routerID, crosspoint)
+		}
+		observeRouteConfirmed(routerID, crosspoint)
+		routerStateDirtyMutex.Lock()
+		routerStateDirty[routerID] = true
+		routerStateDirtyMutex.Unlock()
+	}
+}
+
+// statusNotifier returns the status notify function for a router
+func statusNotifier(routerID int) func(router.Status) {
+	return func(status router.Status) {
+		log.Infof("Router %d: %s", routerID, status.State)
+		API.APIV1SendRouterStatus(routerID, status)
+	}
+}
+
+// saveRouterStates periodically persists the state of routers which reported changes
+func saveRouterStates(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		routerStateDirtyMutex.Lock()
+		dirty := routerStateDirty
+		routerStateDirty = make(map[int]bool)
+		routerStateDirtyMutex.Unlock()
+		for routerID := range dirty {
+			rtr, rtr_ok := getRouter(routerID)
+			if !rtr_ok {
+				continue
+			}
+			saveRouterState(routerID, rtr)
+		}
+	}
+}
+
+func saveRouterState(routerID int, rtr router.Router) {
+	state := RouterState{
+		Levels:       rtr.GetLevels(),
+		Sources:      rtr.GetSources(),
+		Destinations: rtr.GetDestinations(),
+		Crosspoints:  rtr.GetCrosspoints(),
+		Updated:      time.Now(),
+	}
+	// Don't replace a good state with a router that hasn't finished syncing
+	if len(state.Levels) == 0 || len(state.Destinations) == 0 {
+		return
+	}
+	err := Store.Put(store.BucketRouterState, strconv.Itoa(routerID), state)
+	if err != nil {
+		log.Error("Router state: ", err.Error())
+	}
+}
+
+// withLastKnownState returns the router, or its last known state if the router isn't ready.
+// The boolean is true when the returned data is stale.
+func withLastKnownState(routerID int, rtr router.Router) (router.Router, bool) {
+	if rtr.GetStatus().State == router.StateReady {
+		return rtr, false
+	}
+	state := RouterState{}
+	err := Store.Get(store.BucketRouterState, strconv.Itoa(routerID), &state)
+	if err != nil {
+		return rtr, true
+	}
+	return &lastKnownRouter{Router: rtr, state: state}, true
+}
+
+// lastKnownRouter answers queries from a persisted RouterState and passes commands to the real router
+type lastKnownRouter struct {
+	router.Router
+	state RouterState
+}
+
+func (r *lastKnownRouter) GetLevels() []router.Level {
+	return r.state.Levels
+}
+
+func (r *lastKnownRouter) GetSources() []router.Source {
+	return r.state.Sources
+}
+
+func (r *lastKnownRouter) GetDestinations() []router.Destination {
+	return r.state.Destinations
+}
+
+func (r *lastKnownRouter) GetCrosspoints() []router.Crosspoint {
+	return r.state.Crosspoints
+}
+
+func (r *lastKnownRouter) GetLevel(lvlID int) router.Level {
+	for _, lvl := range r.state.Levels {
+		if lvl.ID == lvlID {
+			return lvl
+		}
+	}
+	return router.Level{}
+}
+
+func (r *lastKnownRouter) GetSource(srcID int) router.Source {
+	for _, src := range r.state.Sources {
+		if src.ID == srcID {
+			return src
+		}
+	}
+	return router.Source{}
+}
+
+func (r *lastKnownRouter) GetDestination(destID int) router.Destination {
+	for _, dest := range r.state.Destinations {
+		if dest.ID == destID {
+			return dest
+		}
+	}
+	return router.Destination{}
+}
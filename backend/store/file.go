@@ -0,0 +1,193 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+type fileData struct {
+	SchemaVersion int                                   `json:"schema_version"`
+	Buckets       map[string]map[string]json.RawMessage `json:"buckets"`
+}
+
+func (d *fileData) bucket(name string) map[string]json.RawMessage {
+	b, ok := d.Buckets[name]
+	if !ok {
+		b = make(map[string]json.RawMessage)
+		d.Buckets[name] = b
+	}
+	return b
+}
+
+// FileStore keeps all data in memory and writes it to a single JSON file.
+// Writes are batched and flushed in the background; an empty path keeps data in memory only.
+type FileStore struct {
+	path  string
+	data  fileData
+	mutex sync.Mutex
+	dirty bool
+	stop  chan bool
+	done  chan bool
+}
+
+// Open loads the store at path, creating it if needed, and migrates it to the current schema
+func Open(path string, flushInterval time.Duration) (*FileStore, error) {
+	s := &FileStore{
+		path: path,
+		data: fileData{
+			Buckets: make(map[string]map[string]json.RawMessage),
+		},
+		stop: make(chan bool),
+		done: make(chan bool),
+	}
+
+	if path != "" {
+		fileBytes, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			err = json.Unmarshal(fileBytes, &s.data)
+			if err != nil {
+				return nil, fmt.Errorf("store: reading %s: %w", path, err)
+			}
+			if s.data.Buckets == nil {
+				s.data.Buckets = make(map[string]map[string]json.RawMessage)
+			}
+		}
+	}
+
+	err := s.migrate()
+	if err != nil {
+		return nil, err
+	}
+
+	go s.flushLoop(flushInterval)
+	return s, nil
+}
+
+func (s *FileStore) migrate() error {
+	if s.data.SchemaVersion > SchemaVersion() {
+		return fmt.Errorf("store: %s has schema version %d, newer than supported version %d", s.path, s.data.SchemaVersion, SchemaVersion())
+	}
+	for _, m := range migrations {
+		if m.Version <= s.data.SchemaVersion {
+			continue
+		}
+		log.Infof("Store: Migrating to schema version %d (%s)", m.Version, m.Description)
+		err := m.Migrate(&s.data)
+		if err != nil {
+			return fmt.Errorf("store: migration %d: %w", m.Version, err)
+		}
+		s.data.SchemaVersion = m.Version
+		s.dirty = true
+	}
+	return nil
+}
+
+func (s *FileStore) Get(bucket string, key string, v any) error {
+	s.mutex.Lock()
+	raw, ok := s.data.Buckets[bucket][key]
+	s.mutex.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (s *FileStore) Put(bucket string, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.data.bucket(bucket)[key] = raw
+	s.dirty = true
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *FileStore) Delete(bucket string, key string) error {
+	s.mutex.Lock()
+	delete(s.data.Buckets[bucket], key)
+	s.dirty = true
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *FileStore) Keys(bucket string) ([]string, error) {
+	s.mutex.Lock()
+	keys := maps.Keys(s.data.Buckets[bucket])
+	s.mutex.Unlock()
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (s *FileStore) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.dirty || s.path == "" {
+		return nil
+	}
+	fileBytes, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename so a crash never leaves a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(fileBytes)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+func (s *FileStore) flushLoop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			err := s.Flush()
+			if err != nil {
+				log.Error("Store: ", err.Error())
+			}
+		}
+	}
+}
+
+func (s *FileStore) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.Flush()
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+// Migration upgrades the stored data to Version from Version-1
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(d *fileData) error
+}
+
+// migrations must be in version order. Append new migrations, never edit released ones.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Initial schema",
+		Migrate: func(d *fileData) error {
+			d.bucket(BucketMeta)
+			d.bucket(BucketRouterState)
+			return nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "Add salvos",
+		Migrate: func(d *fileData) error {
+			d.bucket(BucketSalvos)
+			return nil
+		},
+	},
+	{
+		Version:     3,
+		Description: "Add name sets and user preferences",
+		Migrate: func(d *fileData) error {
+			d.bucket(BucketNameSets)
+			d.bucket(BucketUsers)
+			return nil
+		},
+	},
+	{
+		Version:     4,
+		Description: "Add source and destination tags",
+		Migrate: func(d *fileData) error {
+			d.bucket(BucketTags)
+			return nil
+		},
+	},
+	{
+		Version:     5,
+		Description: "Add user panels",
+		Migrate: func(d *fileData) error {
+			d.bucket(BucketPanels)
+			return nil
+		},
+	},
+	{
+		Version:     6,
+		Description: "Add scheduled jobs",
+		Migrate: func(d *fileData) error {
+			d.bucket(BucketJobs)
+			d.bucket(BucketJobResults)
+			return nil
+		},
+	},
+	{
+		Version:     7,
+		Description: "Add bookings",
+		Migrate: func(d *fileData) error {
+			d.bucket(BucketBookings)
+			return nil
+		},
+	},
+	{
+		Version:     8,
+		Description: "Add undo history",
+		Migrate: func(d *fileData) error {
+			d.bucket(BucketUndo)
+			return nil
+		},
+	},
+	{
+		Version:     9,
+		Description: "Add snapshots and audit records",
+		Migrate: func(d *fileData) error {
+			d.bucket(BucketSnapshots)
+			d.bucket(BucketAudit)
+			return nil
+		},
+	},
+	{
+		Version:     10,
+		Description: "Escape user and name set keys",
+		Migrate: func(d *fileData) error {
+			// Old keys were the unescaped parts joined by "/". The stored name tells where the owner ends.
+			err := rekey(d.bucket(BucketPanels), func(key string, name string) (string, bool) {
+				user, ok := strings.CutSuffix(key, "/"+name)
+				return PanelKey(user, name), ok
+			})
+			if err != nil {
+				return err
+			}
+			return rekey(d.bucket(BucketNameSets), func(key string, name string) (string, bool) {
+				routerID, _, ok := strings.Cut(key, "/")
+				id, err := strconv.Atoi(routerID)
+				return NameSetKey(id, name), ok && err == nil
+			})
+		},
+	},
+}
+
+// rekey moves each value of a bucket to the key newKey returns for its old key and stored name.
+// Values newKey can't place are left where they are.
+func rekey(bucket map[string]json.RawMessage, newKey func(key string, name string) (string, bool)) error {
+	for key, raw := range maps.Clone(bucket) {
+		value := struct {
+			Name string `json:"name"`
+		}{}
+		err := json.Unmarshal(raw, &value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		moved, ok := newKey(key, value.Name)
+		if !ok || moved == key {
+			continue
+		}
+		delete(bucket, key)
+		bucket[moved] = raw
+	}
+	return nil
+}
+
+// SchemaVersion is the schema version written by this build
+func SchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
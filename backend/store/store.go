@@ -0,0 +1,57 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var ErrNotFound = errors.New("store: not found")
+
+// Store persists BFC data as JSON values in named buckets
+type Store interface {
+	// Get decodes the value stored under key into v. Returns ErrNotFound if there is none.
+	Get(bucket string, key string, v any) error
+	Put(bucket string, key string, v any) error
+	Delete(bucket string, key string) error
+	// Keys returns the sorted keys of a bucket
+	Keys(bucket string) ([]string, error)
+	// Flush writes any pending changes to disk
+	Flush() error
+	Close() error
+}
+
+// Buckets used by BFC
+const (
+	BucketMeta        = "meta"
+	BucketRouterState = "router_state"
+	BucketSalvos      = "salvos"
+	BucketNameSets    = "namesets" // Keyed by router ID and name set name, see NameSetKey
+	BucketUsers       = "users"
+	BucketTags        = "tags"   // Keyed by router ID
+	BucketPanels      = "panels" // Keyed by user and panel name, see PanelKey
+	BucketJobs        = "jobs"
+	BucketJobResults  = "job_results" // Keyed by job name
+	BucketBookings    = "bookings"
+	BucketUndo        = "undo" // Keyed by user
+	BucketSnapshots   = "snapshots"
+	BucketAudit       = "audit" // Keyed by time, see AuditKey
+)
+
+// PanelKey is the BucketPanels key of a user's panel. Both parts are escaped, so the key
+// has one "/" and a user's keys can be listed by prefix.
+func PanelKey(user string, name string) string {
+	return url.PathEscape(user) + "/" + url.PathEscape(name)
+}
+
+// NameSetKey is the BucketNameSets key of a router's name set, escaped like PanelKey
+func NameSetKey(routerID int, name string) string {
+	return strconv.Itoa(routerID) + "/" + url.PathEscape(name)
+}
+
+// AuditKey is the BucketAudit key of a record. Keys sort in time order; seq separates records with the same time.
+func AuditKey(t time.Time, seq uint64) string {
+	return fmt.Sprintf("%s-%06d", t.UTC().Format("2006-01-02T15:04:05.000000000Z"), seq%1000000)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/config"
+	"github.com/cassaram/bfc/backend/router"
+	"github.com/cassaram/bfc/backend/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// tagRule is a config.TagRule with its regular expression compiled
+type tagRule struct {
+	config.TagRule
+	regex *regexp.Regexp
+}
+
+func (t tagRule) matches(kind string, name string) bool {
+	if t.AppliesTo != "" && t.AppliesTo != kind {
+		return false
+	}
+	if t.regex != nil {
+		return t.regex.MatchString(name)
+	}
+	return strings.HasPrefix(name, t.Prefix)
+}
+
+func getRouterTags(routerID int) apiv1.RouterTags {
+	tags := apiv1.RouterTags{}
+	Store.Get(store.BucketTags, strconv.Itoa(routerID), &tags)
+	if tags.Sources == nil {
+		tags.Sources = make(map[int][]string)
+	}
+	if tags.Destinations == nil {
+		tags.Destinations = make(map[int][]string)
+	}
+	return tags
+}
+
+// TagRules are the compiled tag rules per router ID, swapped with ConfigFile on reload
+var TagRules map[int][]tagRule
+
+// compileTagRules compiles the tag rules of every router in a config
+func compileTagRules(cfg config.ConfigFile) map[int][]tagRule {
+	tagRules := make(map[int][]tagRule)
+	for _, rtrCfg := range cfg.Routers {
+		rules := make([]tagRule, 0, len(rtrCfg.Tags))
+		for _, rule := range rtrCfg.Tags {
+			compiled := tagRule{TagRule: rule}
+			if rule.Regex != "" {
+				regex, err := regexp.Compile(rule.Regex)
+				if err != nil {
+					// Validated when the config was loaded
+					log.Errorf("Router %d: Tag %s: %s", rtrCfg.ID, rule.Tag, err.Error())
+					continue
+				}
+				compiled.regex = regex
+			}
+			rules = append(rules, compiled)
+		}
+		tagRules[rtrCfg.ID] = rules
+	}
+	return tagRules
+}
+
+// withTags returns the router with the tags from the config's rules and API edits added
+func withTags(routerID int, rtr router.Router) router.Router {
+	RoutersMutex.RLock()
+	rules := TagRules[routerID]
+	RoutersMutex.RUnlock()
+	return &taggedRouter{Router: rtr, rules: rules, edits: getRouterTags(routerID)}
+}
+
+// taggedRouter adds tags to a router's sources and destinations
+type taggedRouter struct {
+	router.Router
+	rules []tagRule
+	edits apiv1.RouterTags
+}
+
+func (r *taggedRouter) tags(kind string, name string, edited []string) []string {
+	tags := slices.Clone(edited)
+	for _, rule := range r.rules {
+		if rule.matches(kind, name) && !slices.Contains(tags, rule.Tag) {
+			tags = append(tags, rule.Tag)
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+func (r *taggedRouter) GetSources() []router.Source {
+	sources := slices.Clone(r.Router.GetSources())
+	for i := range sources {
+		sources[i].Tags = r.tags(config.TagSources, sources[i].Name, r.edits.Sources[sources[i].ID])
+	}
+	return sources
+}
+
+func (r *taggedRouter) GetSource(srcID int) router.Source {
+	src := r.Router.GetSource(srcID)
+	src.Tags = r.tags(config.TagSources, src.Name, r.edits.Sources[srcID])
+	return src
+}
+
+func (r *taggedRouter) GetDestinations() []router.Destination {
+	dests := slices.Clone(r.Router.GetDestinations())
+	for i := range dests {
+		dests[i].Tags = r.tags(config.TagDestinations, dests[i].Name, r.edits.Destinations[dests[i].ID])
+	}
+	return dests
+}
+
+func (r *taggedRouter) GetDestination(destID int) router.Destination {
+	dest := r.Router.GetDestination(destID)
+	dest.Tags = r.tags(config.TagDestinations, dest.Name, r.edits.Destinations[destID])
+	return dest
+}
+
+// allTags returns every tag in use on a router
+func allTags(rtr router.Router) []string {
+	tags := make([]string, 0)
+	for _, src := range rtr.GetSources() {
+		tags = append(tags, src.Tags...)
+	}
+	for _, dest := range rtr.GetDestinations() {
+		tags = append(tags, dest.Tags...)
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
+
+// cleanTags trims tags and drops empty and duplicate ones
+func cleanTags(tags []string) []string {
+	cleaned := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(cleaned, tag) {
+			cleaned = append(cleaned, tag)
+		}
+	}
+	slices.Sort(cleaned)
+	return cleaned
+}
+
+var tagsMutex sync.Mutex
+
+// setTags replaces the API edited tags of a source or destination. Tags from rules are kept.
+func setTags(routerID int, rtr router.Router, kind string, ref string, tags []string) error {
+	tagsMutex.Lock()
+	defer tagsMutex.Unlock()
+	routerTags := getRouterTags(routerID)
+	if kind == config.TagSources {
+		src, err := router.ResolveSource(rtr, ref)
+		if err != nil {
+			return err
+		}
+		routerTags.Sources[src.ID] = cleanTags(tags)
+	} else {
+		dest, err := router.ResolveDestination(rtr, ref)
+		if err != nil {
+			return err
+		}
+		routerTags.Destinations[dest.ID] = cleanTags(tags)
+	}
+	// Don't keep empty entries around
+	for _, edits := range []map[int][]string{routerTags.Sources, routerTags.Destinations} {
+		for id, tags := range edits {
+			if len(tags) == 0 {
+				delete(edits, id)
+			}
+		}
+	}
+	return Store.Put(store.BucketTags, strconv.Itoa(routerID), routerTags)
+}
+
+func (a *APIHandler) APIV1HandleTags(w http.ResponseWriter, r *http.Request) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	rtr, rtr_ok := getRouter(routerID)
+	if !rtr_ok {
+		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
+		return
+	}
+	rtr, _ = withLastKnownState(routerID, rtr)
+	tagsBody, err := json.Marshal(allTags(withTags(routerID, rtr)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(tagsBody)
+}
+
+func (a *APIHandler) APIV1HandleSourceTagsPut(w http.ResponseWriter, r *http.Request) {
+	a.handleTagsPut(w, r, config.TagSources, r.PathValue("source"))
+}
+
+func (a *APIHandler) APIV1HandleDestinationTagsPut(w http.ResponseWriter, r *http.Request) {
+	a.handleTagsPut(w, r, config.TagDestinations, r.PathValue("destination"))
+}
+
+func (a *APIHandler) handleTagsPut(w http.ResponseWriter, r *http.Request, kind string, ref string) {
+	routerID, err := resolveRouterID(r.PathValue("router_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	rtr, rtr_ok := getRouter(routerID)
+	if !rtr_ok {
+		http.Error(w, fmt.Sprintf("Router ID (%d) not found", routerID), http.StatusNotFound)
+		return
+	}
+	rtr, _ = withLastKnownState(routerID, rtr)
+	body := make([]string, 0)
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = setTags(routerID, rtr, kind, ref, body)
+	if errors.Is(err, router.ErrUnknownName) || errors.Is(err, router.ErrAmbiguousName) {
+		http.Error(w, err.Error(), resolveStatus(err))
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/router"
+	"github.com/cassaram/bfc/backend/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// Operations kept per user for undo
+const undoDepth = 20
+
+var undoMutex sync.Mutex
+
+// capturePrevious returns the crosspoint levels a route will change, before it is sent
+func capturePrevious(routerID int, rtr router.Router, destID int, destLevelID int, srcID int, srcLevelID int) []apiv1.UndoCrosspoint {
+	changes := make([]apiv1.UndoCrosspoint, 0)
+	for _, xpt := range rtr.GetCrosspoints() {
+		if xpt.Destination != destID || (destLevelID != -1 && xpt.DestinationLevel != destLevelID) {
+			continue
+		}
+		routed := router.Crosspoint{Destination: destID, DestinationLevel: xpt.DestinationLevel, Source: srcID, SourceLevel: srcLevelID}
+		// Follow routes take the source's level of the same number
+		if srcLevelID == -1 {
+			routed.SourceLevel = xpt.DestinationLevel
+		}
+		changes = append(changes, apiv1.UndoCrosspoint{RouterID: routerID, Previous: xpt, Routed: routed})
+	}
+	return changes
+}
+
+func getUndoStack(user string) []apiv1.UndoOperation {
+	stack := make([]apiv1.UndoOperation, 0)
+	Store.Get(store.BucketUndo, user, &stack)
+	return stack
+}
+
+// recordUndo adds an operation to a user's undo stack. Anonymous operations can't be undone.
+func recordUndo(user string, description string, changes []apiv1.UndoCrosspoint) {
+	if user == "" || len(changes) == 0 {
+		return
+	}
+	undoMutex.Lock()
+	defer undoMutex.Unlock()
+	stack := append(getUndoStack(user), apiv1.UndoOperation{Description: description, Time: time.Now(), Crosspoints: changes})
+	if len(stack) > undoDepth {
+		stack = stack[len(stack)-undoDepth:]
+	}
+	err := Store.Put(store.BucketUndo, user, stack)
+	if err != nil {
+		log.Error("Undo: ", err.Error())
+	}
+}
+
+// checkUndo returns the HTTP status and error if an operation can't be undone by a user
+func checkUndo(op apiv1.UndoOperation, user string) (int, error) {
+	for _, change := range op.Crosspoints {
+		rtr, rtr_ok := getRouter(change.RouterID)
+		if !rtr_ok {
+			return http.StatusConflict, fmt.Errorf("Router ID (%d) not found", change.RouterID)
+		}
+		dest := change.Routed.Destination
+		level := change.Routed.DestinationLevel
+		idx := slices.IndexFunc(rtr.GetCrosspoints(), func(xpt router.Crosspoint) bool {
+			return xpt.Destination == dest && xpt.DestinationLevel == level
+		})
+		if idx == -1 {
+			return http.StatusConflict, fmt.Errorf("Router %d: destination %d level %d is unknown", change.RouterID, dest, level)
+		}
+		current := rtr.GetCrosspoints()[idx]
+		if current.Source != change.Routed.Source || current.SourceLevel != change.Routed.SourceLevel {
+			return http.StatusConflict, fmt.Errorf("Router %d: destination %d level %d has changed since", change.RouterID, dest, level)
+		}
+		if current.Locked {
+			return http.StatusConflict, fmt.Errorf("Router %d: destination %d level %d is locked", change.RouterID, dest, level)
+		}
+		if change.Previous.Source == 0 {
+			return http.StatusConflict, fmt.Errorf("Router %d: destination %d level %d had no known source", change.RouterID, dest, level)
+		}
+		err := checkBooking(change.RouterID, dest, user)
+		if err != nil {
+			return http.StatusForbidden, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// undoOperation routes the previous crosspoints of an operation
+func undoOperation(op apiv1.UndoOperation) error {
+	errs := make([]error, 0)
+	followed := make(map[[2]int]bool)
+	for _, change := range op.Crosspoints {
+		rtr, rtr_ok := getRouter(change.RouterID)
+		if !rtr_ok {
+			continue
+		}
+		prev := change.Previous
+		if !rtr.GetCapabilities().Breakaway {
+			// Follow only routers route every level at once
+			key := [2]int{change.RouterID, prev.Destination}
+			if followed[key] {
+				continue
+			}
+			followed[key] = true
+			prev.DestinationLevel = -1
+			prev.SourceLevel = -1
+		}
+		err := setCrosspoint(change.RouterID, rtr, prev.Destination, prev.DestinationLevel, prev.Source, prev.SourceLevel)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Router %d: destination %d: %w", change.RouterID, prev.Destination, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a *APIHandler) APIV1HandleUndo(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	if user == "" {
+		http.Error(w, errNoUser.Error(), http.StatusBadRequest)
+		return
+	}
+	stack := getUndoStack(user)
+	slices.Reverse(stack)
+	stackBody, err := json.Marshal(stack)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(stackBody)
+}
+
+func (a *APIHandler) APIV1HandleUndoPost(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	if user == "" {
+		http.Error(w, errNoUser.Error(), http.StatusBadRequest)
+		return
+	}
+	undoMutex.Lock()
+	defer undoMutex.Unlock()
+	stack := getUndoStack(user)
+	if len(stack) == 0 {
+		http.Error(w, "Nothing to undo", http.StatusNotFound)
+		return
+	}
+	op := stack[len(stack)-1]
+	status, err := checkUndo(op, user)
+	if err != nil {
+		http.Error(w, "Can't undo "+op.Description+": "+err.Error(), status)
+		return
+	}
+	err = undoOperation(op)
+	recordAudit(user, apiv1.AuditUndo, "Undo "+op.Description, errorStrings(err))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Infof("Undo: %s undid %s", user, op.Description)
+	err = Store.Put(store.BucketUndo, user, stack[:len(stack)-1])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	opBody, err := json.Marshal(op)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(opBody)
+}
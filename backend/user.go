@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/cassaram/bfc/backend/apiv1"
+	"github.com/cassaram/bfc/backend/store"
+)
+
+// requestUser identifies the user making a request by the common name of a verified TLS client
+// certificate. Any client can set the X-BFC-User header, so it is only used with http.trust_user_header
+// set and no client_ca_file configured. Returns "" for anonymous requests.
+func requestUser(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	httpCfg := getConfig().HTTP
+	if !httpCfg.TrustUserHeader || httpCfg.ClientCAFile != "" {
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get("X-BFC-User"))
+}
+
+// getUserPreferences returns the stored preferences of a user, or defaults
+func getUserPreferences(user string) apiv1.UserPreferences {
+	prefs := apiv1.UserPreferences{}
+	if user == "" {
+		return prefs
+	}
+	Store.Get(store.BucketUsers, user, &prefs)
+	return prefs
+}
+
+func (a *APIHandler) APIV1HandleUser(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	userBody, err := json.Marshal(apiv1.User{Name: user, Preferences: getUserPreferences(user)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(userBody)
+}
+
+func (a *APIHandler) APIV1HandleUserPreferencesPut(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	if user == "" {
+		http.Error(w, errNoUser.Error(), http.StatusBadRequest)
+		return
+	}
+	body := apiv1.UserPreferences{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Error parsing body "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = Store.Put(store.BucketUsers, user, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// errNoUser is returned by handlers which need to know the user
+var errNoUser = errors.New("No user, send a client certificate, or the X-BFC-User header if http.trust_user_header is set")
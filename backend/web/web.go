@@ -0,0 +1,131 @@
+// Package web serves the frontend embedded into the binary.
+// Build the frontend with `npm run build:embed` before building the backend to include it.
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+const root = "dist/frontend/browser"
+
+// Angular output hashing adds the content hash to file names, so they never change
+var hashedName = regexp.MustCompile(`-[A-Z0-9]{8,}\.[a-z0-9]+$`)
+
+type asset struct {
+	data []byte
+	etag string
+}
+
+// Handler serves the embedded frontend. Paths which aren't files get index.html so the
+// frontend can route them, paths with an extension that don't exist get a 404.
+type Handler struct {
+	assets map[string]asset
+}
+
+func NewHandler() *Handler {
+	h := &Handler{assets: make(map[string]asset)}
+	fs.WalkDir(dist, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		data, err := dist.ReadFile(name)
+		if err != nil {
+			return nil
+		}
+		sum := sha256.Sum256(data)
+		h.assets[strings.TrimPrefix(name, root)] = asset{data: data, etag: "\"" + hex.EncodeToString(sum[:8]) + "\""}
+		return nil
+	})
+	return h
+}
+
+// Available reports whether a frontend build was embedded
+func (h *Handler) Available() bool {
+	_, ok := h.assets["/index.html"]
+	return ok
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := path.Clean("/" + r.URL.Path)
+	if name == "/" {
+		name = "/index.html"
+	}
+	if _, ok := h.assets[name]; !ok {
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		name = "/index.html"
+	}
+	if !h.Available() {
+		http.Error(w, "Frontend not included in this build", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case name == "/index.html":
+		// Must be revalidated so clients pick up new builds
+		w.Header().Set("Cache-Control", "no-cache")
+	case hashedName.MatchString(name):
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	file := h.assets[name]
+	if variant, encoding, ok := h.precompressed(name, r.Header.Get("Accept-Encoding")); ok {
+		file = variant
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	_, hasGzip := h.assets[name+".gz"]
+	_, hasBrotli := h.assets[name+".br"]
+	if hasGzip || hasBrotli {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	w.Header().Set("ETag", file.etag)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(file.data))
+}
+
+// precompressed returns the brotli or gzip variant of a file if the client accepts it
+func (h *Handler) precompressed(name string, acceptEncoding string) (asset, string, bool) {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		encoding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(params) == "q=0" {
+			continue
+		}
+		accepted[strings.ToLower(encoding)] = true
+	}
+	for _, candidate := range []struct{ encoding, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if !accepted[candidate.encoding] {
+			continue
+		}
+		if variant, ok := h.assets[name+candidate.ext]; ok {
+			return variant, candidate.encoding, true
+		}
+	}
+	return asset{}, "", false
+}
@@ -0,0 +1,3 @@
+// Replaced at runtime by the backend when it serves the UI.
+// The development server uses NG_APP_BACKEND_API_URL from .env instead.
+window.BFC_CONFIG = window.BFC_CONFIG || {};
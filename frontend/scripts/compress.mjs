@@ -0,0 +1,31 @@
+// Writes gzip and brotli variants of the built assets next to the originals,
+// so the backend can serve them precompressed.
+import { readdirSync, readFileSync, statSync, writeFileSync } from 'node:fs';
+import { extname, join } from 'node:path';
+import { brotliCompressSync, constants, gzipSync } from 'node:zlib';
+
+const compressible = new Set(['.html', '.js', '.mjs', '.css', '.json', '.svg', '.txt', '.ico', '.map']);
+const minSize = 1024;
+
+function walk(dir) {
+    for (const name of readdirSync(dir)) {
+        const path = join(dir, name);
+        if (statSync(path).isDirectory()) {
+            walk(path);
+            continue;
+        }
+        if (!compressible.has(extname(name))) {
+            continue;
+        }
+        const data = readFileSync(path);
+        if (data.length < minSize) {
+            continue;
+        }
+        writeFileSync(path + '.gz', gzipSync(data, { level: 9 }));
+        writeFileSync(path + '.br', brotliCompressSync(data, {
+            params: { [constants.BROTLI_PARAM_QUALITY]: constants.BROTLI_MAX_QUALITY },
+        }));
+    }
+}
+
+walk(process.argv[2] ?? '../backend/web/dist/frontend/browser');
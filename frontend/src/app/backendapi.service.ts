@@ -10,6 +10,7 @@ import { RouterTableLine } from "./models/routertableline";
 import { RouterTableValidSources } from "./models/routertablevalidsources";
 import { FetchBackend } from "@angular/common/http";
 import { webSocket, WebSocketSubject } from "rxjs/webSocket";
+import { apiBaseUrl, websocketUrl } from "./runtimeconfig";
 
 const httpOptions = {
     headers: new HttpHeaders({
@@ -27,7 +28,7 @@ export class BackendService {
     constructor(
         //private http: HttpClient
     ) {
-        this.socket_crosspoints$ = webSocket(import.meta.env.NG_APP_BACKEND_API_URL + '/api/v1/ws')
+        this.socket_crosspoints$ = webSocket(websocketUrl('/api/v1/ws'))
     }
 
     // Websocket API
@@ -42,35 +43,35 @@ export class BackendService {
     // HTTP API
 
     getRouters(): Observable<Router[]> {
-        return this.http.get<Router[]>(import.meta.env.NG_APP_BACKEND_API_URL + '/api/v1/routers', {responseType: 'json'});
+        return this.http.get<Router[]>(apiBaseUrl() + '/api/v1/routers', {responseType: 'json'});
     }
 
     getRouterSources(rtrid: number): Observable<RouterSource[]> {
-        return this.http.get<RouterSource[]>(import.meta.env.NG_APP_BACKEND_API_URL + '/api/v1/routers/'+rtrid+'/sources', {responseType: 'json'});
+        return this.http.get<RouterSource[]>(apiBaseUrl() + '/api/v1/routers/'+rtrid+'/sources', {responseType: 'json'});
     }
 
     getRouterDestinations(rtrid: number): Observable<RouterDestination[]> {
-        return this.http.get<RouterDestination[]>(import.meta.env.NG_APP_BACKEND_API_URL + '/api/v1/routers/'+rtrid+'/destinations', {responseType: 'json'});
+        return this.http.get<RouterDestination[]>(apiBaseUrl() + '/api/v1/routers/'+rtrid+'/destinations', {responseType: 'json'});
     }
 
     getRouterCrosspoints(rtrid: number): Observable<RouterCrosspoint[]> {
-        return this.http.get<RouterCrosspoint[]>(import.meta.env.NG_APP_BACKEND_API_URL + '/api/v1/routers/'+rtrid+'/crosspoints', {responseType: 'json'});
+        return this.http.get<RouterCrosspoint[]>(apiBaseUrl() + '/api/v1/routers/'+rtrid+'/crosspoints', {responseType: 'json'});
     }
 
     getRouterLevels(rtrid: number): Observable<RouterLevel[]> {
-        return this.http.get<RouterLevel[]>(import.meta.env.NG_APP_BACKEND_API_URL + '/api/v1/routers/'+rtrid+'/levels', {responseType: 'json'});
+        return this.http.get<RouterLevel[]>(apiBaseUrl() + '/api/v1/routers/'+rtrid+'/levels', {responseType: 'json'});
     }
 
     getRouterTable(rtrid: number): Observable<RouterTableLine[]> {
-        return this.http.get<RouterTableLine[]>(import.meta.env.NG_APP_BACKEND_API_URL + '/api/v1/routers/'+rtrid+'/table', {responseType: 'json'});
+        return this.http.get<RouterTableLine[]>(apiBaseUrl() + '/api/v1/routers/'+rtrid+'/table', {responseType: 'json'});
     }
 
     getRouterTableValidSources(rtrid: number): Observable<RouterTableValidSources> {
-        return this.http.get<RouterTableValidSources>(import.meta.env.NG_APP_BACKEND_API_URL + '/api/v1/routers/'+rtrid+'/validsources', {responseType: 'json'});
+        return this.http.get<RouterTableValidSources>(apiBaseUrl() + '/api/v1/routers/'+rtrid+'/validsources', {responseType: 'json'});
     }
 
     putRouterCrosspoint(rtr_id: number, destination_id: number, destination_level_id: number, source_id: number, source_level_id: number): Observable<any> {
-        let url = import.meta.env.NG_APP_BACKEND_API_URL + '/api/v1/routers/'+rtr_id+'/crosspoints';
+        let url = apiBaseUrl() + '/api/v1/routers/'+rtr_id+'/crosspoints';
         let body = {
             "destination_id": destination_id,
             "destination_level_id": destination_level_id,
@@ -88,7 +89,7 @@ export class BackendService {
         return this.http.put<any>(url, body, httpOptions);
     }
     putRouterCrosspointLock(rtr_id: number, destination_id: number, destination_level_id: number, locked: boolean): Observable<any> {
-        let url = import.meta.env.NG_APP_BACKEND_API_URL + '/api/v1/routers/'+rtr_id+'/crosspoints/lock';
+        let url = apiBaseUrl() + '/api/v1/routers/'+rtr_id+'/crosspoints/lock';
         let body = {
             "destination_id": destination_id,
             "destination_level_id": destination_level_id,
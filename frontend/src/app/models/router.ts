@@ -1,3 +1,4 @@
+import { RouterCapabilities } from "./routerCapabilities";
 import { RouterCrosspoint } from "./routerCrosspoint";
 import { RouterDestination } from "./routerDestination";
 import { RouterLevel } from "./routerLevel";
@@ -7,6 +8,7 @@ export interface Router {
     id:             number;
     display_name:   string;
     short_name:     string;
+    capabilities:   RouterCapabilities;
     levels:         RouterLevel[];
     sources:        RouterSource[];
     destinations:   RouterDestination[];
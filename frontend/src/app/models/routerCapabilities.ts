@@ -0,0 +1,11 @@
+export interface RouterCapabilities {
+    breakaway:           boolean;
+    lock:                boolean;
+    protect:             boolean;
+    rename_sources:      boolean;
+    rename_destinations: boolean;
+    hardware_salvos:     boolean;
+    named_levels:        boolean;
+    max_sources:         number;
+    max_destinations:    number;
+}
@@ -2,4 +2,5 @@ export interface RouterDestination {
     id:     number;
 	name:   string;
 	levels: number[];
+	tags?:  string[];
 }
\ No newline at end of file
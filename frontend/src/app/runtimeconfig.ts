@@ -0,0 +1,25 @@
+// Settings served by the backend at /config.js, see public/config.js
+interface RuntimeConfig {
+    apiUrl?: string;
+}
+
+declare global {
+    interface Window {
+        BFC_CONFIG?: RuntimeConfig;
+    }
+}
+
+// Base URL of the backend API. When the backend serves the UI it provides the URL at
+// runtime, otherwise the NG_APP_BACKEND_API_URL set at build time is used.
+export function apiBaseUrl(): string {
+    const runtime = window.BFC_CONFIG?.apiUrl;
+    if (runtime !== undefined) {
+        return runtime || window.location.origin;
+    }
+    return import.meta.env.NG_APP_BACKEND_API_URL;
+}
+
+// Websocket URL for an API path on the backend
+export function websocketUrl(path: string): string {
+    return apiBaseUrl().replace(/^http/, 'ws') + path;
+}
@@ -5,8 +5,9 @@ go 1.24.0
 toolchain go1.24.9
 
 require (
-	github.com/coder/websocket v1.8.14 // indirect
-	github.com/sirupsen/logrus v1.9.3 // indirect
-	golang.org/x/exp v0.0.0-20251023183803-a4bb9ffd2546 // indirect
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+	github.com/coder/websocket v1.8.14
+	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/exp v0.0.0-20251023183803-a4bb9ffd2546
 )
+
+require golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect